@@ -0,0 +1,121 @@
+package main
+
+import (
+	"io"
+	"strings"
+)
+
+// actionVerbs names what each action tag does, for the streaming placeholder.
+var actionVerbs = map[string]string{
+	"PATCH":         "patching",
+	"EDIT":          "editing",
+	"RUN":           "running",
+	"READ":          "reading",
+	"READ_RAW":      "reading",
+	"REPLACE":       "replacing in",
+	"LISTFILES":     "listing",
+	"SEARCHFILES":   "searching for",
+	"DIFF":          "applying a diff to",
+	"MEMORY_APPEND": "remembering",
+}
+
+// maxPlaceholderTarget caps how much of a command or query a placeholder shows.
+const maxPlaceholderTarget = 60
+
+// actionWriter filters streamed output, replacing the content of each action
+// tag with a placeholder such as "[editing main.go...]". Only the display is
+// affected; the history keeps the full response.
+type actionWriter struct {
+	w         io.Writer
+	tag       string // action whose tag we are inside, if any
+	header    string // content seen before the placeholder was written
+	announced bool
+	pending   string
+}
+
+func newActionWriter(w io.Writer, hide bool) io.Writer {
+	if !hide {
+		return w
+	}
+	return &actionWriter{w: w}
+}
+
+func (a *actionWriter) Write(p []byte) (int, error) {
+	text := a.pending + string(p)
+	a.pending = ""
+	var out strings.Builder
+	for text != "" {
+		if a.tag == "" {
+			idx, tag := findActionTag(text)
+			if idx == -1 {
+				keep := partialSuffix(text, actionOpenTags())
+				out.WriteString(text[:len(text)-keep])
+				a.pending = text[len(text)-keep:]
+				break
+			}
+			out.WriteString(text[:idx])
+			text = text[idx+len(tagName(tag))+2:]
+			a.tag, a.header, a.announced = tag, "", false
+			continue
+		}
+		closing := "</" + tagName(a.tag) + ">"
+		idx := strings.Index(text, closing)
+		body := text
+		if idx != -1 {
+			body = text[:idx]
+		} else {
+			keep := partialSuffix(text, []string{closing})
+			body = text[:len(text)-keep]
+			a.pending = text[len(text)-keep:]
+		}
+		if !a.announced {
+			a.header += body
+			if idx != -1 || strings.Contains(strings.TrimLeft(a.header, "\n"), "\n") {
+				out.WriteString(actionPlaceholder(a.tag, a.header))
+				a.announced, a.header = true, ""
+			}
+		}
+		if idx == -1 {
+			break
+		}
+		text = text[idx+len(closing):]
+		a.tag = ""
+	}
+	if _, err := io.WriteString(a.w, out.String()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// actionPlaceholder describes the action from the first line of its content:
+// the file name, or the command or query.
+func actionPlaceholder(tag, content string) string {
+	target := strings.TrimSpace(strings.SplitN(strings.TrimLeft(content, "\n"), "\n", 2)[0])
+	target = safeTruncate(target, maxPlaceholderTarget)
+	switch {
+	case tag == "LISTFILES" && target == "":
+		target = "files"
+	case target == "":
+		return "[" + actionVerbs[tag] + "...]"
+	}
+	return "[" + actionVerbs[tag] + " " + target + "...]"
+}
+
+func actionOpenTags() []string {
+	var open []string
+	for tag := range actionVerbs {
+		open = append(open, "<"+tagName(tag)+">")
+	}
+	return open
+}
+
+// findActionTag returns the position and name of the earliest action tag in text.
+func findActionTag(text string) (int, string) {
+	best, bestTag := -1, ""
+	for tag := range actionVerbs {
+		if idx := strings.Index(text, "<"+tagName(tag)+">"); idx != -1 && (best == -1 || idx < best) {
+			best, bestTag = idx, tag
+		}
+	}
+	return best, bestTag
+}
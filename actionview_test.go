@@ -0,0 +1,29 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestActionWriterPlaceholders(t *testing.T) {
+	var sb strings.Builder
+	w := newActionWriter(&sb, true)
+	chunks := []string{
+		"Updating it.\n<ED", "IT>\nmain.go\npackage", " main\n</ED", "IT>\n",
+		"[TOOL_CALL] <RUN>go test ./...</RUN>\n<LISTFILES></LISTFILES> done",
+	}
+	for _, chunk := range chunks {
+		w.Write([]byte(chunk))
+	}
+	expected := "Updating it.\n[editing main.go...]\n[TOOL_CALL] [running go test ./......]\n[listing files...] done"
+	if got := sb.String(); got != expected {
+		t.Errorf("got %q, expected %q", got, expected)
+	}
+}
+
+func TestActionWriterDisabled(t *testing.T) {
+	var sb strings.Builder
+	if w := newActionWriter(&sb, false); w != &sb {
+		t.Errorf("Expected the writer to be returned unchanged when disabled")
+	}
+}
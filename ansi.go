@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ansiPattern matches CSI sequences (colors, cursor movement), OSC sequences
+// (titles, hyperlinks) and the remaining two-byte escape sequences.
+var ansiPattern = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(\x07|\x1b\\)|\x1b[@-Z\\-_]`)
+
+// stripANSI removes terminal escape sequences from s.
+func stripANSI(s string) string {
+	return ansiPattern.ReplaceAllString(s, "")
+}
+
+// Log encodings accepted by Config.LogEncoding.
+const (
+	logEncodingStrip  = "strip"
+	logEncodingEscape = "escape"
+	logEncodingKeep   = "keep"
+)
+
+// isLogControl reports whether r is a control character that garbles logs.
+// Newlines and tabs are kept.
+func isLogControl(r rune) bool {
+	return (r < 0x20 && r != '\n' && r != '\t') || r == 0x7f || (r >= 0x80 && r < 0xa0)
+}
+
+// sanitizeLog makes s safe to cat or grep according to encoding: "strip"
+// (the default) removes escape sequences and control characters, "escape"
+// writes them as \xNN and "keep" leaves s unchanged.
+func sanitizeLog(s, encoding string) string {
+	switch encoding {
+	case logEncodingKeep:
+		return s
+	case logEncodingEscape:
+		var sb strings.Builder
+		for _, r := range s {
+			if isLogControl(r) {
+				sb.WriteString(fmt.Sprintf("\\x%02x", r))
+			} else {
+				sb.WriteRune(r)
+			}
+		}
+		return sb.String()
+	}
+	return strings.Map(func(r rune) rune {
+		if isLogControl(r) {
+			return -1
+		}
+		return r
+	}, stripANSI(s))
+}
@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestStripANSI(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected string
+	}{
+		{"plain text", "plain text"},
+		{"\x1b[31mred\x1b[0m", "red"},
+		{"\x1b[1;32mPASS\x1b[0m ok", "PASS ok"},
+		{"\x1b[2K\x1b[1Gprogress", "progress"},
+		{"\x1b]0;title\x07after", "after"},
+		{"\x1b]8;;https://example.com\x1b\\link\x1b]8;;\x1b\\", "link"},
+		{"tab\tand\nnewline", "tab\tand\nnewline"},
+	}
+	for _, c := range cases {
+		if got := stripANSI(c.input); got != c.expected {
+			t.Errorf("stripANSI(%q) = %q, expected %q", c.input, got, c.expected)
+		}
+	}
+}
+
+func TestSanitizeLog(t *testing.T) {
+	input := "\x1b[31mred\x1b[0m\r\nbell\a\ttab"
+	cases := map[string]string{
+		"":       "red\nbell\ttab",
+		"strip":  "red\nbell\ttab",
+		"escape": "\\x1b[31mred\\x1b[0m\\x0d\nbell\\x07\ttab",
+		"keep":   input,
+	}
+	for encoding, expected := range cases {
+		if got := sanitizeLog(input, encoding); got != expected {
+			t.Errorf("sanitizeLog(%q) = %q, expected %q", encoding, got, expected)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// defaultCacheTTLHours is how long cached responses are reused by default.
+const defaultCacheTTLHours = 24
+
+// cacheDir is where cached responses are stored; main sets it to
+// ~/.config/arisu/cache.
+var cacheDir string
+
+// cacheEntry is one cached response on disk.
+type cacheEntry struct {
+	CreatedAt time.Time `json:"created_at"`
+	Response  string    `json:"response"`
+	Truncated bool      `json:"truncated,omitempty"`
+}
+
+// cachedClient answers a request from the on-disk cache when the same
+// conversation was sent to the same model with the same parameters before,
+// and stores new responses for later runs.
+type cachedClient struct {
+	AIClient
+	dir    string
+	ttl    time.Duration
+	params map[string]interface{}
+	out    io.Writer
+	// hit reports whether the last response came from the cache.
+	hit       bool
+	truncated bool
+}
+
+// newCachedClient returns client unchanged unless Config.CacheResponses is set.
+func newCachedClient(client AIClient, config *Config, provider string, opts clientOptions) AIClient {
+	if !config.CacheResponses || cacheDir == "" {
+		return client
+	}
+	ttl := config.CacheTTLHours
+	if ttl <= 0 {
+		ttl = defaultCacheTTLHours
+	}
+	params := map[string]interface{}{
+		"provider": provider,
+		"model":    config.SelectedModel,
+		"system":   opts.systemPrompt,
+		"extra":    opts.extraBody,
+	}
+	return &cachedClient{AIClient: client, dir: cacheDir, ttl: time.Duration(ttl) * time.Hour, params: params, out: console}
+}
+
+// cacheKey hashes the request parameters and the conversation including input.
+func cacheKey(params map[string]interface{}, history []Message, input string) (string, error) {
+	data, err := json.Marshal(struct {
+		Params   map[string]interface{} `json:"params"`
+		Messages []Message              `json:"messages"`
+	}{params, append(append([]Message{}, history...), Message{Role: "user", Content: input})})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// SendMessage streams a cached response when one is fresh, and otherwise
+// sends the request and caches the response.
+func (c *cachedClient) SendMessage(ctx context.Context, input string) (string, error) {
+	c.hit = false
+	key, err := cacheKey(c.params, c.AIClient.GetHistory(), input)
+	if err != nil {
+		return c.AIClient.SendMessage(ctx, input)
+	}
+	path := filepath.Join(c.dir, key+".json")
+	if entry, ok := c.load(path); ok {
+		logDebug("Response cache hit: %s", key)
+		c.hit, c.truncated = true, entry.Truncated
+		c.AIClient.AddMessage("user", input)
+		c.AIClient.AddMessage("assistant", entry.Response)
+		fmt.Fprint(c.out, entry.Response)
+		return entry.Response, nil
+	}
+	response, err := c.AIClient.SendMessage(ctx, input)
+	if err != nil {
+		return response, err
+	}
+	if err := c.store(path, cacheEntry{CreatedAt: time.Now(), Response: response, Truncated: c.AIClient.Truncated()}); err != nil {
+		logWarn("Warning: could not cache the response: %v", err)
+	}
+	return response, nil
+}
+
+// load returns the entry at path if it exists and hasn't expired.
+func (c *cachedClient) load(path string) (cacheEntry, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cacheEntry{}, false
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil || time.Since(entry.CreatedAt) > c.ttl {
+		return cacheEntry{}, false
+	}
+	return entry, true
+}
+
+func (c *cachedClient) store(path string, entry cacheEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.dir, 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// SetOutput also records where cached responses are streamed.
+func (c *cachedClient) SetOutput(w io.Writer) {
+	c.out = w
+	c.AIClient.SetOutput(w)
+}
+
+// Truncated reports the cached flag when the last response was a cache hit.
+func (c *cachedClient) Truncated() bool {
+	if c.hit {
+		return c.truncated
+	}
+	return c.AIClient.Truncated()
+}
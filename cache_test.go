@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestCachedClientReplaysResponse(t *testing.T) {
+	cacheDir = t.TempDir()
+	defer func() { cacheDir = "" }()
+	config := &Config{SelectedModel: "gpt-4o", CacheResponses: true}
+
+	first := &scriptedClient{replies: []string{"4\n"}}
+	client := newCachedClient(first, config, "openai", clientOptions{systemPrompt: "system"})
+	if response, err := client.SendMessage(context.Background(), "2+2?"); err != nil || response != "4\n" {
+		t.Fatalf("SendMessage = %q, %v", response, err)
+	}
+
+	second := &scriptedClient{}
+	client = newCachedClient(second, config, "openai", clientOptions{systemPrompt: "system"})
+	var out bytes.Buffer
+	client.SetOutput(&out)
+	response, err := client.SendMessage(context.Background(), "2+2?")
+	if err != nil || response != "4\n" || out.String() != "4\n" {
+		t.Fatalf("Expected the cached response to be streamed, got %q (out %q, %v)", response, out.String(), err)
+	}
+	if len(second.sent) != 0 || len(second.history) != 2 {
+		t.Errorf("Expected no request and the turn in history, sent %q, history %+v", second.sent, second.history)
+	}
+
+	// A different conversation misses the cache.
+	third := &scriptedClient{replies: []string{"5\n"}}
+	client = newCachedClient(third, config, "openai", clientOptions{systemPrompt: "other system"})
+	if response, _ := client.SendMessage(context.Background(), "2+2?"); response != "5\n" || len(third.sent) != 1 {
+		t.Errorf("Expected a cache miss for another system prompt, got %q", response)
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// defaultMaxHistory is the number of messages kept in a client's history.
+const defaultMaxHistory = 50
+
+// minMaxHistory is the smallest usable history: the system prompt (or the
+// previous message) and the message being sent.
+const minMaxHistory = 2
+
+// historyLimit returns the history size clients use for n: defaultMaxHistory
+// when n is unset, and never less than minMaxHistory, below which the
+// truncation in SendMessage would compute invalid slice bounds.
+func historyLimit(n int) int {
+	if n <= 0 {
+		return defaultMaxHistory
+	}
+	return max(n, minMaxHistory)
+}
+
+// clientOptions holds the provider-independent settings every client is built with.
+type clientOptions struct {
+	systemPrompt  string
+	maxHistory    int
+	reasoningTags []string
+	extraBody     map[string]interface{}
+	// baseURL is Config.BaseURLOverrides for the provider; empty uses the public API.
+	baseURL string
+	// showStats is Config.ShowStats.
+	showStats bool
+	// separateUserTurns is Config.GeminiSeparateUserTurns; only Gemini uses it.
+	separateUserTurns bool
+	// includeUsage asks OpenAI-compatible APIs to end the stream with token
+	// usage. It is only set when a feature needs it: the session cost cap,
+	// --json and tracing.
+	includeUsage bool
+	// responseSchema is Config.ResponseFormat; only Gemini reads it, the
+	// other providers get it in extraBody.
+	responseSchema map[string]interface{}
+	// maxContextTokens is Config.MaxContextTokens.
+	maxContextTokens int
+}
+
+// newClientOptions derives client options from config.
+func newClientOptions(config *Config, provider, systemPrompt string) clientOptions {
+	return clientOptions{
+		systemPrompt:      systemPrompt,
+		maxHistory:        historyLimit(config.MaxHistory),
+		maxContextTokens:  config.MaxContextTokens,
+		reasoningTags:     reasoningTags(config),
+		extraBody:         withGrounding(withResponseFormat(withModelControls(extraBody(config, provider), config, provider), config, provider), config, provider),
+		baseURL:           config.BaseURLOverrides[provider],
+		showStats:         config.ShowStats,
+		separateUserTurns: config.GeminiSeparateUserTurns,
+		includeUsage:      config.MaxSessionCostUSD > 0 || jsonOutput != nil || activeTracer != nil,
+		responseSchema:    config.ResponseFormat,
+	}
+}
+
+// reservedBodyFields are request fields arisu sets itself; ExtraBody may not override them.
+var reservedBodyFields = map[string]bool{"messages": true, "model": true, "stream": true, "stream_options": true}
+
+// extraBody returns the Config.ExtraBody fields for provider, dropping
+// reserved fields with a warning.
+func extraBody(config *Config, provider string) map[string]interface{} {
+	fields := config.ExtraBody[provider]
+	if len(fields) == 0 {
+		return nil
+	}
+	if provider == "gemini" {
+		logWarn("Warning: extra_body is not supported for gemini and is ignored.")
+		return nil
+	}
+	extra := make(map[string]interface{}, len(fields))
+	var dropped []string
+	for key, value := range fields {
+		if reservedBodyFields[key] {
+			dropped = append(dropped, key)
+			continue
+		}
+		extra[key] = value
+	}
+	sort.Strings(dropped)
+	for _, key := range dropped {
+		logWarn("Warning: ignoring extra_body field %q for %s; it is set by arisu.", key, provider)
+	}
+	return extra
+}
+
+// reasoningEfforts and verbosities are the accepted values of
+// Config.ReasoningEffort and Config.Verbosity.
+var (
+	reasoningEfforts = []string{"minimal", "low", "medium", "high"}
+	verbosities      = []string{"low", "medium", "high"}
+)
+
+// validateModelControls checks Config.ReasoningEffort and Config.Verbosity.
+func validateModelControls(config *Config) error {
+	if config.ReasoningEffort != "" && !contains(reasoningEfforts, config.ReasoningEffort) {
+		return fmt.Errorf("invalid reasoning_effort %q (use %s)", config.ReasoningEffort, strings.Join(reasoningEfforts, ", "))
+	}
+	if config.Verbosity != "" && !contains(verbosities, config.Verbosity) {
+		return fmt.Errorf("invalid verbosity %q (use %s)", config.Verbosity, strings.Join(verbosities, ", "))
+	}
+	return nil
+}
+
+// supportsReasoningEffort reports whether an OpenAI model accepts
+// reasoning_effort: the o-series and GPT-5 models.
+func supportsReasoningEffort(model string) bool {
+	for _, prefix := range []string{"o1", "o3", "o4", "gpt-5"} {
+		if strings.HasPrefix(model, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// supportsVerbosity reports whether an OpenAI model accepts verbosity.
+func supportsVerbosity(model string) bool {
+	return strings.HasPrefix(model, "gpt-5")
+}
+
+// withModelControls adds Config.ReasoningEffort and Config.Verbosity to the
+// extra body fields of OpenAI requests when the selected model supports them.
+// They are left out for other models, which would reject the request.
+func withModelControls(extra map[string]interface{}, config *Config, provider string) map[string]interface{} {
+	if config.ReasoningEffort == "" && config.Verbosity == "" {
+		return extra
+	}
+	model := config.SelectedModel
+	controls := map[string]interface{}{}
+	if config.ReasoningEffort != "" {
+		if provider == "openai" && supportsReasoningEffort(model) {
+			controls["reasoning_effort"] = config.ReasoningEffort
+		} else {
+			logDebug("reasoning_effort is not supported by %s; omitted", model)
+		}
+	}
+	if config.Verbosity != "" {
+		if provider == "openai" && supportsVerbosity(model) {
+			controls["verbosity"] = config.Verbosity
+		} else {
+			logDebug("verbosity is not supported by %s; omitted", model)
+		}
+	}
+	if len(controls) == 0 {
+		return extra
+	}
+	if extra == nil {
+		extra = map[string]interface{}{}
+	}
+	mergeExtraBody(extra, controls)
+	return extra
+}
+
+// mergeExtraBody copies extra into payload.
+func mergeExtraBody(payload, extra map[string]interface{}) {
+	for key, value := range extra {
+		payload[key] = value
+	}
+}
+
+// extraBodyDoer merges extra fields into the JSON body of every request, for
+// SDKs whose request types can't carry arbitrary fields.
+type extraBodyDoer struct {
+	client *http.Client
+	extra  map[string]interface{}
+}
+
+func (d extraBodyDoer) Do(req *http.Request) (*http.Response, error) {
+	if req.Body == nil || len(d.extra) == 0 {
+		return d.client.Do(req)
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err == nil {
+		mergeExtraBody(payload, d.extra)
+		if merged, err := json.Marshal(payload); err == nil {
+			body = merged
+		}
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	return d.client.Do(req)
+}
+
+// chatCompletionsURL returns the chat completions endpoint under an
+// OpenAI-style base URL such as "https://gateway.internal/v1", or fallback
+// when baseURL is empty.
+func chatCompletionsURL(baseURL, fallback string) string {
+	if baseURL == "" {
+		return fallback
+	}
+	return strings.TrimSuffix(baseURL, "/") + "/chat/completions"
+}
+
+// providerEndpoint returns the API endpoint requests for provider are sent
+// to, honoring a base URL override.
+func providerEndpoint(provider, baseURL string) string {
+	if baseURL != "" {
+		if provider == "gemini" {
+			return baseURL
+		}
+		return chatCompletionsURL(baseURL, "")
+	}
+	switch provider {
+	case "gemini":
+		return "https://generativelanguage.googleapis.com"
+	case "grok":
+		return grokEndpoint
+	case "openai":
+		return "https://api.openai.com/v1/chat/completions"
+	case "openrouter":
+		return openRouterEndpoint
+	}
+	return ""
+}
+
+// newAIClient builds the client for provider and model.
+func newAIClient(provider, apiKey, model string, opts clientOptions) AIClient {
+	switch provider {
+	case "gemini":
+		if model == "gemini" {
+			model = "gemini-2.0-flash"
+		}
+		return NewClient(apiKey, model, opts)
+	case "grok":
+		return NewGrokClient(apiKey, model, opts)
+	case "openai":
+		return NewOpenAIClient(apiKey, model, opts)
+	case "openrouter":
+		return NewOpenRouterClient(apiKey, model, opts)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExtraBodyMergedIntoRequest(t *testing.T) {
+	config := &Config{ExtraBody: map[string]map[string]interface{}{
+		"openai": {"reasoning_effort": "high", "model": "other"},
+	}}
+	extra := extraBody(config, "openai")
+	if _, ok := extra["model"]; ok {
+		t.Fatalf("Expected reserved field model to be dropped")
+	}
+
+	var got map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequest("POST", server.URL, strings.NewReader(`{"model":"gpt-4o","messages":[]}`))
+	resp, err := extraBodyDoer{client: server.Client(), extra: extra}.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+	if got["model"] != "gpt-4o" || got["reasoning_effort"] != "high" {
+		t.Errorf("Unexpected body %v", got)
+	}
+}
+
+func TestBaseURLOverride(t *testing.T) {
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"hi\"}}]}\n\ndata: [DONE]\n"))
+	}))
+	defer server.Close()
+
+	config := &Config{BaseURLOverrides: map[string]string{"grok": server.URL + "/v1/"}}
+	client := NewGrokClient("key", "grok-3", newClientOptions(config, "grok", ""))
+	client.SetOutput(io.Discard)
+	response, err := client.SendMessage(context.Background(), "hello")
+	if err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	if path != "/v1/chat/completions" || response != "hi\n" {
+		t.Errorf("request went to %q with response %q", path, response)
+	}
+	if got := providerEndpoint("grok", config.BaseURLOverrides["grok"]); got != server.URL+"/v1/chat/completions" {
+		t.Errorf("providerEndpoint = %q", got)
+	}
+}
+
+func TestSmallMaxHistoryDoesNotPanic(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"ok\"}}]}\n\ndata: [DONE]\n"))
+	}))
+	defer server.Close()
+
+	for _, maxHistory := range []int{0, 1, 2} {
+		opts := clientOptions{systemPrompt: "system", maxHistory: maxHistory, baseURL: server.URL}
+		for _, client := range []AIClient{NewGrokClient("key", "grok-3", opts), NewOpenRouterClient("key", "openrouter-x/y", opts)} {
+			client.SetOutput(io.Discard)
+			for i := 0; i < 3; i++ {
+				if _, err := client.SendMessage(context.Background(), "hello"); err != nil {
+					t.Fatalf("SendMessage with maxHistory %d failed: %v", maxHistory, err)
+				}
+			}
+			if history := client.GetHistory(); history[0].Role != "system" {
+				t.Errorf("Expected the system prompt to be kept with maxHistory %d, got %+v", maxHistory, history)
+			}
+		}
+	}
+}
+
+func TestModelControls(t *testing.T) {
+	config := &Config{SelectedModel: "gpt-5", ReasoningEffort: "high", Verbosity: "low"}
+	extra := newClientOptions(config, "openai", "").extraBody
+	if extra["reasoning_effort"] != "high" || extra["verbosity"] != "low" {
+		t.Errorf("Expected both controls for gpt-5, got %v", extra)
+	}
+
+	config.SelectedModel = "o3"
+	extra = newClientOptions(config, "openai", "").extraBody
+	if _, ok := extra["verbosity"]; ok || extra["reasoning_effort"] != "high" {
+		t.Errorf("Expected only reasoning_effort for o3, got %v", extra)
+	}
+
+	config.SelectedModel = "gpt-4o"
+	if extra := newClientOptions(config, "openai", "").extraBody; len(extra) != 0 {
+		t.Errorf("Expected no controls for gpt-4o, got %v", extra)
+	}
+
+	if err := validateModelControls(&Config{ReasoningEffort: "extreme"}); err == nil {
+		t.Errorf("Expected an error for an invalid reasoning_effort")
+	}
+	if err := validateModelControls(&Config{Verbosity: "minimal"}); err == nil {
+		t.Errorf("Expected an error for an invalid verbosity")
+	}
+}
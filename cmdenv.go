@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"sort"
+	"strings"
+)
+
+// minimalEnvVars are inherited by commands when Config.MinimalCommandEnv is set.
+var minimalEnvVars = []string{"PATH", "HOME", "USER", "LOGNAME", "SHELL", "TERM", "LANG", "LC_ALL", "TMPDIR", "PWD"}
+
+// isSecretEnvVar reports whether name looks like a credential, such as the
+// provider API keys arisu itself may have been given.
+func isSecretEnvVar(name string) bool {
+	upper := strings.ToUpper(name)
+	for _, suffix := range []string{"_API_KEY", "_API_TOKEN", "_SECRET", "_SECRET_KEY", "_ACCESS_KEY", "_TOKEN"} {
+		if strings.HasSuffix(upper, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// commandEnv builds the environment for commands started by RUN. Credential
+// variables are scrubbed unless listed in Config.AllowedEnv, only a minimal
+// set is inherited with Config.MinimalCommandEnv, and Config.CommandEnv is
+// applied last.
+func commandEnv(config *Config, environ []string) []string {
+	allowed := map[string]bool{}
+	for _, name := range config.AllowedEnv {
+		allowed[name] = true
+	}
+	minimal := map[string]bool{}
+	for _, name := range minimalEnvVars {
+		minimal[name] = true
+	}
+
+	env := map[string]string{}
+	for _, kv := range environ {
+		name, value, ok := strings.Cut(kv, "=")
+		if !ok {
+			continue
+		}
+		if !allowed[name] && (isSecretEnvVar(name) || (config.MinimalCommandEnv && !minimal[name])) {
+			continue
+		}
+		env[name] = value
+	}
+	for name, value := range config.CommandEnv {
+		env[name] = value
+	}
+
+	out := make([]string, 0, len(env))
+	for name, value := range env {
+		out = append(out, name+"="+value)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// runEnv returns the environment for RUN commands in this process.
+func runEnv(config *Config) []string {
+	return commandEnv(config, os.Environ())
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCommandEnv(t *testing.T) {
+	environ := []string{"PATH=/usr/bin", "OPENAI_API_KEY=sk-1", "GITHUB_TOKEN=gh", "EDITOR=vim", "HOME=/home/me"}
+
+	got := commandEnv(&Config{AllowedEnv: []string{"GITHUB_TOKEN"}}, environ)
+	expected := []string{"EDITOR=vim", "GITHUB_TOKEN=gh", "HOME=/home/me", "PATH=/usr/bin"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("commandEnv = %v, expected %v", got, expected)
+	}
+
+	got = commandEnv(&Config{MinimalCommandEnv: true, CommandEnv: map[string]string{"PATH": "/opt/bin", "CI": "1"}}, environ)
+	expected = []string{"CI=1", "HOME=/home/me", "PATH=/opt/bin"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("minimal commandEnv = %v, expected %v", got, expected)
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/atotto/clipboard"
+)
+
+// slashCommand is a REPL command such as /copy that is handled locally
+// instead of being sent to the model.
+type slashCommand struct {
+	name  string
+	usage string
+	run   func(ctx context.Context, s *session, args string)
+}
+
+var slashCommands []slashCommand
+
+func init() {
+	slashCommands = []slashCommand{
+		{name: "copy", usage: "/copy [code] - copy the last response (or its last code block) to the clipboard", run: cmdCopy},
+		{name: "unpin", usage: "/unpin [file] - stop attaching a pinned file (or all files) to requests", run: cmdUnpin},
+		{name: "note", usage: "/note <text> - add a note to the session scratchpad sent with every request", run: cmdNote},
+		{name: "notes", usage: "/notes - show the session scratchpad", run: cmdNotes},
+		{name: "compact", usage: "/compact - replace the conversation with a model-written summary", run: cmdCompact},
+		{name: "use", usage: "/use <template> [key=value ...] - send a prompt template from the config", run: cmdUse},
+		{name: "dump", usage: "/dump <file> - write the conversation history to a JSON file", run: cmdDump},
+		{name: "reload-config", usage: "/reload-config - re-read the config files and apply them to this session", run: cmdReloadConfig},
+		{name: "provider", usage: "/provider - show the active provider, model, endpoint and modes", run: cmdProvider},
+		{name: "help", usage: "/help - list the REPL commands", run: cmdHelp},
+	}
+}
+
+// handleSlashCommand runs input as a slash command and reports whether it was
+// one. Commands may be abbreviated to an unambiguous prefix, e.g. /prov. Any
+// other /word is reported as unknown rather than sent to the model; input
+// whose first word is a path such as /etc/hosts is not a command.
+func handleSlashCommand(ctx context.Context, s *session, input string) bool {
+	if !strings.HasPrefix(input, "/") {
+		return false
+	}
+	name, args, _ := strings.Cut(strings.TrimPrefix(input, "/"), " ")
+	if name == "" || strings.Contains(name, "/") {
+		return false
+	}
+	matches := findSlashCommands(name)
+	switch len(matches) {
+	case 0:
+		fmt.Fprintf(console, "Unknown command /%s, try /help.\n", name)
+	case 1:
+		matches[0].run(ctx, s, strings.TrimSpace(args))
+	default:
+		names := make([]string, len(matches))
+		for i, cmd := range matches {
+			names[i] = "/" + cmd.name
+		}
+		fmt.Fprintf(console, "Ambiguous command /%s: %s.\n", name, strings.Join(names, ", "))
+	}
+	return true
+}
+
+// findSlashCommands returns the command named name, or else every command
+// that name is a prefix of.
+func findSlashCommands(name string) []slashCommand {
+	var matches []slashCommand
+	for _, cmd := range slashCommands {
+		if cmd.name == name {
+			return []slashCommand{cmd}
+		}
+		if strings.HasPrefix(cmd.name, name) {
+			matches = append(matches, cmd)
+		}
+	}
+	return matches
+}
+
+func cmdHelp(ctx context.Context, s *session, args string) {
+	fmt.Fprintln(console, "Commands (any unambiguous prefix works, e.g. /prov):")
+	for _, cmd := range slashCommands {
+		fmt.Fprintf(console, "  %s\n", cmd.usage)
+	}
+	fmt.Fprintln(console, "  exit - quit")
+}
+
+func cmdCopy(ctx context.Context, s *session, args string) {
+	text := lastAssistantResponse(s.client.GetHistory())
+	if text == "" {
+		fmt.Fprintln(console, "Nothing to copy yet.")
+		return
+	}
+	if args == "code" {
+		code, ok := lastCodeBlock(text)
+		if !ok {
+			fmt.Fprintln(console, "No code block found in the last response.")
+			return
+		}
+		text = code
+	}
+	if err := clipboard.WriteAll(text); err != nil {
+		logError("Error copying to clipboard: %v", err)
+		return
+	}
+	fmt.Fprintln(console, "Copied to clipboard.")
+}
+
+func cmdUnpin(ctx context.Context, s *session, args string) {
+	if args == "" {
+		pinnedFiles = nil
+		fmt.Fprintln(console, "Unpinned all files.")
+		return
+	}
+	if !unpinFile(args) {
+		fmt.Fprintf(console, "%s is not pinned.\n", args)
+		return
+	}
+	fmt.Fprintf(console, "Unpinned %s.\n", args)
+}
+
+func cmdNote(ctx context.Context, s *session, args string) {
+	if args == "" {
+		fmt.Fprintln(console, "Usage: /note <text>")
+		return
+	}
+	if err := s.addNote(args); err != nil {
+		logError("Error saving note: %v", err)
+		return
+	}
+	fmt.Fprintln(console, "Noted.")
+}
+
+func cmdNotes(ctx context.Context, s *session, args string) {
+	notes := s.readNotes()
+	if notes == "" {
+		fmt.Fprintln(console, "No notes yet. Add one with /note <text>.")
+		return
+	}
+	fmt.Fprintln(console, notes)
+}
+
+func cmdDump(ctx context.Context, s *session, args string) {
+	if args == "" {
+		fmt.Fprintln(console, "Usage: /dump <file>")
+		return
+	}
+	if err := dumpHistory(args, s.provider, s.config.SelectedModel, s.client.GetHistory()); err != nil {
+		logError("Error writing %s: %v", args, err)
+		return
+	}
+	fmt.Fprintf(console, "Wrote the history to %s.\n", args)
+}
+
+func cmdProvider(ctx context.Context, s *session, args string) {
+	fmt.Fprintf(console, "Provider:      %s\n", s.provider)
+	fmt.Fprintf(console, "Model:         %s\n", s.config.SelectedModel)
+	fmt.Fprintf(console, "Endpoint:      %s\n", providerEndpoint(s.provider, s.config.BaseURLOverrides[s.provider]))
+	fmt.Fprintf(console, "Max history:   %d\n", historyLimit(s.config.MaxHistory))
+	fmt.Fprintf(console, "Auto-edit:     %v\n", s.config.AutoEdit)
+	fmt.Fprintf(console, "Auto-run:      %v\n", s.config.AutoRun)
+	fmt.Fprintf(console, "Auto-continue: %v\n", s.config.AutoContinue)
+	if r, ok := unwrapClient(s.client).(rateLimitReporter); ok {
+		fmt.Fprintf(console, "Rate limit:    %s\n", r.RateLimit())
+	}
+}
+
+const compactPrompt = "Summarize our conversation so far into a concise state for continuing the work: " +
+	"the goal, decisions made and why, files changed and their current state, and open tasks. " +
+	"Reply with the summary only and do not use any action tags."
+
+func cmdCompact(ctx context.Context, s *session, args string) {
+	before := estimateTokens(s.client.GetHistory())
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+	summary, err := s.client.SendMessage(ctx, compactPrompt)
+	if err != nil {
+		_ = s.stream.Keep()
+		logError("Error compacting conversation: %v", err)
+		return
+	}
+	// Log the summary exchange first; the log keeps the full conversation
+	// while the session file is saved compacted.
+	s.record()
+	s.client.SetHistory([]Message{
+		{Role: "user", Content: "Summary of our conversation so far:\n" + strings.TrimSpace(summary)},
+		{Role: "assistant", Content: "Understood. Let's continue from there."},
+	})
+	s.lastLoggedIndex = len(s.client.GetHistory())
+	s.record()
+	fmt.Fprintf(console, "Compacted conversation from ~%d to ~%d tokens.\n", before, estimateTokens(s.client.GetHistory()))
+}
+
+// estimateTokens roughly estimates the tokens in history at four characters per token.
+func estimateTokens(history []Message) int {
+	chars := 0
+	for _, msg := range history {
+		chars += len(msg.Content)
+	}
+	return chars / 4
+}
+
+func cmdUse(ctx context.Context, s *session, args string) {
+	fields := splitArgs(args)
+	if len(fields) == 0 {
+		fmt.Fprintln(console, "Usage: /use <template> [key=value ...]")
+		for _, name := range templateNames(s.config) {
+			fmt.Fprintf(console, "  %s\n", name)
+		}
+		return
+	}
+	prompt, err := renderTemplate(s.config, fields[0], fields[1:])
+	if err != nil {
+		logError("Error: %v", err)
+		return
+	}
+	_ = s.runTurn(ctx, expandMentions(prompt, s.config))
+}
+
+// splitArgs splits args on spaces, keeping double-quoted text together, so
+// /use accepts values such as focus="error handling".
+func splitArgs(args string) []string {
+	var fields []string
+	var cur strings.Builder
+	inQuotes, inField := false, false
+	for _, r := range args {
+		switch {
+		case r == '"':
+			inQuotes, inField = !inQuotes, true
+		case r == ' ' && !inQuotes:
+			if inField {
+				fields = append(fields, cur.String())
+				cur.Reset()
+				inField = false
+			}
+		default:
+			cur.WriteRune(r)
+			inField = true
+		}
+	}
+	if inField {
+		fields = append(fields, cur.String())
+	}
+	return fields
+}
+
+// lastAssistantResponse returns the most recent assistant message in history.
+func lastAssistantResponse(history []Message) string {
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Role == "assistant" {
+			return strings.TrimSpace(history[i].Content)
+		}
+	}
+	return ""
+}
+
+// lastCodeBlock returns the contents of the last fenced code block in text.
+func lastCodeBlock(text string) (string, bool) {
+	parts := strings.Split(text, "```")
+	if len(parts) < 3 {
+		return "", false
+	}
+	// Fenced blocks are the odd-numbered parts; ignore a trailing unterminated fence.
+	last := len(parts) - 2
+	if last%2 == 0 {
+		last--
+	}
+	block := parts[last]
+	// Drop the language tag on the opening fence line.
+	if nl := strings.Index(block, "\n"); nl != -1 {
+		block = block[nl+1:]
+	}
+	return strings.TrimRight(block, "\n"), true
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFindSlashCommands(t *testing.T) {
+	cases := []struct {
+		name string
+		want []string
+	}{
+		{"provider", []string{"provider"}},
+		{"prov", []string{"provider"}},
+		{"note", []string{"note"}},
+		{"no", []string{"note", "notes"}},
+		{"foo", nil},
+	}
+	for _, c := range cases {
+		var got []string
+		for _, cmd := range findSlashCommands(c.name) {
+			got = append(got, cmd.name)
+		}
+		if len(got) != len(c.want) {
+			t.Errorf("findSlashCommands(%q) = %v, want %v", c.name, got, c.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != c.want[i] {
+				t.Errorf("findSlashCommands(%q) = %v, want %v", c.name, got, c.want)
+			}
+		}
+	}
+}
+
+func TestHandleSlashCommandUnknown(t *testing.T) {
+	s := &session{config: &Config{}}
+	if !handleSlashCommand(context.Background(), s, "/foo bar") {
+		t.Errorf("Expected an unknown command not to be sent to the model")
+	}
+	if handleSlashCommand(context.Background(), s, "/etc/hosts is empty, why?") {
+		t.Errorf("Expected a path to be sent to the model")
+	}
+}
+
+func TestCompactReplacesHistoryWithSummary(t *testing.T) {
+	dir := t.TempDir()
+	client := &scriptedClient{
+		replies: []string{"We renamed greet to hello in main.go; tests still to fix.\n"},
+		history: []Message{
+			{Role: "user", Content: "rename greet"},
+			{Role: "assistant", Content: strings.Repeat("Renaming greet to hello. ", 40)},
+		},
+	}
+	logFile := filepath.Join(dir, "conversation.log")
+	s := &session{client: client, config: &Config{}, logFile: logFile, stream: newStreamLogger(logFile, ""),
+		sessionFile: filepath.Join(dir, "session.json")}
+
+	cmdCompact(context.Background(), s, "")
+
+	if len(client.sent) != 1 || client.sent[0] != compactPrompt {
+		t.Fatalf("Expected one summary request, sent %q", client.sent)
+	}
+	history := client.GetHistory()
+	if len(history) != 2 || !strings.Contains(history[0].Content, "We renamed greet to hello") || history[1].Role != "assistant" {
+		t.Fatalf("Expected the history to be the summary exchange, got %+v", history)
+	}
+	saved, err := loadTranscript(s.sessionFile)
+	if err != nil || len(saved) != 2 {
+		t.Errorf("Expected the session file to hold the compacted history, got %+v (%v)", saved, err)
+	}
+	// The log keeps the conversation that was compacted away.
+	if data, _ := os.ReadFile(logFile); !strings.Contains(string(data), "rename greet") {
+		t.Errorf("Expected the log to keep the original messages, got %q", data)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// compareColors are the label colors for --compare, one per model in turn.
+var compareColors = []lipgloss.Color{"6", "5", "3", "2", "4", "1"}
+
+// compareResult is one model's answer in --compare mode.
+type compareResult struct {
+	model    string
+	provider string
+	response string
+	elapsed  time.Duration
+	err      error
+}
+
+// compareModels sends prompt to every model concurrently and returns the
+// results in the order the models were given. Responses are only collected;
+// no actions are executed. With a non-nil mux, each response is also streamed
+// through it under a colored label as it arrives.
+func compareModels(ctx context.Context, config *Config, models []string, prompt, systemPrompt string, mux *streamMux) []compareResult {
+	results := make([]compareResult, len(models))
+	var wg sync.WaitGroup
+	for i, model := range models {
+		model = normalizeModel(model)
+		modelConfig := *config
+		modelConfig.SelectedModel = model
+		provider := resolveProvider(&modelConfig)
+		results[i] = compareResult{model: model, provider: provider}
+		var out io.WriteCloser = nopWriteCloser{io.Discard}
+		if mux != nil {
+			out = mux.stream(compareLabel(i, model))
+		}
+		if provider == "" {
+			results[i].err = fmt.Errorf("unknown model %q", model)
+			finishCompare(out, results[i])
+			continue
+		}
+		apiKey := config.APIKeys[provider]
+		if apiKey == "" {
+			results[i].err = fmt.Errorf("no %s API key; run arisu once with this model to set it", provider)
+			finishCompare(out, results[i])
+			continue
+		}
+
+		wg.Add(1)
+		go func(r *compareResult) {
+			defer wg.Done()
+			client := newSessionClient(&modelConfig, provider, apiKey, systemPrompt)
+			defer client.Close()
+			client.SetOutput(out)
+			start := time.Now()
+			r.response, r.err = client.SendMessage(ctx, prompt)
+			r.elapsed = time.Since(start)
+			finishCompare(out, *r)
+		}(&results[i])
+	}
+	wg.Wait()
+	return results
+}
+
+// compareLabel is the colored header shown above the i-th model's response.
+func compareLabel(i int, model string) string {
+	label := lipgloss.NewStyle().Bold(true).Foreground(compareColors[i%len(compareColors)])
+	return "\n" + label.Render(fmt.Sprintf("── %s ──", model)) + "\n"
+}
+
+// finishCompare writes the outcome of r after its response and closes out.
+func finishCompare(out io.WriteCloser, r compareResult) {
+	if r.err != nil {
+		fmt.Fprintf(out, "Error: %v\n", r.err)
+	} else {
+		fmt.Fprintf(out, "(%s, %.1fs)\n", r.provider, r.elapsed.Seconds())
+	}
+	out.Close()
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// runCompare runs --compare. The first model to answer streams live and the
+// others are shown, each under its own label, as soon as it finishes.
+func runCompare(config *Config, models []string, prompt, systemPrompt string) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	fmt.Fprintf(console, "Asking %s... (actions are not executed in compare mode)\n", strings.Join(models, ", "))
+	compareModels(ctx, config, models, prompt, systemPrompt, newStreamMux(console))
+}
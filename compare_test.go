@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCompareModels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"<RUN>rm -rf /tmp/x</RUN>\"}}]}\n\ndata: [DONE]\n"))
+	}))
+	defer server.Close()
+
+	config := &Config{
+		APIKeys:          map[string]string{"grok": "key"},
+		BaseURLOverrides: map[string]string{"grok": server.URL},
+	}
+	results := compareModels(context.Background(), config, []string{"grok-3", "no-such-model", "gpt-4o"}, "hi", "", nil)
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+	if r := results[0]; r.err != nil || r.provider != "grok" || r.response != "<RUN>rm -rf /tmp/x</RUN>\n" {
+		t.Errorf("unexpected grok result %+v", r)
+	}
+	if results[1].err == nil {
+		t.Errorf("Expected an error for an unknown model")
+	}
+	if results[2].err == nil {
+		t.Errorf("Expected an error for a provider without an API key")
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// defaultMaxConcurrentActions is how many read-only actions run at once when
+// Config.MaxConcurrentActions is unset.
+const defaultMaxConcurrentActions = 4
+
+// promptMu serializes interactive prompts that read-only actions may show
+// while running concurrently, such as the sensitive-file check.
+var promptMu sync.Mutex
+
+// readOnlyAction reports whether action only inspects the project, so it can
+// run alongside other read-only actions.
+func readOnlyAction(action Action) bool {
+	switch action.(type) {
+	case ReadAction, ReadRawAction, ListFilesAction, SearchFilesAction:
+		return true
+	}
+	return false
+}
+
+// maxConcurrentActions returns Config.MaxConcurrentActions, or the default.
+func maxConcurrentActions(config *Config) int {
+	if config.MaxConcurrentActions <= 0 {
+		return defaultMaxConcurrentActions
+	}
+	return config.MaxConcurrentActions
+}
+
+// runInOrder calls run for indices 0 to n-1. Consecutive indices for which
+// concurrent returns true run in parallel, at most limit at a time; every
+// other index runs alone, after everything before it has finished and before
+// anything after it starts.
+func runInOrder(n int, concurrent func(i int) bool, limit int, run func(i int)) {
+	for i := 0; i < n; {
+		if !concurrent(i) || limit <= 1 {
+			run(i)
+			i++
+			continue
+		}
+		var wg sync.WaitGroup
+		slots := make(chan struct{}, limit)
+		for ; i < n && concurrent(i); i++ {
+			wg.Add(1)
+			slots <- struct{}{}
+			go func(i int) {
+				defer wg.Done()
+				defer func() { <-slots }()
+				run(i)
+			}(i)
+		}
+		wg.Wait()
+	}
+}
+
+// executeAction runs one action, unless its type is disabled, and returns its
+// raw output and result.
+func executeAction(ctx context.Context, item ParsedAction, client AIClient, config *Config) (string, ActionResult) {
+	_, sp := startSpan(ctx, "arisu.action")
+	var output string
+	var err error
+	if kind := actionType(item.Action); actionEnabled(kind) {
+		output, err = item.Action.Execute(client, config, item.IsToolCall)
+	} else {
+		logWarn("Skipped %s: %s actions are disabled.", describeAction(item.Action), kind)
+		output = fmt.Sprintf("Skipped: %s actions are disabled in this session.", kind)
+		err = errSkipped
+	}
+	result := newActionResult(item.Action, output, err)
+	sp.set("arisu.action.type", result.Type)
+	sp.set("arisu.action.target", result.Target)
+	sp.set("arisu.action.status", result.Status)
+	if result.Status != statusError {
+		err = nil
+	}
+	sp.finish(err)
+	return output, result
+}
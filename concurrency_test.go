@@ -0,0 +1,73 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRunInOrderNeverOverlapsMutatingActions(t *testing.T) {
+	// r = read-only, w = mutating.
+	kinds := "rrrwrrwwrrrr"
+	var mu sync.Mutex
+	active, maxReads := 0, 0
+	var started, finished []int
+	runInOrder(len(kinds), func(i int) bool { return kinds[i] == 'r' }, 3, func(i int) {
+		mu.Lock()
+		if kinds[i] == 'w' && active != 0 {
+			t.Errorf("Action %d started while %d others were running", i, active)
+		}
+		for _, j := range started {
+			if j > i && kinds[i] == 'w' {
+				t.Errorf("Action %d started after the later action %d", i, j)
+			}
+		}
+		active++
+		if kinds[i] == 'r' && active > maxReads {
+			maxReads = active
+		}
+		started = append(started, i)
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mu.Lock()
+		active--
+		finished = append(finished, i)
+		mu.Unlock()
+	})
+
+	if len(finished) != len(kinds) {
+		t.Fatalf("Expected %d actions to run, got %d", len(kinds), len(finished))
+	}
+	for pos, i := range finished {
+		if kinds[i] != 'w' {
+			continue
+		}
+		// Everything before a mutating action finishes before it, and
+		// everything after it finishes after it.
+		for _, j := range finished[:pos] {
+			if j > i {
+				t.Errorf("Action %d finished before the mutating action %d", j, i)
+			}
+		}
+		for _, j := range finished[pos+1:] {
+			if j < i {
+				t.Errorf("Action %d finished after the mutating action %d", j, i)
+			}
+		}
+	}
+	if maxReads < 2 || maxReads > 3 {
+		t.Errorf("Expected reads to run concurrently, at most 3 at once, got %d", maxReads)
+	}
+}
+
+func TestRunInOrderSequentialWithLimitOne(t *testing.T) {
+	var order []int
+	runInOrder(4, func(int) bool { return true }, 1, func(i int) { order = append(order, i) })
+	for i, got := range order {
+		if got != i {
+			t.Fatalf("Expected sequential order, got %v", order)
+		}
+	}
+}
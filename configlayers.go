@@ -0,0 +1,268 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// globalConfigFile is the machine-wide config, read before the user's.
+const globalConfigFile = "/etc/arisu/config.json"
+
+// projectConfigFile is a project's config, relative to the working directory
+// or the nearest parent directory that has one.
+var projectConfigFile = filepath.Join(".arisu", "config.json")
+
+// projectConfigFields are the fields a project config may set. A project
+// config is picked up just by working in a cloned repository, so fields that
+// run commands, approve actions, pick files the agent reads and writes, or
+// pick where requests and keys are sent (hooks, templates with {{run:}},
+// auto_run, project_memory, base_url_overrides, ...) are left to the user and
+// global configs. enabled_actions can only be narrowed; see
+// narrowEnabledActions.
+var projectConfigFields = map[string]bool{
+	"selected_model":  true,
+	"tag_names":       true,
+	"enabled_actions": true,
+	"project_hints":   true,
+	"line_endings":    true,
+}
+
+// projectFieldNames returns projectConfigFields sorted, for messages.
+func projectFieldNames() []string {
+	names := make([]string, 0, len(projectConfigFields))
+	for name := range projectConfigFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// configLayer holds the top-level fields of one config file as written.
+type configLayer map[string]json.RawMessage
+
+// userLayer records the user config as loaded and the merged result, so
+// saveConfig writes back only the user's own settings and the ones changed
+// in this run, never fields that came from the global or project config.
+var userLayer struct {
+	file   string
+	fields configLayer
+	merged configLayer
+}
+
+// readConfigLayer reads the config file at path. A missing file is an empty layer.
+func readConfigLayer(path string) (configLayer, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseConfigLayer(path, data)
+}
+
+func parseConfigLayer(path string, data []byte) (configLayer, error) {
+	var layer configLayer
+	if err := json.Unmarshal(data, &layer); err != nil {
+		return nil, fmt.Errorf("%s is not valid JSON: %w", path, err)
+	}
+	return layer, nil
+}
+
+// readUserConfigLayer is readConfigLayer for the user config, except that a
+// file that isn't valid JSON is moved aside, so arisu starts with defaults
+// while the backup keeps the user's API keys for manual recovery.
+func readUserConfigLayer(path string) (configLayer, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	layer, err := parseConfigLayer(path, data)
+	if err == nil {
+		return layer, nil
+	}
+	backup, backupErr := backupConfig(path)
+	if backupErr != nil {
+		return nil, fmt.Errorf("%w (and it could not be backed up: %v)", err, backupErr)
+	}
+	logWarn("Warning: %v. It was moved to %s, which keeps your API keys for manual recovery; starting with the default settings.", err, backup)
+	return nil, nil
+}
+
+// findProjectConfig returns the project config in dir or its nearest parent, or "".
+func findProjectConfig(dir string) string {
+	if dir == "" {
+		return ""
+	}
+	for {
+		path := filepath.Join(dir, projectConfigFile)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// mergeConfigLayers overlays layers in order. Object fields such as api_keys
+// or templates are merged key by key; every other field is replaced.
+func mergeConfigLayers(layers ...configLayer) configLayer {
+	merged := configLayer{}
+	for _, layer := range layers {
+		for key, value := range layer {
+			var base, over map[string]json.RawMessage
+			if json.Unmarshal(merged[key], &base) == nil && base != nil && json.Unmarshal(value, &over) == nil && over != nil {
+				for k, v := range over {
+					base[k] = v
+				}
+				if combined, err := json.Marshal(base); err == nil {
+					value = combined
+				}
+			}
+			merged[key] = value
+		}
+	}
+	return merged
+}
+
+// loadConfigLayered loads the global config, then the user config at
+// userFile, then the project config found from dir, each overriding the
+// ones before. Projects can only set projectConfigFields, so a repository
+// can't ship keys, commands or endpoints. Empty paths skip a layer.
+func loadConfigLayered(globalFile, userFile, dir string) (*Config, error) {
+	global, err := readConfigLayer(globalFile)
+	if err != nil {
+		return nil, err
+	}
+	user, err := readUserConfigLayer(userFile)
+	if err != nil {
+		return nil, err
+	}
+	projectFile := findProjectConfig(dir)
+	project, err := readConfigLayer(projectFile)
+	if err != nil {
+		return nil, err
+	}
+	var ignored []string
+	for key := range project {
+		if !projectConfigFields[key] {
+			ignored = append(ignored, key)
+			delete(project, key)
+		}
+	}
+	if len(ignored) > 0 {
+		sort.Strings(ignored)
+		logWarn("Warning: ignoring %s in %s; projects can only set %s. Put other settings in your user config.", strings.Join(ignored, ", "), projectFile, strings.Join(projectFieldNames(), ", "))
+	}
+	if projectFile != "" {
+		logDebug("Using project config %s", projectFile)
+	}
+
+	inherited := mergeConfigLayers(global, user)
+	narrowEnabledActions(inherited, project, projectFile)
+	merged := mergeConfigLayers(inherited, project)
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return nil, err
+	}
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	if config.APIKeys == nil {
+		config.APIKeys = make(map[string]string)
+	}
+	config.SelectedModel = normalizeModel(config.SelectedModel)
+	userLayer.file, userLayer.fields, userLayer.merged = userFile, user, merged
+	return &config, nil
+}
+
+// narrowEnabledActions limits the project's enabled_actions to the actions
+// the inherited layers enable, so a project can turn actions off but never
+// back on after the global or user config restricted them.
+func narrowEnabledActions(inherited, project configLayer, projectFile string) {
+	raw, ok := project["enabled_actions"]
+	if !ok {
+		return
+	}
+	var allowed, wanted []string
+	if json.Unmarshal(inherited["enabled_actions"], &allowed) != nil || allowed == nil {
+		return
+	}
+	if err := json.Unmarshal(raw, &wanted); err != nil || wanted == nil {
+		logWarn("Warning: ignoring enabled_actions in %s; it must be a list of actions.", projectFile)
+		delete(project, "enabled_actions")
+		return
+	}
+	allowedSet := map[string]bool{}
+	for _, action := range allowed {
+		allowedSet[strings.ToUpper(strings.TrimSpace(action))] = true
+	}
+	narrowed := []string{}
+	var dropped []string
+	for _, action := range wanted {
+		if allowedSet[strings.ToUpper(strings.TrimSpace(action))] {
+			narrowed = append(narrowed, action)
+		} else {
+			dropped = append(dropped, action)
+		}
+	}
+	if len(dropped) > 0 {
+		logWarn("Warning: %s can't enable %s; only actions your config enables can be used.", projectFile, strings.Join(dropped, ", "))
+	}
+	project["enabled_actions"], _ = json.Marshal(narrowed)
+}
+
+// userConfigFields returns the fields saveConfig writes to configFile: the
+// user's own fields, updated with those that config changed since loading.
+func userConfigFields(configFile string, config *Config) (configLayer, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	var current configLayer
+	if err := json.Unmarshal(data, &current); err != nil {
+		return nil, err
+	}
+	if userLayer.file != configFile {
+		return current, nil
+	}
+	fields := configLayer{}
+	for key, value := range userLayer.fields {
+		if _, ok := current[key]; ok {
+			fields[key] = value
+		}
+	}
+	for key, value := range current {
+		if !jsonEqual(value, userLayer.merged[key]) {
+			fields[key] = value
+		}
+	}
+	return fields, nil
+}
+
+// jsonEqual reports whether two JSON values are equal, ignoring formatting.
+func jsonEqual(a, b json.RawMessage) bool {
+	var va, vb interface{}
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(va, vb)
+}
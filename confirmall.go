@@ -0,0 +1,56 @@
+package main
+
+import "fmt"
+
+// needsConfirmation reports whether action would ask before running under
+// config: commands without AutoRun and file changes without AutoEdit, except
+// new files under ConfirmDestructiveOnly.
+func needsConfirmation(action Action, config *Config) bool {
+	switch a := action.(type) {
+	case RunAction:
+		return !config.AutoRun
+	case EditAction:
+		if autoApproved(config, a.Filename) {
+			return false
+		}
+	case MemoryAppendAction:
+		return !config.AutoEdit
+	}
+	return editedFile(action) != "" && !config.AutoEdit
+}
+
+// confirmResponse implements Config.ConfirmPerResponse: it lists a response's
+// actions and asks once whether to apply them all. On yes it returns a copy
+// of config with AutoEdit and AutoRun set, so the actions run in order
+// without further prompts; on no (or when nothing would ask) it returns
+// config unchanged and each action asks as usual. Sensitive-file checks
+// still ask either way.
+func confirmResponse(actions []ParsedAction, config *Config) *Config {
+	if !config.ConfirmPerResponse || promptsDisabled {
+		return config
+	}
+	pending := 0
+	for _, item := range actions {
+		if actionEnabled(actionType(item.Action)) && needsConfirmation(item.Action, config) {
+			pending++
+		}
+	}
+	if pending == 0 {
+		return config
+	}
+	fmt.Fprintf(console, "This response has %d actions:\n", len(actions))
+	for i, item := range actions {
+		prefix := ""
+		if item.IsToolCall {
+			prefix = "[TOOL_CALL] "
+		}
+		fmt.Fprintf(console, "  %d. %s%s\n", i+1, prefix, describeAction(item.Action))
+	}
+	if !confirmAction(fmt.Sprintf("Apply all %d actions in order? (n asks for each)", len(actions)), false) {
+		return config
+	}
+	approved := *config
+	approved.AutoEdit = true
+	approved.AutoRun = true
+	return &approved
+}
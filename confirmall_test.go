@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfirmPerResponseAppliesAllOnYes(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+	response := "<EDIT>\n" + a + "\none\n</EDIT>\n<EDIT>\n" + b + "\ntwo\n</EDIT>\n"
+
+	defer func(s *bufio.Scanner) { stdinScanner = s }(stdinScanner)
+	stdinScanner = bufio.NewScanner(strings.NewReader("y\n"))
+	config := &Config{ConfirmPerResponse: true, UseTrash: new(bool)}
+	_, _, results := handleResponse(t.Context(), response, &scriptedClient{}, config)
+	if len(results) != 2 || results[0].Status != statusApplied || results[1].Status != statusApplied {
+		t.Fatalf("Expected both edits to be applied after one yes, got %+v", results)
+	}
+	if data, _ := os.ReadFile(b); string(data) != "two" {
+		t.Errorf("Expected b.txt to be written, got %q", data)
+	}
+	if config.AutoEdit {
+		t.Error("Expected the approval not to change the session config")
+	}
+}
+
+func TestConfirmPerResponseFallsBackOnNo(t *testing.T) {
+	actions := []ParsedAction{{Action: RunAction{Command: "ls"}}}
+	defer func(s *bufio.Scanner) { stdinScanner = s }(stdinScanner)
+	stdinScanner = bufio.NewScanner(strings.NewReader("n\n"))
+	config := &Config{ConfirmPerResponse: true}
+	if got := confirmResponse(actions, config); got != config {
+		t.Error("Expected per-action prompts after no")
+	}
+
+	// Nothing to confirm: no question is asked.
+	stdinScanner = bufio.NewScanner(strings.NewReader(""))
+	reads := []ParsedAction{{Action: ReadAction{Filename: "main.go"}}}
+	if got := confirmResponse(reads, config); got != config {
+		t.Error("Expected reads to need no confirmation")
+	}
+}
+
+func TestConfirmDestructiveOnly(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	existing, created := filepath.Join(dir, "old.txt"), filepath.Join(dir, "new.txt")
+	if err := os.WriteFile(existing, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// No answers available: anything that asks is declined.
+	defer func(s *bufio.Scanner) { stdinScanner = s }(stdinScanner)
+	stdinScanner = bufio.NewScanner(strings.NewReader(""))
+	config := &Config{ConfirmDestructiveOnly: true, UseTrash: new(bool)}
+
+	if needsConfirmation(EditAction{Filename: created}, config) {
+		t.Error("Expected a new file to need no confirmation")
+	}
+	for _, action := range []Action{EditAction{Filename: existing}, PatchAction{Filename: existing}, RunAction{Command: "ls"}} {
+		if !needsConfirmation(action, config) {
+			t.Errorf("Expected %T to need confirmation", action)
+		}
+	}
+
+	EditAction{Filename: created, Content: "new"}.Execute(&scriptedClient{}, config, false)
+	if data, _ := os.ReadFile(created); string(data) != "new" {
+		t.Errorf("Expected the new file to be created without asking, got %q", data)
+	}
+	EditAction{Filename: existing, Content: "changed"}.Execute(&scriptedClient{}, config, false)
+	if data, _ := os.ReadFile(existing); string(data) != "old" {
+		t.Errorf("Expected the overwrite to be declined, got %q", data)
+	}
+}
+
+func TestConfirmDestructiveOnlyStaysInWorkTree(t *testing.T) {
+	dir, outside := t.TempDir(), t.TempDir()
+	t.Chdir(dir)
+	if err := os.Mkdir(".git", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, "linked"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "target.txt"), "dangling.txt"); err != nil {
+		t.Fatal(err)
+	}
+	config := &Config{ConfirmDestructiveOnly: true}
+
+	for _, name := range []string{"new.txt", filepath.Join("sub", "new.txt"), filepath.Join(dir, "abs.txt")} {
+		if needsConfirmation(EditAction{Filename: name}, config) {
+			t.Errorf("Expected new file %s in the working tree to need no confirmation", name)
+		}
+	}
+	for _, name := range []string{
+		filepath.Join(outside, "new.txt"),
+		filepath.Join("..", "new.txt"),
+		filepath.Join(".git", "hooks", "pre-commit"),
+		filepath.Join("linked", "new.txt"),
+		"dangling.txt",
+	} {
+		if !needsConfirmation(EditAction{Filename: name}, config) {
+			t.Errorf("Expected %s to need confirmation", name)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/pkoukk/tiktoken-go"
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+)
+
+// messageOverheadTokens is what each message costs on top of its content: the
+// role and the delimiters around it.
+const messageOverheadTokens = 4
+
+// contextLimit drops the oldest turns of a client's history so the request
+// fits Config.MaxContextTokens.
+type contextLimit struct {
+	maxTokens int
+	count     func(string) int
+}
+
+// newContextLimit returns the limit for model: OpenAI models are counted with
+// their tokenizer, others with the four-characters-per-token estimate.
+func newContextLimit(maxTokens int, model string) contextLimit {
+	count := estimateTextTokens
+	if encoding := openAIEncoding(model); encoding != "" {
+		count = func(s string) int { return countOpenAITokens(encoding, s) }
+	}
+	return contextLimit{maxTokens: maxTokens, count: count}
+}
+
+// fit returns history trimmed so it and input fit the limit. A leading system
+// prompt is always kept, and turns are dropped whole from the oldest; the
+// last turn is kept even when it alone is over the limit.
+func (l contextLimit) fit(history []Message, input string) []Message {
+	if l.maxTokens <= 0 {
+		return history
+	}
+	var system []Message
+	rest := history
+	if len(history) > 0 && history[0].Role == "system" {
+		system, rest = history[:1], history[1:]
+	}
+	fixed := l.tokens(system) + l.count(input) + messageOverheadTokens
+
+	// suffix[i] is the size of rest[i:].
+	suffix := make([]int, len(rest)+1)
+	for i := len(rest) - 1; i >= 0; i-- {
+		suffix[i] = suffix[i+1] + l.count(rest[i].Content) + messageOverheadTokens
+	}
+	if fixed+suffix[0] <= l.maxTokens {
+		return history
+	}
+	starts := turnStarts(rest)
+	if len(starts) == 0 {
+		return history
+	}
+	cut := starts[len(starts)-1]
+	for _, start := range starts {
+		if fixed+suffix[start] <= l.maxTokens {
+			cut = start
+			break
+		}
+	}
+	if fixed+suffix[cut] > l.maxTokens {
+		logWarn("Warning: the current turn is about %d tokens, over max_context_tokens %d.", fixed+suffix[cut], l.maxTokens)
+	}
+	if cut == 0 {
+		return history
+	}
+	logDebug("Truncating history from %d to %d messages to fit %d tokens", len(history), len(system)+len(rest)-cut, l.maxTokens)
+	return append(append([]Message{}, system...), rest[cut:]...)
+}
+
+// tokens counts messages with l.count, including the per-message overhead.
+func (l contextLimit) tokens(messages []Message) int {
+	total := 0
+	for _, msg := range messages {
+		total += l.count(msg.Content) + messageOverheadTokens
+	}
+	return total
+}
+
+// estimateTextTokens estimates s at four characters per token, like estimateTokens.
+func estimateTextTokens(s string) int {
+	return len(s) / 4
+}
+
+// openAIEncoding returns the tokenizer encoding of an OpenAI model, including
+// OpenAI models reached through OpenRouter, or "" for other models.
+func openAIEncoding(model string) string {
+	model = strings.TrimPrefix(strings.ToLower(model), "openai/")
+	for _, prefix := range []string{"gpt-4o", "gpt-4.1", "gpt-4.5", "gpt-5", "chatgpt-", "codex-", "o1", "o3", "o4"} {
+		if strings.HasPrefix(model, prefix) {
+			return tiktoken.MODEL_O200K_BASE
+		}
+	}
+	for _, prefix := range []string{"gpt-4", "gpt-3.5"} {
+		if strings.HasPrefix(model, prefix) {
+			return tiktoken.MODEL_CL100K_BASE
+		}
+	}
+	return ""
+}
+
+// tokenizers holds the OpenAI encodings loaded so far. They come from the
+// vocabularies embedded in the binary, so counting works offline; a nil entry
+// records an encoding that failed to load.
+var tokenizers struct {
+	sync.Mutex
+	byName map[string]*tiktoken.Tiktoken
+}
+
+// countOpenAITokens counts the tokens of s in encoding, falling back to the
+// estimate if the encoding can't be loaded.
+func countOpenAITokens(encoding, s string) int {
+	tokenizers.Lock()
+	enc, ok := tokenizers.byName[encoding]
+	if !ok {
+		tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
+		var err error
+		if enc, err = tiktoken.GetEncoding(encoding); err != nil {
+			logWarn("Warning: could not load the %s tokenizer (%v); estimating tokens instead.", encoding, err)
+		}
+		if tokenizers.byName == nil {
+			tokenizers.byName = map[string]*tiktoken.Tiktoken{}
+		}
+		tokenizers.byName[encoding] = enc
+	}
+	tokenizers.Unlock()
+	if enc == nil {
+		return estimateTextTokens(s)
+	}
+	return len(enc.EncodeOrdinary(s))
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+func TestContextLimitDropsWholeTurns(t *testing.T) {
+	history := []Message{
+		{Role: "system", Content: strings.Repeat("s", 40)},
+		{Role: "user", Content: strings.Repeat("a", 400)},
+		{Role: "assistant", Content: strings.Repeat("b", 400)},
+		{Role: "user", Content: strings.Repeat("c", 400), ToolOutput: true},
+		{Role: "user", Content: strings.Repeat("d", 40)},
+		{Role: "assistant", Content: strings.Repeat("e", 40)},
+	}
+	limit := newContextLimit(100, "grok-3")
+
+	got := limit.fit(history, "next")
+	if len(got) != 3 || got[0].Role != "system" || got[1].Content != history[4].Content {
+		t.Fatalf("Expected the system prompt and the last turn, got %+v", got)
+	}
+	if all := newContextLimit(10000, "grok-3").fit(history, "next"); len(all) != len(history) {
+		t.Errorf("Expected history under the limit to be kept, got %d messages", len(all))
+	}
+	if off := newContextLimit(0, "grok-3").fit(history, "next"); len(off) != len(history) {
+		t.Errorf("Expected no truncation when the limit is unset, got %d messages", len(off))
+	}
+}
+
+func TestContextLimitKeepsLastTurn(t *testing.T) {
+	history := []Message{
+		{Role: "system", Content: "prompt"},
+		{Role: "user", Content: strings.Repeat("a", 4000)},
+	}
+	got := newContextLimit(10, "grok-3").fit(history, "ok")
+	if len(got) != 2 {
+		t.Errorf("Expected the current turn to be kept, got %+v", got)
+	}
+}
+
+func TestOpenAITokenCounting(t *testing.T) {
+	for model, want := range map[string]string{
+		"gpt-4o":               "o200k_base",
+		"o3-mini":              "o200k_base",
+		"openai/gpt-4.1":       "o200k_base",
+		"gpt-4-turbo":          "cl100k_base",
+		"gpt-3.5-turbo":        "cl100k_base",
+		"grok-3":               "",
+		"anthropic/claude-3.5": "",
+		"gemini-2.5-pro":       "",
+	} {
+		if got := openAIEncoding(model); got != want {
+			t.Errorf("openAIEncoding(%q) = %q, want %q", model, got, want)
+		}
+	}
+
+	// Counts from OpenAI's tiktoken.
+	for _, tc := range []struct {
+		encoding, text string
+		want           int
+	}{
+		{"cl100k_base", "tiktoken is great!", 6},
+		{"cl100k_base", "hello world", 2},
+		{"o200k_base", "hello world", 2},
+		{"cl100k_base", "", 0},
+	} {
+		if got := countOpenAITokens(tc.encoding, tc.text); got != tc.want {
+			t.Errorf("countOpenAITokens(%s, %q) = %d, want %d", tc.encoding, tc.text, got, tc.want)
+		}
+	}
+}
+
+func TestGeminiContextCountsSystemInstruction(t *testing.T) {
+	c := &Client{cs: &genai.ChatSession{}, systemPrompt: strings.Repeat("s", 400), context: newContextLimit(120, "gemini-2.5-pro")}
+	c.SetHistory([]Message{
+		{Role: "user", Content: "first"},
+		{Role: "assistant", Content: "reply"},
+		{Role: "user", Content: "second"},
+		{Role: "assistant", Content: "reply"},
+	})
+	// The history alone fits in 120 tokens; with the ~100-token system instruction it doesn't.
+	c.fitContext("next")
+	if got := c.GetHistory(); len(got) != 2 || got[0].Content != "second" {
+		t.Errorf("Expected only the last turn to be kept, got %+v", got)
+	}
+}
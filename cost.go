@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// modelPrice is a model's price in USD per million input and output tokens.
+type modelPrice struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+}
+
+// defaultModelPrices are list prices used to estimate spend. Config.ModelPrices
+// overrides them and adds models missing here.
+var defaultModelPrices = map[string]modelPrice{
+	"gpt-5":                {1.25, 10},
+	"gpt-5-mini":           {0.25, 2},
+	"gpt-4.1":              {2, 8},
+	"gpt-4.1-mini":         {0.4, 1.6},
+	"gpt-4o":               {2.5, 10},
+	"gpt-4o-mini":          {0.15, 0.6},
+	"o3":                   {2, 8},
+	"gpt-3.5-turbo":        {0.5, 1.5},
+	"gemini":               {0.1, 0.4},
+	"gemini-2.0-flash":     {0.1, 0.4},
+	"gemini-2.5-flash":     {0.3, 2.5},
+	"gemini-2.5-pro":       {1.25, 10},
+	"gemini-3-pro-preview": {2, 12},
+	"grok-2-latest":        {2, 10},
+}
+
+// tokenUsage is the token count a provider reports for one response.
+type tokenUsage struct {
+	Prompt     int `json:"prompt_tokens"`
+	Completion int `json:"completion_tokens"`
+}
+
+// usageReporter is implemented by clients that can report the token usage of
+// the last response. The zero value means none was reported.
+type usageReporter interface {
+	Usage() tokenUsage
+}
+
+// chunkUsage extracts the "usage" object OpenAI-compatible APIs put in the
+// last stream chunk when stream_options.include_usage is set.
+func chunkUsage(chunk map[string]interface{}) (tokenUsage, bool) {
+	usage, ok := chunk["usage"].(map[string]interface{})
+	if !ok {
+		return tokenUsage{}, false
+	}
+	prompt, _ := usage["prompt_tokens"].(float64)
+	completion, _ := usage["completion_tokens"].(float64)
+	return tokenUsage{Prompt: int(prompt), Completion: int(completion)}, true
+}
+
+// costWarnFraction is the share of Config.MaxSessionCostUSD at which a
+// warning is printed.
+const costWarnFraction = 0.8
+
+// costLimitedClient estimates the cost of every request from its size and
+// refuses to send more once the session's estimated spend reaches the limit.
+type costLimitedClient struct {
+	AIClient
+	price  modelPrice
+	limit  float64
+	spent  float64
+	warned bool
+}
+
+// newCostLimitedClient returns client unchanged unless Config.MaxSessionCostUSD
+// is set. Without a known price for the model the limit can't be enforced.
+func newCostLimitedClient(client AIClient, config *Config) AIClient {
+	if config.MaxSessionCostUSD <= 0 {
+		return client
+	}
+	price, ok := priceFor(config)
+	if !ok {
+		logWarn("Warning: no price known for %s, so max_session_cost_usd can't be enforced; add it to model_prices.", config.SelectedModel)
+		return client
+	}
+	return &costLimitedClient{AIClient: client, price: price, limit: config.MaxSessionCostUSD}
+}
+
+// priceFor returns the price of the selected model, from Config.ModelPrices
+// or the built-in list.
+func priceFor(config *Config) (modelPrice, bool) {
+	if price, ok := config.ModelPrices[config.SelectedModel]; ok {
+		return price, true
+	}
+	price, ok := defaultModelPrices[config.SelectedModel]
+	return price, ok
+}
+
+// costLimiter returns the costLimitedClient among client's wrappers, or nil.
+func costLimiter(client AIClient) *costLimitedClient {
+	for {
+		switch c := client.(type) {
+		case *costLimitedClient:
+			return c
+		case *throttledClient:
+			client = c.AIClient
+		case *tracedClient:
+			client = c.AIClient
+		case *cachedClient:
+			client = c.AIClient
+		default:
+			return nil
+		}
+	}
+}
+
+// carrySpend starts limiter, if any, at the given spend.
+func (c *costLimitedClient) carrySpend(spent float64) {
+	c.spent = spent
+	c.warned = spent >= c.limit*costWarnFraction
+}
+
+// cost returns the cost in USD of a response with the given usage.
+func (p modelPrice) cost(usage tokenUsage) float64 {
+	return (float64(usage.Prompt)*p.Input + float64(usage.Completion)*p.Output) / 1e6
+}
+
+// estimateCost estimates the cost in USD of a request whose history and
+// input total inChars characters and whose response has outChars.
+func (p modelPrice) estimateCost(inChars, outChars int) float64 {
+	return (float64(inChars)/4*p.Input + float64(outChars)/4*p.Output) / 1e6
+}
+
+// SendMessage refuses to send once the limit is reached, and otherwise adds
+// the request's cost to the session's spend: from the usage the provider
+// reported when it did, estimated from the message sizes otherwise.
+func (c *costLimitedClient) SendMessage(ctx context.Context, input string) (string, error) {
+	if c.spent >= c.limit {
+		return "", fmt.Errorf("session cost limit reached: about $%.2f spent of $%.2f; raise max_session_cost_usd or start a new session", c.spent, c.limit)
+	}
+	inChars := len(input)
+	for _, msg := range c.AIClient.GetHistory() {
+		inChars += len(msg.Content)
+	}
+	response, err := c.AIClient.SendMessage(ctx, input)
+	if r, ok := unwrapClient(c.AIClient).(usageReporter); ok && r.Usage() != (tokenUsage{}) {
+		c.spent += c.price.cost(r.Usage())
+	} else {
+		c.spent += c.price.estimateCost(inChars, len(response))
+	}
+	logDebug("Estimated session cost: $%.4f of $%.2f", c.spent, c.limit)
+	if !c.warned && c.spent >= c.limit*costWarnFraction && c.spent < c.limit {
+		c.warned = true
+		logWarn("Warning: this session has spent about $%.2f, %.0f%% of max_session_cost_usd ($%.2f).", c.spent, c.spent/c.limit*100, c.limit)
+	}
+	return response, err
+}
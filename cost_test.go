@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCostLimitedClientStopsAtLimit(t *testing.T) {
+	config := &Config{
+		SelectedModel:     "cheap",
+		MaxSessionCostUSD: 1,
+		ModelPrices:       map[string]modelPrice{"cheap": {Input: 0, Output: 1e6}},
+	}
+	// Each 3-character reply costs $0.75 at $1 per output token.
+	inner := &scriptedClient{replies: []string{"abc", "abc", "abc"}}
+	client := newCostLimitedClient(inner, config)
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.SendMessage(context.Background(), "hi"); err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+	}
+	_, err := client.SendMessage(context.Background(), "hi")
+	if err == nil || !strings.Contains(err.Error(), "session cost limit reached") {
+		t.Fatalf("Expected the limit to stop the third request, got %v", err)
+	}
+	if len(inner.sent) != 2 {
+		t.Errorf("Expected 2 requests to be sent, got %d", len(inner.sent))
+	}
+}
+
+func TestNewCostLimitedClientNeedsLimitAndPrice(t *testing.T) {
+	inner := &scriptedClient{}
+	if client := newCostLimitedClient(inner, &Config{SelectedModel: "gpt-4o"}); client != AIClient(inner) {
+		t.Error("Expected no wrapper without a limit")
+	}
+	if client := newCostLimitedClient(inner, &Config{SelectedModel: "unknown", MaxSessionCostUSD: 1}); client != AIClient(inner) {
+		t.Error("Expected no wrapper for a model without a price")
+	}
+	if _, ok := newCostLimitedClient(inner, &Config{SelectedModel: "gpt-4o", MaxSessionCostUSD: 1}).(*costLimitedClient); !ok {
+		t.Error("Expected a wrapper for a priced model")
+	}
+}
+
+func TestStreamUsageIsRequestedAndParsed(t *testing.T) {
+	var got map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"hi\"}}]}\n\n" +
+			"data: {\"choices\":[],\"usage\":{\"prompt_tokens\":12,\"completion_tokens\":3}}\n\ndata: [DONE]\n"))
+	}))
+	defer server.Close()
+
+	config := &Config{MaxSessionCostUSD: 1, BaseURLOverrides: map[string]string{"grok": server.URL}}
+	client := NewGrokClient("key", "grok-3", newClientOptions(config, "grok", ""))
+	client.SetOutput(io.Discard)
+	if _, err := client.SendMessage(context.Background(), "hello"); err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	if options, _ := got["stream_options"].(map[string]interface{}); options["include_usage"] != true {
+		t.Errorf("Expected stream_options.include_usage, got %v", got["stream_options"])
+	}
+	if usage := client.Usage(); usage != (tokenUsage{Prompt: 12, Completion: 3}) {
+		t.Errorf("Usage = %+v", usage)
+	}
+
+	config.MaxSessionCostUSD = 0
+	got = nil
+	client = NewGrokClient("key", "grok-3", newClientOptions(config, "grok", ""))
+	client.SetOutput(io.Discard)
+	client.SendMessage(context.Background(), "hello")
+	if _, ok := got["stream_options"]; ok {
+		t.Error("Expected no stream_options without the cost cap")
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// DiffAction applies a unified diff to a single file.
+type DiffAction struct {
+	Filename string
+	Diff     string
+}
+
+// diffHunk is one @@ section of a unified diff.
+type diffHunk struct {
+	header   string
+	oldStart int // 1-based line number from the header
+	oldLines []string
+	newLines []string
+}
+
+var hunkHeaderPattern = regexp.MustCompile(`^@@ -(\d+)(?:,\d+)? \+\d+(?:,\d+)? @@`)
+
+// parseHunks splits a unified diff into hunks. File headers (---/+++) and
+// "\ No newline at end of file" markers are ignored. Blank lines inside a hunk
+// are treated as empty context lines, since models often drop the leading space.
+func parseHunks(diff string) ([]diffHunk, error) {
+	var hunks []diffHunk
+	var current *diffHunk
+	for _, line := range strings.Split(diff, "\n") {
+		if m := hunkHeaderPattern.FindStringSubmatch(line); m != nil {
+			start, _ := strconv.Atoi(m[1])
+			hunks = append(hunks, diffHunk{header: line, oldStart: start})
+			current = &hunks[len(hunks)-1]
+			continue
+		}
+		if current == nil {
+			if strings.HasPrefix(line, "---") || strings.HasPrefix(line, "+++") || strings.TrimSpace(line) == "" {
+				continue
+			}
+			return nil, fmt.Errorf("diff content before the first @@ hunk header: %q", line)
+		}
+		switch {
+		case strings.HasPrefix(line, `\`):
+		case line == "":
+			current.oldLines = append(current.oldLines, "")
+			current.newLines = append(current.newLines, "")
+		case line[0] == ' ':
+			current.oldLines = append(current.oldLines, line[1:])
+			current.newLines = append(current.newLines, line[1:])
+		case line[0] == '-':
+			current.oldLines = append(current.oldLines, line[1:])
+		case line[0] == '+':
+			current.newLines = append(current.newLines, line[1:])
+		default:
+			return nil, fmt.Errorf("invalid line in hunk %s: %q", current.header, line)
+		}
+	}
+	// Trailing blank lines are an artifact of the tag layout, not context.
+	for i := range hunks {
+		h := &hunks[i]
+		for len(h.oldLines) > 0 && len(h.newLines) > 0 && h.oldLines[len(h.oldLines)-1] == "" && h.newLines[len(h.newLines)-1] == "" {
+			h.oldLines = h.oldLines[:len(h.oldLines)-1]
+			h.newLines = h.newLines[:len(h.newLines)-1]
+		}
+	}
+	if len(hunks) == 0 {
+		return nil, fmt.Errorf("no hunks found")
+	}
+	return hunks, nil
+}
+
+// matchAt reports whether want matches lines starting at pos, comparing
+// trimmed lines when loose is set.
+func matchAt(lines, want []string, pos int, loose bool) bool {
+	if pos < 0 || pos+len(want) > len(lines) {
+		return false
+	}
+	for i, w := range want {
+		l := lines[pos+i]
+		if loose {
+			l, w = strings.TrimSpace(l), strings.TrimSpace(w)
+		}
+		if l != w {
+			return false
+		}
+	}
+	return true
+}
+
+// findHunk searches for want nearest to the expected position, first exactly
+// and then ignoring surrounding whitespace. It returns -1 when there is no match.
+func findHunk(lines, want []string, expected int) int {
+	for _, loose := range []bool{false, true} {
+		for delta := 0; delta <= len(lines); delta++ {
+			if matchAt(lines, want, expected-delta, loose) {
+				return expected - delta
+			}
+			if delta > 0 && matchAt(lines, want, expected+delta, loose) {
+				return expected + delta
+			}
+		}
+	}
+	return -1
+}
+
+// applyHunks applies hunks to content like GNU patch: each hunk is located near
+// its stated line (adjusted by earlier hunks), falling back to whitespace-insensitive
+// matching and then to dropping up to two lines of outer context (fuzz).
+// Hunks that cannot be placed are returned as rejected and leave the content untouched.
+func applyHunks(content string, hunks []diffHunk) (string, []diffHunk) {
+	trailingNewline := strings.HasSuffix(content, "\n")
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	if content == "" {
+		lines = nil
+	}
+
+	var rejected []diffHunk
+	offset := 0
+	for _, h := range hunks {
+		applied := false
+		for fuzz := 0; fuzz <= 2 && !applied; fuzz++ {
+			oldLines, newLines, ok := trimContext(h, fuzz)
+			if !ok {
+				break
+			}
+			expected := h.oldStart - 1 + offset + fuzz
+			if len(h.oldLines) == 0 {
+				// Pure insertion: the header line is where the new lines go.
+				expected = h.oldStart + offset
+			}
+			pos := expected
+			if len(oldLines) > 0 {
+				pos = findHunk(lines, oldLines, expected)
+			}
+			if pos < 0 || pos > len(lines) {
+				continue
+			}
+			updated := append([]string{}, lines[:pos]...)
+			updated = append(updated, newLines...)
+			lines = append(updated, lines[pos+len(oldLines):]...)
+			offset += len(newLines) - len(oldLines) + (pos - expected)
+			applied = true
+		}
+		if !applied {
+			rejected = append(rejected, h)
+		}
+	}
+
+	result := strings.Join(lines, "\n")
+	if trailingNewline || (content == "" && len(lines) > 0) {
+		result += "\n"
+	}
+	return result, rejected
+}
+
+// trimContext drops up to fuzz unchanged lines from both ends of a hunk.
+func trimContext(h diffHunk, fuzz int) ([]string, []string, bool) {
+	oldLines, newLines := h.oldLines, h.newLines
+	for i := 0; i < fuzz; i++ {
+		if len(oldLines) < 2 || len(newLines) < 2 || oldLines[0] != newLines[0] || oldLines[len(oldLines)-1] != newLines[len(newLines)-1] {
+			return nil, nil, false
+		}
+		oldLines, newLines = oldLines[1:len(oldLines)-1], newLines[1:len(newLines)-1]
+	}
+	return oldLines, newLines, true
+}
+
+func (d DiffAction) Execute(client AIClient, config *Config, isToolCall bool) (string, error) {
+	if config.AutoEdit || confirmFileAction(fmt.Sprintf("Apply diff to %s?", d.Filename), d.Filename, confirmDefault(config, false)) {
+		hunks, err := parseHunks(d.Diff)
+		if err != nil {
+			logError("Error parsing diff for %s: %v", d.Filename, err)
+			return fmt.Sprintf("Error parsing diff for %s: %v", d.Filename, err), err
+		}
+		content, crlf, err := readTextFile(d.Filename)
+		if err != nil && !os.IsNotExist(err) {
+			logError("Error reading %s: %v", d.Filename, err)
+			return fmt.Sprintf("Error reading %s: %v", d.Filename, err), err
+		}
+
+		newContent, rejected := applyHunks(content, hunks)
+		if len(rejected) == len(hunks) {
+			fmt.Fprintf(console, "Diff on %s rejected: no hunk matched.\n", d.Filename)
+			return fmt.Sprintf("Error: none of the %d hunks matched %s. Read the file again and resend the diff.", len(hunks), d.Filename), fmt.Errorf("all hunks rejected")
+		}
+		if err := writeTextFile(d.Filename, newContent, crlf, config); err != nil {
+			logError("Error writing %s: %v", d.Filename, err)
+			return fmt.Sprintf("Error writing %s: %v", d.Filename, err), err
+		}
+		if len(rejected) > 0 {
+			var sb strings.Builder
+			sb.WriteString(fmt.Sprintf("Applied %d of %d hunks to %s. Rejected hunks:\n", len(hunks)-len(rejected), len(hunks), d.Filename))
+			for _, h := range rejected {
+				sb.WriteString(h.header)
+				sb.WriteString("\n")
+			}
+			fmt.Fprint(console, sb.String())
+			return sb.String(), fmt.Errorf("%d hunks rejected", len(rejected))
+		}
+		fmt.Fprintf(console, "Diff applied to %s successfully.\n", d.Filename)
+		return fmt.Sprintf("Diff applied to %s successfully (%d hunks).", d.Filename, len(hunks)), nil
+	} else {
+		fmt.Fprintf(console, "Diff on %s skipped.\n", d.Filename)
+		return fmt.Sprintf("Diff on %s skipped.", d.Filename), errSkipped
+	}
+}
+
+// maxPreviewLines caps how many removed and added lines changePreview shows each.
+const maxPreviewLines = 40
+
+var (
+	previewRemoved = lipgloss.NewStyle().Foreground(lipgloss.Color("1"))
+	previewAdded   = lipgloss.NewStyle().Foreground(lipgloss.Color("2"))
+)
+
+// changePreview renders the lines that differ between before and after as
+// numbered "-" (removed) and "+" (added) lines, for confirmation prompts.
+func changePreview(before, after string) string {
+	oldLines := strings.Split(before, "\n")
+	newLines := strings.Split(after, "\n")
+	prefix := 0
+	for prefix < len(oldLines) && prefix < len(newLines) && oldLines[prefix] == newLines[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(oldLines)-prefix && suffix < len(newLines)-prefix &&
+		oldLines[len(oldLines)-1-suffix] == newLines[len(newLines)-1-suffix] {
+		suffix++
+	}
+	removed := oldLines[prefix : len(oldLines)-suffix]
+	added := newLines[prefix : len(newLines)-suffix]
+
+	var sb strings.Builder
+	section := func(lines []string, sign string, style lipgloss.Style) {
+		for i, line := range lines {
+			if i == maxPreviewLines {
+				fmt.Fprintf(&sb, "      %s ... %d more lines\n", sign, len(lines)-i)
+				break
+			}
+			sb.WriteString(style.Render(fmt.Sprintf("%5d %s %s", prefix+i+1, sign, line)))
+			sb.WriteString("\n")
+		}
+	}
+	section(removed, "-", previewRemoved)
+	section(added, "+", previewAdded)
+	return sb.String()
+}
@@ -0,0 +1,46 @@
+package main
+
+import "testing"
+
+func TestApplyHunks(t *testing.T) {
+	content := "a\nb\nc\nd\ne\n"
+	hunks, err := parseHunks("@@ -2,3 +2,3 @@\n b\n-c\n+C\n d\n")
+	if err != nil {
+		t.Fatalf("parseHunks failed: %v", err)
+	}
+
+	result, rejected := applyHunks(content, hunks)
+	if len(rejected) != 0 {
+		t.Errorf("Expected no rejected hunks, got %d", len(rejected))
+	}
+	if expected := "a\nb\nC\nd\ne\n"; result != expected {
+		t.Errorf("Expected %q, got %q", expected, result)
+	}
+}
+
+func TestApplyHunksWithDriftAndRejects(t *testing.T) {
+	// The file gained two lines at the top since the diff was made.
+	content := "x\ny\na\nb\nc\n"
+	hunks, err := parseHunks("--- a/f\n+++ b/f\n@@ -1,2 +1,2 @@\n a\n-b\n+B\n@@ -9,1 +9,1 @@\n-missing\n+gone\n")
+	if err != nil {
+		t.Fatalf("parseHunks failed: %v", err)
+	}
+
+	result, rejected := applyHunks(content, hunks)
+	if len(rejected) != 1 || rejected[0].header != "@@ -9,1 +9,1 @@" {
+		t.Errorf("Expected the second hunk to be rejected, got %#v", rejected)
+	}
+	if expected := "x\ny\na\nB\nc\n"; result != expected {
+		t.Errorf("Expected %q, got %q", expected, result)
+	}
+}
+
+func TestChangePreview(t *testing.T) {
+	before := "package main\n\nfunc a() {}\nfunc b() {}\n"
+	after := "package main\n\nfunc a() { return }\nfunc b() {}\n"
+	got := stripANSI(changePreview(before, after))
+	want := "    3 - func a() {}\n    3 + func a() { return }\n"
+	if got != want {
+		t.Errorf("changePreview = %q, want %q", got, want)
+	}
+}
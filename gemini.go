@@ -2,7 +2,9 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"strings"
 
 	"github.com/google/generative-ai-go/genai"
@@ -12,59 +14,142 @@ import (
 
 // Client represents a client for interacting with the Gemini API.
 type Client struct {
-	cs         *genai.ChatSession
-	maxHistory int
+	client        *genai.Client
+	cs            *genai.ChatSession
+	maxHistory    int
+	context       contextLimit
+	systemPrompt  string
+	reasoningTags []string
+	out           io.Writer
+	truncated     bool
+	usage         tokenUsage
+	// separateUserTurns inserts placeholder model turns between consecutive
+	// user messages instead of merging them.
+	separateUserTurns bool
+	showStats         bool
+	// toolOutputs records which history entries hold tool output, which
+	// genai.Content has no room for.
+	toolOutputs map[*genai.Content]bool
 }
 
-// NewClient initializes a new Gemini client with the provided API key.
-func NewClient(apiKey, modelName string, maxHistory int) *Client {
+// NewClient initializes a new Gemini client with the provided API key and options.
+func NewClient(apiKey, modelName string, opts clientOptions) *Client {
 	ctx := context.Background()
-	genaiClient, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
+	clientOpts := []option.ClientOption{option.WithAPIKey(apiKey)}
+	if opts.baseURL != "" {
+		clientOpts = append(clientOpts, option.WithEndpoint(opts.baseURL))
+	}
+	genaiClient, err := genai.NewClient(ctx, clientOpts...)
 	if err != nil {
 		panic(err)
 	}
 	model := genaiClient.GenerativeModel(modelName)
-	model.SystemInstruction = genai.NewUserContent(genai.Text(defaultSystemPrompt()))
+	model.SystemInstruction = genai.NewUserContent(genai.Text(opts.systemPrompt))
+	if opts.responseSchema != nil {
+		model.ResponseMIMEType = "application/json"
+		model.ResponseSchema = geminiSchema(opts.responseSchema)
+	}
 	cs := model.StartChat()
 
-	return &Client{cs: cs, maxHistory: maxHistory}
+	return &Client{client: genaiClient, cs: cs, maxHistory: historyLimit(opts.maxHistory), context: newContextLimit(opts.maxContextTokens, modelName), systemPrompt: opts.systemPrompt, reasoningTags: opts.reasoningTags, separateUserTurns: opts.separateUserTurns, showStats: opts.showStats, out: console}
 }
 
 // SendMessage sends a message to the Gemini API and streams the response.
-func (c *Client) SendMessage(input string) (string, error) {
+func (c *Client) SendMessage(ctx context.Context, input string) (string, error) {
 	// Truncate history if needed
 	// Gemini history is []*genai.Content
 	if len(c.cs.History) > c.maxHistory {
 		// Keep the last maxHistory messages
 		// Note: Gemini ChatSession history does NOT include system instruction (it's separate)
+		logDebug("Truncating history from %d to %d messages", len(c.cs.History), c.maxHistory)
 		c.cs.History = c.cs.History[len(c.cs.History)-c.maxHistory:]
 	}
+	c.fitContext(input)
 
-	ctx := context.Background()
+	if n := len(c.cs.History); c.separateUserTurns && n > 0 && c.cs.History[n-1].Role == "user" {
+		c.addPlaceholderTurn()
+	}
+
+	logDebug("Gemini request: %d history messages, input: %s", len(c.cs.History), redactSecrets(input))
+	stats := startStreamStats()
 	iter := c.cs.SendMessageStream(ctx, genai.Text(input))
 	var fullResponse strings.Builder
+	c.truncated = false
+	c.usage = tokenUsage{}
 
 	for {
 		resp, err := iter.Next()
 		if err == iterator.Done {
 			break
 		}
+		var blocked *genai.BlockedError
+		if errors.As(err, &blocked) {
+			fmt.Fprint(c.out, "\n")
+			c.dropPendingInput()
+			return "", fmt.Errorf("Gemini blocked the response: %s", blockReason(blocked))
+		}
 		if err != nil {
 			return "", err
 		}
+		if resp.UsageMetadata != nil {
+			c.usage = tokenUsage{Prompt: int(resp.UsageMetadata.PromptTokenCount), Completion: int(resp.UsageMetadata.CandidatesTokenCount)}
+		}
 		for _, cand := range resp.Candidates {
+			if cand.FinishReason == genai.FinishReasonMaxTokens {
+				c.truncated = true
+			}
+			if cand.FinishReason == genai.FinishReasonOther {
+				logWarn("Gemini stopped the response early (finish reason OTHER).")
+			}
 			if cand.Content != nil {
 				for _, part := range cand.Content.Parts {
 					if text, ok := part.(genai.Text); ok {
-						fmt.Print(string(text))
+						fmt.Fprint(c.out, string(text))
+						stats.add(string(text))
 						fullResponse.WriteString(string(text))
 					}
 				}
 			}
 		}
 	}
-	fmt.Print("\n")
-	return fullResponse.String() + "\n", nil
+	fmt.Fprint(c.out, "\n")
+	stats.report(c.showStats)
+	responseText := fullResponse.String()
+	if responseText == "" {
+		c.dropPendingInput()
+		return "", fmt.Errorf("Gemini returned an empty response with no candidates")
+	}
+	if len(c.reasoningTags) > 0 {
+		responseText = stripReasoning(responseText, c.reasoningTags)
+		// The chat session recorded the raw reply; keep only the stripped text.
+		if n := len(c.cs.History); n > 0 && c.cs.History[n-1].Role == "model" {
+			c.cs.History[n-1].Parts = []genai.Part{genai.Text(responseText)}
+		}
+	}
+	return responseText + "\n", nil
+}
+
+// dropPendingInput removes the user turn SendMessageStream added when no
+// model turn followed it, so the next request still alternates roles.
+func (c *Client) dropPendingInput() {
+	if n := len(c.cs.History); n > 0 && c.cs.History[n-1].Role == "user" {
+		c.cs.History = c.cs.History[:n-1]
+	}
+}
+
+// blockReason names why Gemini blocked a prompt or response, e.g. "SAFETY".
+func blockReason(err *genai.BlockedError) string {
+	var reasons []string
+	if err.PromptFeedback != nil {
+		reasons = append(reasons, "prompt "+strings.ToUpper(strings.TrimPrefix(err.PromptFeedback.BlockReason.String(), "BlockReason")))
+	}
+	if err.Candidate != nil {
+		reasons = append(reasons, strings.ToUpper(strings.TrimPrefix(err.Candidate.FinishReason.String(), "FinishReason")))
+	}
+	if len(reasons) == 0 {
+		return "unknown reason"
+	}
+	return strings.Join(reasons, ", ")
 }
 
 // AddMessage adds a message to the conversation history.
@@ -81,7 +166,9 @@ func (c *Client) AddMessage(role, content string) {
 	historyLen := len(c.cs.History)
 	if historyLen > 0 {
 		lastMessage := c.cs.History[historyLen-1]
-		if lastMessage.Role == "user" && genaiRole == "user" {
+		if lastMessage.Role == "user" && genaiRole == "user" && c.separateUserTurns {
+			c.addPlaceholderTurn()
+		} else if lastMessage.Role == "user" && genaiRole == "user" {
 			// Merge with previous user message
 			var newParts []genai.Part
 			newParts = append(newParts, lastMessage.Parts...)
@@ -97,18 +184,88 @@ func (c *Client) AddMessage(role, content string) {
 	})
 }
 
+// geminiPlaceholderTurn is the model turn inserted between consecutive user
+// messages when they are kept separate.
+const geminiPlaceholderTurn = "(continuing)"
+
+// addPlaceholderTurn appends a minimal model turn so the next user message
+// can stay a separate entry while roles still alternate.
+func (c *Client) addPlaceholderTurn() {
+	c.cs.History = append(c.cs.History, &genai.Content{
+		Parts: []genai.Part{genai.Text(geminiPlaceholderTurn)},
+		Role:  "model",
+	})
+}
+
 // GetHistory returns the conversation history as a slice of Messages.
+// Gemini's "model" role is reported as the canonical "assistant", and
+// placeholder turns are left out.
 func (c *Client) GetHistory() []Message {
 	var history []Message
 	for _, msg := range c.cs.History {
+		if c.separateUserTurns && msg.Role == "model" && len(msg.Parts) == 1 && msg.Parts[0] == genai.Text(geminiPlaceholderTurn) {
+			continue
+		}
 		role := msg.Role
+		if role == "model" {
+			role = "assistant"
+		}
 		content := ""
 		for _, part := range msg.Parts {
 			if text, ok := part.(genai.Text); ok {
 				content += string(text)
 			}
 		}
-		history = append(history, Message{Role: role, Content: content})
+		history = append(history, Message{Role: role, Content: content, ToolOutput: c.toolOutputs[msg]})
 	}
 	return history
 }
+
+// fitContext drops the oldest turns so the request fits Config.MaxContextTokens.
+// The system instruction is sent separately, so it is counted as the first
+// message of the history.
+func (c *Client) fitContext(input string) {
+	if c.context.maxTokens <= 0 {
+		return
+	}
+	history := append([]Message{{Role: "system", Content: c.systemPrompt}}, c.GetHistory()...)
+	if fitted := c.context.fit(history, input); len(fitted) < len(history) {
+		c.SetHistory(fitted[1:])
+	}
+}
+
+// SetOutput sets where the streamed response is written.
+func (c *Client) SetOutput(w io.Writer) {
+	c.out = w
+}
+
+// SetHistory replaces the conversation with messages using canonical roles.
+// They are re-added through AddMessage so roles map to Gemini's names and
+// consecutive user messages are merged to keep the required alternation.
+func (c *Client) SetHistory(messages []Message) {
+	c.cs.History = nil
+	c.toolOutputs = map[*genai.Content]bool{}
+	for _, msg := range messages {
+		n := len(c.cs.History)
+		c.AddMessage(msg.Role, msg.Content)
+		// A message merged into the previous entry keeps that entry's flag.
+		if msg.ToolOutput && len(c.cs.History) > n {
+			c.toolOutputs[c.cs.History[len(c.cs.History)-1]] = true
+		}
+	}
+}
+
+// Close closes the underlying Gemini client.
+func (c *Client) Close() error {
+	return c.client.Close()
+}
+
+// Truncated reports whether the last response stopped at the output token limit.
+func (c *Client) Truncated() bool {
+	return c.truncated
+}
+
+// Usage returns the token usage Gemini reported for the last response.
+func (c *Client) Usage() tokenUsage {
+	return c.usage
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+func TestBlockReason(t *testing.T) {
+	err := &genai.BlockedError{Candidate: &genai.Candidate{FinishReason: genai.FinishReasonSafety}}
+	if got := blockReason(err); got != "SAFETY" {
+		t.Errorf("blockReason = %q, expected SAFETY", got)
+	}
+	err = &genai.BlockedError{PromptFeedback: &genai.PromptFeedback{BlockReason: genai.BlockReasonOther}}
+	if got := blockReason(err); got != "prompt OTHER" {
+		t.Errorf("blockReason = %q, expected prompt OTHER", got)
+	}
+}
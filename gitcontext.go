@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// maxGitStatusLines caps how many changed files the git context lists.
+const maxGitStatusLines = 50
+
+// gitContext returns the branch and `git status --porcelain` of the
+// repository at dir, or "" when dir is not in a git repository.
+func gitContext(dir string) string {
+	cmd := exec.Command("git", "status", "--porcelain", "--branch")
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	lines := strings.Split(strings.TrimRight(string(output), "\n"), "\n")
+	branch := strings.TrimPrefix(lines[0], "## ")
+	files := lines[1:]
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Git branch: %s\n", branch)
+	if len(files) == 0 {
+		sb.WriteString("Working tree clean.\n")
+		return sb.String()
+	}
+	sb.WriteString("Uncommitted changes (git status --porcelain):\n")
+	for i, line := range files {
+		if i == maxGitStatusLines {
+			fmt.Fprintf(&sb, "... and %d more\n", len(files)-i)
+			break
+		}
+		sb.WriteString(line)
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// requestGitContext returns the current git branch and status when
+// Config.IncludeGitContext is set. It is computed for every request, so the
+// model sees changes made since the conversation started, including its own.
+func requestGitContext(config *Config) string {
+	if !config.IncludeGitContext {
+		return ""
+	}
+	status := gitContext(".")
+	if status == "" {
+		return ""
+	}
+	return status + "\n"
+}
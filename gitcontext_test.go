@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGitContext(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	if gitContext(dir) != "" {
+		t.Fatalf("Expected no git context outside a repository")
+	}
+	if err := exec.Command("git", "init", "-q", "-b", "feature", dir).Run(); err != nil {
+		t.Skipf("git init failed: %v", err)
+	}
+	os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0644)
+
+	got := gitContext(dir)
+	if !strings.Contains(got, "Git branch: ") || !strings.Contains(got, "feature") || !strings.Contains(got, "?? main.go") {
+		t.Errorf("Unexpected git context %q", got)
+	}
+}
+
+func TestGitContextIsNotKeptInHistory(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	if err := exec.Command("git", "init", "-q", "-b", "feature", dir).Run(); err != nil {
+		t.Skipf("git init failed: %v", err)
+	}
+	t.Chdir(dir)
+
+	client := &scriptedClient{replies: []string{"one", "two"}}
+	s := &session{client: client, config: &Config{IncludeGitContext: true}}
+	for _, msg := range []Message{{Role: "user", Content: "first"}, {Role: "user", Content: "output", ToolOutput: true}} {
+		if _, err := s.send(t.Context(), msg); err != nil {
+			t.Fatalf("send failed: %v", err)
+		}
+	}
+
+	for i, sent := range client.sent {
+		if strings.Count(sent, "Git branch: ") != 1 {
+			t.Errorf("Expected request %d to carry the git status once, got %q", i, sent)
+		}
+	}
+	for _, msg := range client.history {
+		if strings.Contains(msg.Content, "Git branch: ") {
+			t.Errorf("Expected the git status to stay out of the history, got %q", msg.Content)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -12,24 +13,43 @@ import (
 
 // GrokClient represents a client for interacting with the Grok API.
 type GrokClient struct {
-	apiKey     string
-	model      string
-	history    []Message
-	maxHistory int
+	apiKey        string
+	model         string
+	history       []Message
+	maxHistory    int
+	context       contextLimit
+	reasoningTags []string
+	out           io.Writer
+	truncated     bool
+	showStats     bool
+	extraBody     map[string]interface{}
+	limits        rateLimiter
+	endpoint      string
+	includeUsage  bool
+	usage         tokenUsage
 }
 
-// NewGrokClient initializes a new Grok client with the provided API key and model.
-func NewGrokClient(apiKey, model string, maxHistory int) *GrokClient {
-	history := []Message{{Role: "system", Content: defaultSystemPrompt()}}
-	return &GrokClient{apiKey: apiKey, model: model, history: history, maxHistory: maxHistory}
+// grokEndpoint is the xAI chat completions URL.
+const grokEndpoint = "https://api.x.ai/v1/chat/completions"
+
+// NewGrokClient initializes a new Grok client with the provided API key, model and options.
+func NewGrokClient(apiKey, model string, opts clientOptions) *GrokClient {
+	history := []Message{{Role: "system", Content: opts.systemPrompt}}
+	return &GrokClient{apiKey: apiKey, model: model, history: history, maxHistory: historyLimit(opts.maxHistory), context: newContextLimit(opts.maxContextTokens, model), reasoningTags: opts.reasoningTags, extraBody: opts.extraBody, endpoint: chatCompletionsURL(opts.baseURL, grokEndpoint), showStats: opts.showStats, includeUsage: opts.includeUsage, out: console}
 }
 
 // SendMessage sends a message to the Grok API and streams the response.
-func (c *GrokClient) SendMessage(input string) (string, error) {
+func (c *GrokClient) SendMessage(ctx context.Context, input string) (string, error) {
 	// Truncate history if needed, keeping system prompt
 	if len(c.history) > c.maxHistory {
+		logDebug("Truncating history from %d to %d messages", len(c.history), c.maxHistory)
 		c.history = append([]Message{c.history[0]}, c.history[len(c.history)-(c.maxHistory-1):]...)
 	}
+	c.history = c.context.fit(c.history, input)
+
+	if err := c.limits.wait(ctx); err != nil {
+		return "", err
+	}
 
 	c.history = append(c.history, Message{Role: "user", Content: input})
 
@@ -43,24 +63,31 @@ func (c *GrokClient) SendMessage(input string) (string, error) {
 		"stream":      true,
 		"temperature": 0,
 	}
+	if c.includeUsage {
+		payload["stream_options"] = map[string]interface{}{"include_usage": true}
+	}
+	mergeExtraBody(payload, c.extraBody)
 	jsonPayload, err := json.Marshal(payload)
 	if err != nil {
 		return "", err
 	}
 
-	req, err := http.NewRequest("POST", "https://api.x.ai/v1/chat/completions", bytes.NewBuffer(jsonPayload))
+	logDebug("POST %s payload: %s", c.endpoint, redactSecrets(string(jsonPayload)))
+	req, err := http.NewRequestWithContext(ctx, "POST", c.endpoint, bytes.NewBuffer(jsonPayload))
 	if err != nil {
 		return "", err
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+c.apiKey)
 
+	stats := startStreamStats()
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
 		return "", err
 	}
 	defer resp.Body.Close()
+	c.limits.update(resp)
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
@@ -69,6 +96,9 @@ func (c *GrokClient) SendMessage(input string) (string, error) {
 
 	reader := bufio.NewReader(resp.Body)
 	var fullResponse strings.Builder
+	c.truncated = false
+	c.usage = tokenUsage{}
+	var citations []string
 	for {
 		line, err := reader.ReadString('\n')
 		if err == io.EOF {
@@ -87,11 +117,19 @@ func (c *GrokClient) SendMessage(input string) (string, error) {
 			if err := json.Unmarshal([]byte(data), &chunk); err != nil {
 				continue
 			}
+			if usage, ok := chunkUsage(chunk); ok {
+				c.usage = usage
+			}
+			citations = append(citations, chunkCitations(chunk)...)
 			if choices, ok := chunk["choices"].([]interface{}); ok && len(choices) > 0 {
 				if choice, ok := choices[0].(map[string]interface{}); ok {
+					if reason, ok := choice["finish_reason"].(string); ok && reason == "length" {
+						c.truncated = true
+					}
 					if delta, ok := choice["delta"].(map[string]interface{}); ok {
 						if content, ok := delta["content"].(string); ok {
-							fmt.Print(content)
+							fmt.Fprint(c.out, content)
+							stats.add(content)
 							fullResponse.WriteString(content)
 						}
 					}
@@ -101,8 +139,10 @@ func (c *GrokClient) SendMessage(input string) (string, error) {
 	}
 
 	// Add a newline at the end of the response
-	fmt.Print("\n")
-	responseText := fullResponse.String() + "\n"
+	fmt.Fprint(c.out, "\n")
+	fmt.Fprint(c.out, formatCitations(citations))
+	stats.report(c.showStats)
+	responseText := stripReasoning(fullResponse.String(), c.reasoningTags) + "\n"
 	c.history = append(c.history, Message{Role: "assistant", Content: responseText})
 	return responseText, nil
 }
@@ -116,3 +156,33 @@ func (c *GrokClient) AddMessage(role, content string) {
 func (c *GrokClient) GetHistory() []Message {
 	return c.history
 }
+
+// SetOutput sets where the streamed response is written.
+func (c *GrokClient) SetOutput(w io.Writer) {
+	c.out = w
+}
+
+// SetHistory replaces the conversation, keeping the system prompt.
+func (c *GrokClient) SetHistory(messages []Message) {
+	c.history = append(c.history[:1:1], messages...)
+}
+
+// Close is a no-op; the client holds no resources between requests.
+func (c *GrokClient) Close() error {
+	return nil
+}
+
+// Truncated reports whether the last response ended with finish_reason "length".
+func (c *GrokClient) Truncated() bool {
+	return c.truncated
+}
+
+// RateLimit returns the rate-limit state from the last response.
+func (c *GrokClient) RateLimit() rateLimitState {
+	return c.limits.state
+}
+
+// Usage returns the token usage reported for the last response, if any.
+func (c *GrokClient) Usage() tokenUsage {
+	return c.usage
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// withGrounding adds the fields that turn on provider-side web search when
+// Config.EnableGrounding is set: OpenAI's web_search_options (search models
+// only), Grok's Live Search and OpenRouter's web plugin. The Gemini SDK arisu
+// uses has no search tool, so Gemini runs without it and says so.
+func withGrounding(extra map[string]interface{}, config *Config, provider string) map[string]interface{} {
+	if !config.EnableGrounding {
+		return extra
+	}
+	var fields map[string]interface{}
+	switch provider {
+	case "openai":
+		if !strings.Contains(config.SelectedModel, "search") {
+			logWarn("Warning: OpenAI web search needs a search model such as gpt-4o-search-preview; enable_grounding is ignored for %s.", config.SelectedModel)
+			return extra
+		}
+		fields = map[string]interface{}{"web_search_options": map[string]interface{}{}}
+	case "grok":
+		fields = map[string]interface{}{"search_parameters": map[string]interface{}{"mode": "auto", "return_citations": true}}
+	case "openrouter":
+		fields = map[string]interface{}{"plugins": []interface{}{map[string]interface{}{"id": "web"}}}
+	case "gemini":
+		logWarn("Warning: enable_grounding is not supported for gemini; responses will not be grounded in web search or cite sources.")
+		return extra
+	default:
+		logWarn("Warning: enable_grounding is not supported for %s and is ignored.", provider)
+		return extra
+	}
+	if extra == nil {
+		extra = map[string]interface{}{}
+	}
+	mergeExtraBody(extra, fields)
+	return extra
+}
+
+// chunkCitations returns the source URLs in a streamed chunk: Grok's
+// top-level "citations" and the url_citation annotations OpenAI and
+// OpenRouter put in the delta.
+func chunkCitations(chunk map[string]interface{}) []string {
+	var urls []string
+	for _, citation := range asSlice(chunk["citations"]) {
+		if url, ok := citation.(string); ok {
+			urls = append(urls, url)
+		}
+	}
+	for _, choice := range asSlice(chunk["choices"]) {
+		choice, _ := choice.(map[string]interface{})
+		delta, _ := choice["delta"].(map[string]interface{})
+		for _, annotation := range asSlice(delta["annotations"]) {
+			annotation, _ := annotation.(map[string]interface{})
+			citation, _ := annotation["url_citation"].(map[string]interface{})
+			if url, ok := citation["url"].(string); ok {
+				urls = append(urls, url)
+			}
+		}
+	}
+	return urls
+}
+
+// formatCitations lists the distinct source URLs of a response, or returns
+// "" if there are none.
+func formatCitations(urls []string) string {
+	seen := map[string]bool{}
+	var sb strings.Builder
+	for _, url := range urls {
+		if seen[url] {
+			continue
+		}
+		seen[url] = true
+		if sb.Len() == 0 {
+			sb.WriteString("Sources:\n")
+		}
+		sb.WriteString(fmt.Sprintf("  [%d] %s\n", len(seen), url))
+	}
+	return sb.String()
+}
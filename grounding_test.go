@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestWithGrounding(t *testing.T) {
+	config := &Config{EnableGrounding: true, SelectedModel: "grok-3"}
+	if extra := newClientOptions(config, "grok", "").extraBody; extra["search_parameters"] == nil {
+		t.Errorf("Expected Live Search for grok, got %v", extra)
+	}
+	if extra := newClientOptions(config, "openrouter", "").extraBody; extra["plugins"] == nil {
+		t.Errorf("Expected the web plugin for openrouter, got %v", extra)
+	}
+	config.SelectedModel = "gpt-4o-search-preview"
+	if extra := newClientOptions(config, "openai", "").extraBody; extra["web_search_options"] == nil {
+		t.Errorf("Expected web_search_options for a search model, got %v", extra)
+	}
+	config.SelectedModel = "gpt-4o"
+	if extra := newClientOptions(config, "openai", "").extraBody; extra["web_search_options"] != nil {
+		t.Errorf("Expected no web search for a model without it, got %v", extra)
+	}
+}
+
+func TestGrokCitationsAreListed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"Go 1.24 is out.\"}}]}\n\n" +
+			"data: {\"choices\":[{\"delta\":{\"annotations\":[{\"type\":\"url_citation\",\"url_citation\":{\"url\":\"https://go.dev/blog\"}}]}}]}\n\n" +
+			"data: {\"choices\":[],\"citations\":[\"https://go.dev/doc\",\"https://go.dev/blog\"]}\n\ndata: [DONE]\n"))
+	}))
+	defer server.Close()
+
+	config := &Config{EnableGrounding: true, BaseURLOverrides: map[string]string{"grok": server.URL}}
+	client := NewGrokClient("key", "grok-3", newClientOptions(config, "grok", ""))
+	var out bytes.Buffer
+	client.SetOutput(&out)
+	response, err := client.SendMessage(context.Background(), "news?")
+	if err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	want := "Sources:\n  [1] https://go.dev/blog\n  [2] https://go.dev/doc\n"
+	if !strings.HasSuffix(out.String(), want) {
+		t.Errorf("Expected the sources after the response, got %q", out.String())
+	}
+	if strings.Contains(response, "Sources:") {
+		t.Errorf("Expected the sources to stay out of the history, got %q", response)
+	}
+}
+
+func TestOpenAICitationsAreListed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"Go 1.24 is out.\"}}]}\n\n" +
+			"data: {\"choices\":[{\"delta\":{\"annotations\":[{\"type\":\"url_citation\",\"url_citation\":{\"url\":\"https://go.dev/blog\"}}]}}]}\n\n" +
+			"data: {\"choices\":[{\"delta\":{\"annotations\":[{\"type\":\"url_citation\",\"url_citation\":{\"url\":\"https://go.dev/blog\"}}]},\"finish_reason\":\"stop\"}]}\n\ndata: [DONE]\n"))
+	}))
+	defer server.Close()
+
+	config := &Config{EnableGrounding: true, SelectedModel: "gpt-4o-search-preview", BaseURLOverrides: map[string]string{"openai": server.URL}}
+	client := NewOpenAIClient("key", "gpt-4o-search-preview", newClientOptions(config, "openai", ""))
+	var out bytes.Buffer
+	client.SetOutput(&out)
+	response, err := client.SendMessage(context.Background(), "news?")
+	if err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	if want := "Go 1.24 is out.\nSources:\n  [1] https://go.dev/blog\n"; out.String() != want {
+		t.Errorf("Expected the sources after the response, got %q", out.String())
+	}
+	if response != "Go 1.24 is out.\n" {
+		t.Errorf("Expected the sources to stay out of the history, got %q", response)
+	}
+}
+
+func TestGroundingWarnsForGemini(t *testing.T) {
+	var logs bytes.Buffer
+	console = &logs
+	defer func() { console = os.Stdout }()
+	config := &Config{EnableGrounding: true, SelectedModel: "gemini-2.0-flash"}
+	newClientOptions(config, "gemini", "")
+	if !strings.Contains(logs.String(), "enable_grounding is not supported for gemini") {
+		t.Errorf("Expected a warning that Gemini runs ungrounded, got %q", logs.String())
+	}
+}
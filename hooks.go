@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// changedFiles returns the files that results applied changes to, in order, without duplicates.
+func changedFiles(results []ActionResult) []string {
+	var files []string
+	seen := map[string]bool{}
+	for _, r := range results {
+		if r.Status == statusApplied && r.file != "" && !seen[r.file] {
+			seen[r.file] = true
+			files = append(files, r.file)
+		}
+	}
+	return files
+}
+
+// runHook runs a Config.PreTurnHook or PostTurnHook command in bash with the
+// terminal attached. ARISU_CHANGED_FILES lists the files the turn changed, one
+// per line (empty before the turn). A failing hook only prints a warning.
+func runHook(ctx context.Context, name, command string, changed []string) {
+	if command == "" {
+		return
+	}
+	cmd := exec.CommandContext(ctx, "bash", "-c", command)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, console, os.Stderr
+	cmd.Env = append(os.Environ(), "ARISU_HOOK="+name, "ARISU_CHANGED_FILES="+strings.Join(changed, "\n"))
+	logDebug("Running %s-turn hook: %s", name, command)
+	if err := cmd.Run(); err != nil {
+		logWarn("Warning: %s-turn hook failed: %v", name, err)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunHookChangedFiles(t *testing.T) {
+	results := []ActionResult{
+		newActionResult(EditAction{Filename: "a.go"}, "", nil),
+		newActionResult(PatchAction{Filename: "a.go", ID: 1}, "", nil),
+		newActionResult(ReplaceAction{Filename: "b.go"}, "", errSkipped),
+		newActionResult(RunAction{Command: "ls"}, "", nil),
+		newActionResult(DiffAction{Filename: "c.go"}, "", nil),
+		newActionResult(MemoryAppendAction{Note: "Run make first."}, "", nil),
+	}
+	out := filepath.Join(t.TempDir(), "hook.txt")
+	runHook(context.Background(), "post", `printf '%s:%s' "$ARISU_HOOK" "$ARISU_CHANGED_FILES" > `+out, changedFiles(results))
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("hook did not run: %v", err)
+	}
+	if expected := "post:a.go\nc.go"; string(got) != expected {
+		t.Errorf("hook saw %q, expected %q", got, expected)
+	}
+
+	// A failing hook only warns.
+	runHook(context.Background(), "pre", "exit 3", nil)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// findInlineCommand returns the bounds of the first !(command) in input at or
+// after start, with parentheses inside the command balanced, e.g.
+// !(echo $(date)). ok is false if there is none.
+func findInlineCommand(input string, start int) (begin, end int, ok bool) {
+	i := strings.Index(input[start:], "!(")
+	if i < 0 {
+		return 0, 0, false
+	}
+	begin = start + i
+	depth := 0
+	for j := begin + 1; j < len(input); j++ {
+		switch input[j] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return begin, j + 1, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// expandCommands replaces each !(command) in input with the command's
+// output, like shell command substitution, when Config.AllowInlineCommands
+// is set. Each command is confirmed unless AutoRun is on; a declined or
+// failed-to-start command is left as typed. Only stdout is captured, so
+// add 2>&1 for errors.
+func expandCommands(input string, config *Config) string {
+	if _, _, ok := findInlineCommand(input, 0); !ok {
+		return input
+	}
+	if !config.AllowInlineCommands {
+		logInfo("Note: !(command) is only expanded with \"allow_inline_commands\": true; sending it as typed.")
+		return input
+	}
+	var sb strings.Builder
+	pos := 0
+	for {
+		begin, end, ok := findInlineCommand(input, pos)
+		if !ok {
+			break
+		}
+		command := input[begin+2 : end-1]
+		sb.WriteString(input[pos:begin])
+		if output, ok := runInlineCommand(command, config); ok {
+			sb.WriteString(output)
+		} else {
+			sb.WriteString(input[begin:end])
+		}
+		pos = end
+	}
+	sb.WriteString(input[pos:])
+	return sb.String()
+}
+
+// runInlineCommand runs command for expandCommands and returns its output
+// block. A non-zero exit still returns the output, noting the status.
+func runInlineCommand(command string, config *Config) (string, bool) {
+	if !config.AutoRun && !confirmAction(fmt.Sprintf("Run %s and inline its output?", command), false) {
+		return "", false
+	}
+	var stdout bytes.Buffer
+	// Like RUN: credentials are scrubbed and allow_network is honored.
+	cmd := shellCommand(config, command)
+	cmd.Env = runEnv(config)
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	status := ""
+	if exitErr, isExit := err.(*exec.ExitError); isExit {
+		status = fmt.Sprintf(" exit_status=\"%d\"", exitErr.ExitCode())
+	} else if err != nil {
+		logError("Error running %s: %v", command, err)
+		return "", false
+	}
+	output := truncateOutput(stdout.String(), outputLimit(config, "RUN"))
+	return fmt.Sprintf("\n<COMMAND_OUTPUT command=%q%s>\n%s\n</COMMAND_OUTPUT>\n", command, status, strings.TrimRight(output, "\n")), true
+}
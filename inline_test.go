@@ -0,0 +1,38 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpandCommands(t *testing.T) {
+	config := &Config{AllowInlineCommands: true, AutoRun: true}
+	got := expandCommands("explain: !(echo $(echo nested)) and !(echo out; exit 3)", config)
+	if !strings.Contains(got, "<COMMAND_OUTPUT command=\"echo $(echo nested)\">\nnested\n</COMMAND_OUTPUT>") {
+		t.Errorf("Expected the nested command's output, got %q", got)
+	}
+	if !strings.Contains(got, "exit_status=\"3\">\nout\n") {
+		t.Errorf("Expected the output and exit status of the failing command, got %q", got)
+	}
+	if !strings.HasPrefix(got, "explain: \n<COMMAND_OUTPUT") {
+		t.Errorf("Expected the surrounding text to be kept, got %q", got)
+	}
+}
+
+func TestExpandCommandsNeedsOptIn(t *testing.T) {
+	input := "what does !(rm -rf build) do?"
+	if got := expandCommands(input, &Config{AutoRun: true}); got != input {
+		t.Errorf("Expected no expansion without allow_inline_commands, got %q", got)
+	}
+	if got := expandCommands("unbalanced !(echo hi", &Config{AllowInlineCommands: true, AutoRun: true}); got != "unbalanced !(echo hi" {
+		t.Errorf("Expected an unbalanced command to be left alone, got %q", got)
+	}
+}
+
+func TestExpandCommandsScrubsCredentials(t *testing.T) {
+	t.Setenv("ARISU_OPENAI_API_KEY", "sk-secret")
+	got := expandCommands("!(echo key=$ARISU_OPENAI_API_KEY)", &Config{AllowInlineCommands: true, AutoRun: true})
+	if strings.Contains(got, "sk-secret") || !strings.Contains(got, "key=\n") {
+		t.Errorf("Expected the API key to be scrubbed from the command's environment, got %q", got)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// maxInputHistory caps how many REPL inputs are remembered.
+const maxInputHistory = 500
+
+// inputHistoryFile is where REPL inputs are remembered across runs; main sets
+// it to ~/.config/arisu/input_history.json. Empty disables persistence.
+var inputHistoryFile string
+
+// loadInputHistory returns the remembered inputs, oldest first.
+func loadInputHistory(path string) []string {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var entries []string
+	if err := json.Unmarshal(data, &entries); err != nil {
+		logDebug("Ignoring invalid input history %s: %v", path, err)
+		return nil
+	}
+	return entries
+}
+
+// addInputHistory appends input, dropping an earlier copy of it and the
+// oldest entries beyond maxInputHistory, and saves the result to path.
+func addInputHistory(path string, entries []string, input string) []string {
+	kept := make([]string, 0, len(entries)+1)
+	for _, entry := range entries {
+		if entry != input {
+			kept = append(kept, entry)
+		}
+	}
+	kept = append(kept, input)
+	if len(kept) > maxInputHistory {
+		kept = kept[len(kept)-maxInputHistory:]
+	}
+	if path != "" {
+		if err := saveInputHistory(path, kept); err != nil {
+			logWarn("Warning: could not save input history: %v", err)
+		}
+	}
+	return kept
+}
+
+func saveInputHistory(path string, entries []string) error {
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
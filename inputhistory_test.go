@@ -0,0 +1,55 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func TestAddInputHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "input_history.json")
+	var entries []string
+	for _, input := range []string{"one", "two", "one"} {
+		entries = addInputHistory(path, entries, input)
+	}
+	want := []string{"two", "one"}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("Expected deduplicated history %q, got %q", want, entries)
+	}
+	if loaded := loadInputHistory(path); !reflect.DeepEqual(loaded, want) {
+		t.Errorf("Expected saved history %q, got %q", want, loaded)
+	}
+
+	for i := 0; i < maxInputHistory+10; i++ {
+		entries = addInputHistory("", entries, string(rune('a'+i%26))+string(rune(i)))
+	}
+	if len(entries) != maxInputHistory {
+		t.Errorf("Expected history capped at %d, got %d", maxInputHistory, len(entries))
+	}
+}
+
+func TestREPLHistoryNavigation(t *testing.T) {
+	m := initialModel(&Config{}, []string{"first", "second"})
+	m.textarea.SetValue("draft")
+	press := func(key tea.KeyType) {
+		updated, _ := m.Update(tea.KeyMsg{Type: key})
+		m = updated.(model)
+	}
+
+	press(tea.KeyUp)
+	if got := m.textarea.Value(); got != "second" {
+		t.Fatalf("Expected the latest input, got %q", got)
+	}
+	press(tea.KeyUp)
+	press(tea.KeyUp)
+	if got := m.textarea.Value(); got != "first" {
+		t.Fatalf("Expected to stop at the oldest input, got %q", got)
+	}
+	press(tea.KeyDown)
+	press(tea.KeyDown)
+	if got := m.textarea.Value(); got != "draft" {
+		t.Errorf("Expected the draft back, got %q", got)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// escKey is the byte the Esc key sends.
+const escKey = 0x1b
+
+// typeAhead holds the keys escPressed read from the terminal besides a lone
+// Esc. Prompts read them before stdin, and the REPL starts with their text.
+var typeAhead []byte
+
+// escSequenceLen returns the length of the key at the start of b, which
+// begins with Esc: 1 for a lone Esc, longer for the sequences that arrow,
+// function and Alt keys send.
+func escSequenceLen(b []byte) int {
+	if len(b) < 2 || b[1] == escKey {
+		return 1
+	}
+	switch b[1] {
+	case '[':
+		for i := 2; i < len(b); i++ {
+			if b[i] >= 0x40 && b[i] <= 0x7e {
+				return i + 1
+			}
+		}
+		return len(b)
+	case 'O':
+		return min(3, len(b))
+	}
+	return 2
+}
+
+// splitTypeAhead reports whether keys, read from a terminal in raw mode,
+// contain a lone Esc, and returns the other keys with Enter as a newline.
+func splitTypeAhead(keys []byte) (bool, []byte) {
+	pressed := false
+	var rest []byte
+	for i := 0; i < len(keys); {
+		switch keys[i] {
+		case escKey:
+			n := escSequenceLen(keys[i:])
+			if n == 1 {
+				pressed = true
+			} else {
+				rest = append(rest, keys[i:i+n]...)
+			}
+			i += n
+		case '\r':
+			rest = append(rest, '\n')
+			i++
+		default:
+			rest = append(rest, keys[i])
+			i++
+		}
+	}
+	return pressed, rest
+}
+
+// typeAheadReader reads the keys saved in typeAhead before r.
+type typeAheadReader struct {
+	r io.Reader
+}
+
+func (t typeAheadReader) Read(p []byte) (int, error) {
+	if len(typeAhead) > 0 {
+		n := copy(p, typeAhead)
+		typeAhead = typeAhead[n:]
+		return n, nil
+	}
+	return t.r.Read(p)
+}
+
+// takeTypeAhead returns the text typed ahead and clears it. Escape sequences
+// and other control keys are dropped.
+func takeTypeAhead() string {
+	var b strings.Builder
+	for i := 0; i < len(typeAhead); {
+		if typeAhead[i] == escKey {
+			i += escSequenceLen(typeAhead[i:])
+			continue
+		}
+		b.WriteByte(typeAhead[i])
+		i++
+	}
+	typeAhead = nil
+	return strings.Map(func(r rune) rune {
+		if r == '\n' || unicode.IsPrint(r) {
+			return r
+		}
+		return -1
+	}, b.String())
+}
+
+// pauseChoice is what the user chose after pausing a tool-call loop.
+type pauseChoice int
+
+const (
+	pauseContinue pauseChoice = iota
+	pauseStop
+	pauseInstruct
+)
+
+// parsePauseAnswer interprets the answer to the pause prompt: empty or "c"
+// continues, "s" stops, and anything else is a new instruction for the model.
+func parsePauseAnswer(answer string) (pauseChoice, string) {
+	answer = strings.TrimSpace(answer)
+	switch strings.ToLower(answer) {
+	case "", "c":
+		return pauseContinue, ""
+	case "s":
+		return pauseStop, ""
+	}
+	return pauseInstruct, answer
+}
+
+// checkPause reports whether the user pressed Esc since the last check and,
+// if so, asks what to do with the running tool-call loop. It never blocks
+// when no key was pressed, and never pauses when there is no one to ask.
+func checkPause() (pauseChoice, string) {
+	if promptsDisabled || !escPressed() {
+		return pauseContinue, ""
+	}
+	fmt.Fprint(console, "\nPaused. Enter to continue, s to stop, or type new instructions: ")
+	if !stdinScanner.Scan() {
+		return pauseStop, ""
+	}
+	return parsePauseAnswer(stdinScanner.Text())
+}
+
+// withInstruction adds the user's instruction to the tool output sent back
+// to the model after a pause.
+func withInstruction(output, instruction string) string {
+	return output + "\n\nThe user paused the task and added these instructions, which take priority:\n" + instruction
+}
@@ -0,0 +1,9 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package main
+
+// escPressed always reports false; polling the keyboard without blocking is
+// only supported on Unix terminals.
+func escPressed() bool {
+	return false
+}
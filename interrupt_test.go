@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestParsePauseAnswer(t *testing.T) {
+	tests := []struct {
+		answer      string
+		choice      pauseChoice
+		instruction string
+	}{
+		{"", pauseContinue, ""},
+		{" C ", pauseContinue, ""},
+		{"s", pauseStop, ""},
+		{"use the v2 API instead", pauseInstruct, "use the v2 API instead"},
+	}
+	for _, tt := range tests {
+		choice, instruction := parsePauseAnswer(tt.answer)
+		if choice != tt.choice || instruction != tt.instruction {
+			t.Errorf("parsePauseAnswer(%q) = %v, %q; want %v, %q", tt.answer, choice, instruction, tt.choice, tt.instruction)
+		}
+	}
+}
+
+func TestSplitTypeAhead(t *testing.T) {
+	tests := []struct {
+		keys    string
+		pressed bool
+		rest    string
+	}{
+		{"\x1b", true, ""},
+		{"ab\x1b", true, "ab"},
+		{"\x1b\x1b", true, ""},
+		{"\x1b[A\x1b[1;5C", false, "\x1b[A\x1b[1;5C"},
+		{"\x1bOP", false, "\x1bOP"},
+		{"\x1bf", false, "\x1bf"},
+		{"fix it\r\x1b", true, "fix it\n"},
+	}
+	for _, tt := range tests {
+		pressed, rest := splitTypeAhead([]byte(tt.keys))
+		if pressed != tt.pressed || string(rest) != tt.rest {
+			t.Errorf("splitTypeAhead(%q) = %v, %q; want %v, %q", tt.keys, pressed, rest, tt.pressed, tt.rest)
+		}
+	}
+}
+
+func TestTypeAheadIsNotLost(t *testing.T) {
+	defer func() { typeAhead = nil }()
+	typeAhead = []byte("use v2\n")
+	scanner := bufio.NewScanner(typeAheadReader{strings.NewReader("then stop\n")})
+	for _, want := range []string{"use v2", "then stop"} {
+		if !scanner.Scan() || scanner.Text() != want {
+			t.Errorf("Scan = %q, want %q", scanner.Text(), want)
+		}
+	}
+
+	typeAhead = []byte("next\x1b[D \x07question")
+	if got := takeTypeAhead(); got != "next question" {
+		t.Errorf("takeTypeAhead = %q, want the text without control keys", got)
+	}
+	if typeAhead != nil {
+		t.Errorf("Expected takeTypeAhead to clear the keys, left %q", typeAhead)
+	}
+}
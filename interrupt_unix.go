@@ -0,0 +1,38 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package main
+
+import (
+	"os"
+
+	"github.com/charmbracelet/x/term"
+	"golang.org/x/sys/unix"
+)
+
+// escPressed reports whether a lone Esc is among the keys typed ahead on the
+// terminal. The other keys, including the sequences arrow keys send, are kept
+// in typeAhead for the next prompt. The terminal is put in raw mode for the
+// check so keys are seen without waiting for Enter.
+func escPressed() bool {
+	fd := os.Stdin.Fd()
+	if !term.IsTerminal(fd) {
+		return false
+	}
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return false
+	}
+	defer term.Restore(fd, state)
+	if err := unix.SetNonblock(int(fd), true); err != nil {
+		return false
+	}
+	defer unix.SetNonblock(int(fd), false)
+	buf := make([]byte, 256)
+	n, err := unix.Read(int(fd), buf)
+	if err != nil || n <= 0 {
+		return false
+	}
+	pressed, rest := splitTypeAhead(buf[:n])
+	typeAhead = append(typeAhead, rest...)
+	return pressed
+}
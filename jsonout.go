@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// jsonResult is the single object printed by --json. Usage is left out when
+// the provider reported none, and the cost when the model's price is unknown.
+type jsonResult struct {
+	Response string         `json:"response"`
+	Actions  []ActionResult `json:"actions"`
+	Usage    *tokenUsage    `json:"usage,omitempty"`
+	CostUSD  *float64       `json:"cost_usd,omitempty"`
+	Error    string         `json:"error,omitempty"`
+}
+
+// jsonOutput collects the --json result; it is nil in every other mode.
+var jsonOutput *jsonResult
+
+// currentSession is the running session, used to report the final response.
+var currentSession *session
+
+// recordAction adds result to the --json output.
+func recordAction(result ActionResult) {
+	if jsonOutput != nil {
+		jsonOutput.Actions = append(jsonOutput.Actions, result)
+	}
+}
+
+// recordUsage adds the token usage client reported for its last response to
+// the --json output. Responses served from the cache used no tokens.
+func recordUsage(client AIClient) {
+	if jsonOutput == nil {
+		return
+	}
+	if cached, ok := client.(*cachedClient); ok && cached.hit {
+		return
+	}
+	r, ok := unwrapClient(client).(usageReporter)
+	if !ok || r.Usage() == (tokenUsage{}) {
+		return
+	}
+	if jsonOutput.Usage == nil {
+		jsonOutput.Usage = &tokenUsage{}
+	}
+	jsonOutput.Usage.Prompt += r.Usage().Prompt
+	jsonOutput.Usage.Completion += r.Usage().Completion
+}
+
+// writeJSONResult prints the collected result. If the run failed before a
+// session started, the last logged error is reported.
+func writeJSONResult(w io.Writer) {
+	result := jsonOutput
+	if currentSession != nil {
+		result.Response = lastAssistantResponse(currentSession.client.GetHistory())
+		if price, ok := priceFor(currentSession.config); ok && result.Usage != nil {
+			cost := price.cost(*result.Usage)
+			result.CostUSD = &cost
+		}
+	} else if result.Error == "" {
+		result.Error = lastError
+	}
+	if result.Actions == nil {
+		result.Actions = []ActionResult{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(result)
+}
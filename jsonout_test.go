@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+// usageClient is a scriptedClient that reports a fixed usage per response.
+type usageClient struct {
+	scriptedClient
+	usage tokenUsage
+}
+
+func (c *usageClient) Usage() tokenUsage { return c.usage }
+
+func TestJSONResultReportsUsageAndCost(t *testing.T) {
+	jsonOutput = &jsonResult{}
+	defer func() { jsonOutput, currentSession = nil, nil }()
+	client := &usageClient{scriptedClient: scriptedClient{replies: []string{"first\n", "second\n"}}, usage: tokenUsage{Prompt: 1000, Completion: 100}}
+	config := &Config{SelectedModel: "gpt-4o"}
+	s := &session{client: client, config: config}
+	currentSession = s
+	for _, input := range []string{"one", "two"} {
+		if _, err := s.send(context.Background(), Message{Role: "user", Content: input}); err != nil {
+			t.Fatalf("send failed: %v", err)
+		}
+	}
+
+	var out bytes.Buffer
+	writeJSONResult(&out)
+	var result jsonResult
+	if err := json.Unmarshal(out.Bytes(), &result); err != nil {
+		t.Fatalf("invalid JSON %q: %v", out.String(), err)
+	}
+	if result.Usage == nil || *result.Usage != (tokenUsage{Prompt: 2000, Completion: 200}) {
+		t.Fatalf("usage = %+v, want both responses summed", result.Usage)
+	}
+	// gpt-4o is $2.50 in and $10 out per million tokens.
+	if result.CostUSD == nil || *result.CostUSD != 0.007 {
+		t.Errorf("cost_usd = %v, want 0.007", result.CostUSD)
+	}
+	if result.Response != "second" {
+		t.Errorf("response = %q", result.Response)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// defaultOutputLimits caps, in bytes, how much output each action type feeds
+// back to the model. Action types without an entry are not capped.
+var defaultOutputLimits = map[string]int{
+	"READ":        100000,
+	"READ_RAW":    100000,
+	"RUN":         20000,
+	"LISTFILES":   20000,
+	"SEARCHFILES": 20000,
+}
+
+// actionType returns the tag name of action, e.g. "READ".
+func actionType(action Action) string {
+	kind, _, _ := strings.Cut(describeAction(action), " ")
+	return kind
+}
+
+// outputLimit returns the cap for an action type; Config.OutputLimits entries
+// override the defaults and a value <= 0 disables the cap.
+func outputLimit(config *Config, kind string) int {
+	if limit, ok := config.OutputLimits[kind]; ok {
+		return limit
+	}
+	return defaultOutputLimits[kind]
+}
+
+// truncateOutput shortens output to about limit bytes, keeping its beginning
+// and end around a marker that tells the model how much was cut. Cuts fall on
+// rune boundaries, so multi-byte characters are never split.
+func truncateOutput(output string, limit int) string {
+	if limit <= 0 || len(output) <= limit {
+		return output
+	}
+	head := runeStartAtOrBefore(output, limit*3/4)
+	start := runeStartAtOrAfter(output, len(output)-limit/4)
+	marker := fmt.Sprintf("\n[... output truncated: %d of %d bytes omitted (limit %d) ...]\n", start-head, len(output), limit)
+	return output[:head] + marker + output[start:]
+}
+
+// ellipsis marks text cut by safeTruncate.
+const ellipsis = "…"
+
+// safeTruncate shortens s to at most maxBytes bytes, ending with an ellipsis,
+// without splitting a multi-byte character.
+func safeTruncate(s string, maxBytes int) string {
+	if len(s) <= maxBytes {
+		return s
+	}
+	if maxBytes < len(ellipsis) {
+		return s[:runeStartAtOrBefore(s, maxBytes)]
+	}
+	return s[:runeStartAtOrBefore(s, maxBytes-len(ellipsis))] + ellipsis
+}
+
+// runeStartAtOrBefore returns the largest index <= i at which a rune of s starts.
+func runeStartAtOrBefore(s string, i int) int {
+	for i > 0 && i < len(s) && !utf8.RuneStart(s[i]) {
+		i--
+	}
+	return i
+}
+
+// runeStartAtOrAfter returns the smallest index >= i at which a rune of s
+// starts, or len(s).
+func runeStartAtOrAfter(s string, i int) int {
+	for i < len(s) && !utf8.RuneStart(s[i]) {
+		i++
+	}
+	return i
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateOutput(t *testing.T) {
+	if got := truncateOutput("short", 100); got != "short" {
+		t.Errorf("Expected short output unchanged, got %q", got)
+	}
+	output := strings.Repeat("a", 600) + strings.Repeat("z", 400)
+	got := truncateOutput(output, 100)
+	if !strings.HasPrefix(got, strings.Repeat("a", 75)+"\n[... output truncated: 900 of 1000 bytes") {
+		t.Errorf("Unexpected head %q", got)
+	}
+	if !strings.HasSuffix(got, "...]\n"+strings.Repeat("z", 25)) {
+		t.Errorf("Unexpected tail %q", got)
+	}
+	if got := truncateOutput(output, 0); got != output {
+		t.Errorf("Expected limit 0 to disable truncation")
+	}
+}
+
+func TestOutputLimit(t *testing.T) {
+	config := &Config{OutputLimits: map[string]int{"RUN": 0, "READ": 10}}
+	if got := outputLimit(config, "RUN"); got != 0 {
+		t.Errorf("Expected RUN override 0, got %d", got)
+	}
+	if got := outputLimit(config, "READ"); got != 10 {
+		t.Errorf("Expected READ override 10, got %d", got)
+	}
+	if got := outputLimit(config, "LISTFILES"); got != defaultOutputLimits["LISTFILES"] {
+		t.Errorf("Expected default LISTFILES limit, got %d", got)
+	}
+}
+
+func TestTruncateOutputMultiByte(t *testing.T) {
+	output := strings.Repeat("é", 300) + strings.Repeat("日", 200)
+	for limit := 90; limit <= 110; limit++ {
+		got := truncateOutput(output, limit)
+		if !utf8.ValidString(got) {
+			t.Fatalf("truncateOutput(%d) produced invalid UTF-8: %q", limit, got)
+		}
+		if !strings.HasPrefix(got, "é") || !strings.HasSuffix(got, "日") {
+			t.Errorf("truncateOutput(%d) lost the head or tail: %q", limit, got)
+		}
+	}
+}
+
+func TestSafeTruncate(t *testing.T) {
+	if got := safeTruncate("short", 10); got != "short" {
+		t.Errorf("Expected short text unchanged, got %q", got)
+	}
+	if got := safeTruncate("abcdefghij", 6); got != "abc…" {
+		t.Errorf("Expected %q, got %q", "abc…", got)
+	}
+	text := strings.Repeat("日本語", 10)
+	for max := 0; max <= len(text); max++ {
+		got := safeTruncate(text, max)
+		if !utf8.ValidString(got) || len(got) > max && max < len(text) {
+			t.Errorf("safeTruncate(%d) = %q (%d bytes)", max, got, len(got))
+		}
+	}
+}
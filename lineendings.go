@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// lineEndingModes are the accepted values of Config.LineEndings.
+var lineEndingModes = []string{"auto", "lf", "crlf"}
+
+// validateLineEndings checks Config.LineEndings.
+func validateLineEndings(config *Config) error {
+	if config.LineEndings != "" && !contains(lineEndingModes, config.LineEndings) {
+		return fmt.Errorf("invalid line_endings %q (use %s)", config.LineEndings, strings.Join(lineEndingModes, ", "))
+	}
+	return nil
+}
+
+// readTextFile reads path with CRLF line endings normalized to LF, so blocks,
+// searches and diffs never see a stray \r. It also reports whether the file
+// used CRLF, so writeTextFile can keep the convention.
+func readTextFile(path string) (string, bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, err
+	}
+	content := string(data)
+	crlf := strings.Contains(content, "\r\n")
+	return strings.ReplaceAll(content, "\r\n", "\n"), crlf, nil
+}
+
+// writeTextFile writes content to path with the line endings Config.LineEndings
+// asks for. In auto mode (the default) a file that used CRLF keeps it, and
+// new files get LF. An existing file is moved to the trash first, so every
+// action that changes a file can be undone with --restore.
+func writeTextFile(path, content string, crlf bool, config *Config) error {
+	if _, err := os.Stat(path); err == nil && useTrash(config) {
+		if _, err := trashFile(trashDir, path); err != nil {
+			return fmt.Errorf("could not back it up to the trash: %w", err)
+		}
+	}
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	switch config.LineEndings {
+	case "lf":
+		crlf = false
+	case "crlf":
+		crlf = true
+	}
+	if crlf {
+		content = strings.ReplaceAll(content, "\n", "\r\n")
+	}
+	return os.WriteFile(path, []byte(content), 0644)
+}
+
+// usesCRLF reports whether the file at path exists and uses CRLF line endings.
+func usesCRLF(path string) bool {
+	_, crlf, err := readTextFile(path)
+	return err == nil && crlf
+}
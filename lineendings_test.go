@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCRLFFileRoundTripsThroughReadAndPatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "main.go")
+	os.WriteFile(path, []byte("package main\r\n\r\nfunc a() {}\r\n\r\nfunc b() {}\r\n"), 0644)
+	config := &Config{AutoEdit: true}
+
+	output, err := ReadAction{Filename: path}.Execute(nil, config, false)
+	if err != nil {
+		t.Fatalf("READ failed: %v", err)
+	}
+	if strings.Contains(output, "\r") {
+		t.Errorf("Expected no \\r in the blocks, got %q", output)
+	}
+
+	if _, err := (PatchAction{Filename: path, ID: 1, Content: "func a() {\n\treturn\n}", Expect: "func a() {}"}).Execute(nil, config, false); err != nil {
+		t.Fatalf("PATCH failed: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if want := "package main\r\n\r\nfunc a() {\r\n\treturn\r\n}\r\n\r\nfunc b() {}\r\n"; string(data) != want {
+		t.Errorf("Expected CRLF to be kept, got %q", data)
+	}
+}
+
+func TestWriteTextFileLineEndings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	tests := []struct {
+		mode string
+		crlf bool
+		want string
+	}{
+		{"", false, "a\nb\n"},
+		{"auto", true, "a\r\nb\r\n"},
+		{"lf", true, "a\nb\n"},
+		{"crlf", false, "a\r\nb\r\n"},
+	}
+	for _, tt := range tests {
+		if err := writeTextFile(path, "a\r\nb\n", tt.crlf, &Config{LineEndings: tt.mode}); err != nil {
+			t.Fatal(err)
+		}
+		if data, _ := os.ReadFile(path); string(data) != tt.want {
+			t.Errorf("mode %q, crlf %v: got %q, want %q", tt.mode, tt.crlf, data, tt.want)
+		}
+	}
+	if err := validateLineEndings(&Config{LineEndings: "cr"}); err == nil {
+		t.Error("Expected an invalid line_endings value to be rejected")
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// logLevel orders the severities understood by the leveled logger.
+type logLevel int
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+// logThreshold is the lowest level that is printed. Debug output is only
+// enabled by Config.Verbose or --verbose.
+var logThreshold = levelInfo
+
+// console is where everything meant for the user is printed: stdout, except
+// under --json, where stdout carries only the result and the rest goes to stderr.
+var console io.Writer = os.Stdout
+
+// lastError is the most recent error message, reported by --json.
+var lastError string
+
+// setVerbose enables or disables debug logging.
+func setVerbose(verbose bool) {
+	if verbose {
+		logThreshold = levelDebug
+	} else {
+		logThreshold = levelInfo
+	}
+}
+
+func logAt(level logLevel, format string, args ...interface{}) {
+	if level < logThreshold {
+		return
+	}
+	w := console
+	prefix := ""
+	if level == levelDebug {
+		// Keep debug noise off stdout so it never mixes with the streamed response.
+		w = os.Stderr
+		prefix = "[debug] "
+	}
+	msg := fmt.Sprintf(format, args...)
+	if level == levelError {
+		lastError = strings.TrimSpace(msg)
+	}
+	if !strings.HasSuffix(msg, "\n") {
+		msg += "\n"
+	}
+	fmt.Fprint(w, prefix+msg)
+}
+
+func logDebug(format string, args ...interface{}) { logAt(levelDebug, format, args...) }
+func logInfo(format string, args ...interface{})  { logAt(levelInfo, format, args...) }
+func logWarn(format string, args ...interface{})  { logAt(levelWarn, format, args...) }
+func logError(format string, args ...interface{}) { logAt(levelError, format, args...) }
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// streamLogger appends streamed assistant output to the conversation log as it
+// arrives, so a crash mid-generation still leaves the partial text on disk.
+// Once the response completes, Finish removes the partial entry again and the
+// regular logMessages call writes the final message, avoiding duplicates.
+type streamLogger struct {
+	logFile  string
+	encoding string
+	f        *os.File
+	w        *bufio.Writer
+	start    int64
+}
+
+func newStreamLogger(logFile, encoding string) *streamLogger {
+	return &streamLogger{logFile: logFile, encoding: encoding}
+}
+
+// Write logs a streamed delta, opening a new partial entry on the first write.
+func (l *streamLogger) Write(p []byte) (int, error) {
+	if l.f == nil {
+		f, err := os.OpenFile(l.logFile, os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return 0, err
+		}
+		start, err := f.Seek(0, io.SeekEnd)
+		if err != nil {
+			f.Close()
+			return 0, err
+		}
+		l.f, l.w, l.start = f, bufio.NewWriter(f), start
+		timestamp := time.Now().Format("2006-01-02 15:04:05")
+		fmt.Fprintf(l.w, "[%s] assistant (streaming): ", timestamp)
+	}
+	// Deltas are sanitized one at a time, so an escape sequence split across
+	// two deltas can survive in a kept partial entry.
+	if _, err := l.w.WriteString(sanitizeLog(string(p), l.encoding)); err != nil {
+		return 0, err
+	}
+	if bytes.IndexByte(p, '\n') != -1 {
+		if err := l.w.Flush(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Finish discards the partial entry written since the first Write.
+func (l *streamLogger) Finish() error {
+	if l.f == nil {
+		return nil
+	}
+	defer func() { l.f, l.w = nil, nil }()
+	if err := l.f.Truncate(l.start); err != nil {
+		l.f.Close()
+		return err
+	}
+	return l.f.Close()
+}
+
+// Keep flushes and closes the partial entry without removing it, preserving
+// whatever was streamed before a request failed.
+func (l *streamLogger) Keep() error {
+	if l.f == nil {
+		return nil
+	}
+	defer func() { l.f, l.w = nil, nil }()
+	l.w.WriteString("\n")
+	if err := l.w.Flush(); err != nil {
+		l.f.Close()
+		return err
+	}
+	return l.f.Close()
+}
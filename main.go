@@ -1,28 +1,48 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
-	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
+
+	"github.com/atotto/clipboard"
 )
 
 type Message struct {
-	Role    string
-	Content string
+	Role    string `json:"role"`
+	Content string `json:"content"`
+	// ToolOutput marks a user message that carries action output fed back to
+	// the model rather than something the user wrote, so it doesn't start a turn.
+	ToolOutput bool `json:"tool_output,omitempty"`
 }
 
 type AIClient interface {
-	SendMessage(input string) (string, error)
+	// SendMessage sends input and streams the reply. Cancelling ctx aborts the request.
+	SendMessage(ctx context.Context, input string) (string, error)
 	AddMessage(role, content string)
 	GetHistory() []Message
+	// SetOutput sets where the streamed response is written as it arrives.
+	SetOutput(w io.Writer)
+	// SetHistory replaces the conversation (excluding the system prompt) with
+	// messages using the canonical "user"/"assistant" roles.
+	SetHistory(messages []Message)
+	// Close releases any resources held by the client.
+	Close() error
+	// Truncated reports whether the last response was cut off by the
+	// provider's output token limit.
+	Truncated() bool
 }
 
 type Config struct {
@@ -30,31 +50,214 @@ type Config struct {
 	APIKeys       map[string]string `json:"api_keys"`
 	AutoEdit      bool              `json:"auto_edit"`
 	AutoRun       bool              `json:"auto_run"`
+	// MinRequestIntervalMs is the minimum delay between requests, keyed by provider.
+	MinRequestIntervalMs map[string]int `json:"min_request_interval_ms,omitempty"`
+	// ScanMentions checks files inlined via @ mentions for secrets before sending them.
+	ScanMentions bool `json:"scan_mentions,omitempty"`
+	// BlockDelimiter is a regex matching delimiter lines for READ/PATCH blocks.
+	// When empty, blocks are separated by blank lines.
+	BlockDelimiter string `json:"block_delimiter,omitempty"`
+	// MaxActionsPerResponse caps how many actions a single response may execute.
+	// Zero means defaultMaxActionsPerResponse.
+	MaxActionsPerResponse int `json:"max_actions_per_response,omitempty"`
+	// Verbose enables debug logging; --verbose enables it for a single run.
+	Verbose bool `json:"verbose,omitempty"`
+	// Prompt and ContinuationPrompt replace the REPL's "λ " and ".. " input prompts.
+	Prompt             string `json:"prompt,omitempty"`
+	ContinuationPrompt string `json:"continuation_prompt,omitempty"`
+	// DefaultProvider serves models that match no known model list or prefix.
+	DefaultProvider string `json:"default_provider,omitempty"`
+	// DefaultConfirm makes an empty answer to a low-risk confirmation mean yes.
+	DefaultConfirm bool `json:"default_confirm,omitempty"`
+	// WatchMaxIterations caps the fix attempts made by --watch (default 5).
+	WatchMaxIterations int `json:"watch_max_iterations,omitempty"`
+	// ReasoningTags names tags such as <think> whose content is stripped from
+	// responses before actions are parsed and history is stored.
+	ReasoningTags []string `json:"reasoning_tags,omitempty"`
+	// ShowReasoning displays reasoning dimmed while streaming instead of hiding it.
+	ShowReasoning bool `json:"show_reasoning,omitempty"`
+	// HideActionTags shows a placeholder such as [editing main.go...] while an
+	// action tag streams, instead of its raw content.
+	HideActionTags bool `json:"hide_action_tags,omitempty"`
+	// PinReads keeps files shown with READ attached, with fresh block IDs, to
+	// every request until they are unpinned with /unpin.
+	PinReads bool `json:"pin_reads,omitempty"`
+	// AutoContinue asks the model to continue when a response hits the output
+	// token limit, instead of leaving the truncated response unexecuted.
+	AutoContinue bool `json:"auto_continue,omitempty"`
+	// SensitivePaths lists path patterns (e.g. ".env", "~/.ssh/*") that READ
+	// asks about before sending a file to the model.
+	SensitivePaths []string `json:"sensitive_paths,omitempty"`
+	// LogEncoding controls how control characters and ANSI codes are written to
+	// conversation logs: "strip" (default), "escape" or "keep".
+	LogEncoding string `json:"log_encoding,omitempty"`
+	// OutputLimits caps the bytes of output fed back to the model per action
+	// type (e.g. "RUN": 20000); 0 disables the cap for that type.
+	OutputLimits map[string]int `json:"output_limits,omitempty"`
+	// ExtraBody holds extra request body fields per provider, such as OpenAI's
+	// "reasoning_effort" or OpenRouter's "provider" preferences.
+	ExtraBody map[string]map[string]interface{} `json:"extra_body,omitempty"`
+	// UseTrash copies files to ~/.config/arisu/trash before they are
+	// overwritten, so they can be recovered with --restore (default true).
+	UseTrash *bool `json:"use_trash,omitempty"`
+	// TrashMaxAgeDays is how long trashed files are kept (default 30).
+	TrashMaxAgeDays int `json:"trash_max_age_days,omitempty"`
+	// Interactive forces the REPL on (even after a one-shot prompt) or off.
+	// When unset, the REPL starts if no prompt is given and stdin is a terminal.
+	Interactive *bool `json:"interactive,omitempty"`
+	// CommandEnv sets extra environment variables for RUN commands.
+	CommandEnv map[string]string `json:"command_env,omitempty"`
+	// MinimalCommandEnv runs commands with only PATH, HOME and a few other basic
+	// variables (plus CommandEnv) instead of the full environment.
+	MinimalCommandEnv bool `json:"minimal_command_env,omitempty"`
+	// AllowedEnv lists credential-like variables (e.g. GITHUB_TOKEN) that are
+	// passed to commands instead of being scrubbed.
+	AllowedEnv []string `json:"allowed_env,omitempty"`
+	// AllowNetwork set to false runs RUN commands without network access where
+	// the platform supports it (default true).
+	AllowNetwork *bool `json:"allow_network,omitempty"`
+	// Templates are named prompts used with /use or --use. {{name}} is
+	// replaced by a key=value argument and {{run: command}} by its output.
+	Templates map[string]string `json:"templates,omitempty"`
+	// GeminiSeparateUserTurns keeps consecutive user messages (e.g. tool
+	// output followed by input) as separate Gemini turns with a "(continuing)"
+	// model turn between them, instead of merging them into one.
+	GeminiSeparateUserTurns bool `json:"gemini_separate_user_turns,omitempty"`
+	// ServePolicy selects which actions --serve applies without confirmation:
+	// "read-only" (default), "edit" or "all".
+	ServePolicy string `json:"serve_policy,omitempty"`
+	// BaseURLOverrides maps a provider to the base URL of an internal gateway
+	// or mirror to send its requests to, e.g. {"openai": "https://ai.corp/v1"}.
+	BaseURLOverrides map[string]string `json:"base_url_overrides,omitempty"`
+	// TagNames renames action tags, e.g. {"EDIT": "WRITE_FILE"}, in both the
+	// system prompt and the parser.
+	TagNames map[string]string `json:"tag_names,omitempty"`
+	// EnabledActions limits the actions the model may use, e.g. ["READ",
+	// "SEARCHFILES"]. Unset enables all; others are skipped and left out of
+	// the system prompt.
+	EnabledActions []string `json:"enabled_actions,omitempty"`
+	// ShowStats prints time to first token and throughput after each response.
+	ShowStats bool `json:"show_stats,omitempty"`
+	// PreTurnHook and PostTurnHook are shell commands run before each turn and
+	// after its actions are applied. A failing hook only prints a warning.
+	PreTurnHook  string `json:"pre_turn_hook,omitempty"`
+	PostTurnHook string `json:"post_turn_hook,omitempty"`
+	// CacheResponses reuses the stored response when the same conversation is
+	// sent to the same model with the same parameters, instead of calling the
+	// API. Entries expire after CacheTTLHours (default 24).
+	CacheResponses bool `json:"cache_responses,omitempty"`
+	CacheTTLHours  int  `json:"cache_ttl_hours,omitempty"`
+	// MaxHistory is the number of messages kept in the conversation sent to
+	// the model (default 50, minimum 2).
+	MaxHistory int `json:"max_history,omitempty"`
+	// MaxContextTokens drops the oldest whole turns, keeping the system
+	// prompt, so each request stays under this many tokens. Zero disables it.
+	MaxContextTokens int `json:"max_context_tokens,omitempty"`
+	// IncludeGitContext adds the current git branch and uncommitted changes to
+	// each turn's input when running inside a git repository.
+	IncludeGitContext bool `json:"include_git_context,omitempty"`
+	// ReasoningEffort ("minimal", "low", "medium" or "high") and Verbosity
+	// ("low", "medium" or "high") are sent to OpenAI models that support them
+	// (o-series and GPT-5 for reasoning effort, GPT-5 for verbosity).
+	ReasoningEffort string `json:"reasoning_effort,omitempty"`
+	Verbosity       string `json:"verbosity,omitempty"`
+	// ProjectMemory loads .arisu/memory.md into the system prompt and lets the
+	// model add facts to it with MEMORY_APPEND. The file is capped at
+	// MemoryMaxBytes (default 8000); the oldest facts are dropped first.
+	ProjectMemory  bool `json:"project_memory,omitempty"`
+	MemoryMaxBytes int  `json:"memory_max_bytes,omitempty"`
+	// TTS reads the prose of each final response aloud, without code, action
+	// tags or tool output. TTSCommand reads the text from stdin; it defaults to
+	// say on macOS and espeak (or spd-say) elsewhere.
+	TTS        bool   `json:"tts,omitempty"`
+	TTSCommand string `json:"tts_command,omitempty"`
+	// ProjectHints maps marker files such as "go.mod" to a note added to the
+	// system prompt when the working directory has them, overriding the
+	// built-in notes; a marker mapped to "" is ignored.
+	ProjectHints map[string]string `json:"project_hints,omitempty"`
+	// MaxSessionCostUSD stops sending requests once the session's estimated
+	// spend reaches it, warning at 80%. Costs are estimated from message sizes
+	// and ModelPrices (USD per million tokens), which extends the built-in list.
+	MaxSessionCostUSD float64               `json:"max_session_cost_usd,omitempty"`
+	ModelPrices       map[string]modelPrice `json:"model_prices,omitempty"`
+	// ResponseFormat is a JSON schema the answers must follow. When set, the
+	// model is asked for JSON through the provider's structured output support,
+	// action tags are neither offered nor parsed, and answers are validated.
+	ResponseFormat map[string]interface{} `json:"response_format,omitempty"`
+	// LineEndings is how edited files are written: "auto" (the default) keeps
+	// a file's CRLF or LF convention, "lf" and "crlf" force one. Files are
+	// always read with CRLF normalized to LF.
+	LineEndings string `json:"line_endings,omitempty"`
+	// ConfirmPerResponse lists a response's actions and asks once whether to
+	// apply them all, falling back to per-action prompts on no.
+	ConfirmPerResponse bool `json:"confirm_per_response,omitempty"`
+	// MaxConcurrentActions caps how many read-only actions (READ, READ_RAW,
+	// LISTFILES, SEARCHFILES) of a response run at once; 0 means 4 and 1 runs
+	// every action sequentially. Other actions always run alone, in order.
+	MaxConcurrentActions int `json:"max_concurrent_actions,omitempty"`
+	// MaxSearchMatches caps how many lines SEARCHFILES returns. Zero means
+	// defaultMaxSearchMatches.
+	MaxSearchMatches int `json:"max_search_matches,omitempty"`
+	// AtomicPatches makes a response's PATCH actions all-or-nothing: if one
+	// fails, the files the others patched are restored. Without it the
+	// patches that work are kept, and either way a response with several
+	// patches gets a summary of which ones applied.
+	AtomicPatches bool `json:"atomic_patches,omitempty"`
+	// AllowInlineCommands expands !(command) in REPL input to the command's
+	// output. Commands are confirmed unless AutoRun is set.
+	AllowInlineCommands bool `json:"allow_inline_commands,omitempty"`
+	// ConfirmDestructiveOnly creates new files without asking, while
+	// overwrites, patches, replacements, deletions and commands still ask
+	// unless AutoEdit or AutoRun is set.
+	ConfirmDestructiveOnly bool `json:"confirm_destructive_only,omitempty"`
+	// EnableGrounding turns on the provider's own web search, where the
+	// provider offers one, and lists the sources it cites after a response.
+	EnableGrounding bool `json:"enable_grounding,omitempty"`
 }
 
+const defaultMaxActionsPerResponse = 50
+
+// loadConfig loads a single config file, as loadConfigLayered does for the user config.
 func loadConfig(configFile string) (*Config, error) {
-	data, err := os.ReadFile(configFile)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return &Config{APIKeys: make(map[string]string)}, nil
-		}
-		return nil, err
-	}
-	var config Config
-	if err := json.Unmarshal(data, &config); err != nil {
-		return nil, err
-	}
-	if config.APIKeys == nil {
-		config.APIKeys = make(map[string]string)
+	return loadConfigLayered("", configFile, "")
+}
+
+// providerDefaultModels maps a bare provider name to the model it selects,
+// so that e.g. "--setmodel openai" picks OpenAI's default model.
+var providerDefaultModels = map[string]string{
+	"gemini":     "gemini-2.0-flash",
+	"grok":       "grok-2-latest",
+	"openai":     "gpt-4o",
+	"openrouter": "openrouter-openai/gpt-4o",
+}
+
+// normalizeModel expands provider names such as "grok" to that provider's
+// default model.
+func normalizeModel(model string) string {
+	if def, ok := providerDefaultModels[model]; ok {
+		return def
 	}
-	if config.SelectedModel == "grok" {
-		config.SelectedModel = "grok-2-latest"
+	return model
+}
+
+// backupConfig moves a broken config file to <file>.bak, or to a timestamped
+// name if that backup already exists, and returns the new path.
+func backupConfig(configFile string) (string, error) {
+	backup := configFile + ".bak"
+	if _, err := os.Stat(backup); err == nil {
+		backup = configFile + "." + time.Now().Format("20060102_150405") + ".bak"
 	}
-	return &config, nil
+	return backup, os.Rename(configFile, backup)
 }
 
+// saveConfig writes the user's settings to configFile. Settings inherited
+// from the global or project config are not copied into it.
 func saveConfig(configFile string, config *Config) error {
-	data, err := json.MarshalIndent(config, "", "  ")
+	fields, err := userConfigFields(configFile, config)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(fields, "", "  ")
 	if err != nil {
 		return err
 	}
@@ -64,7 +267,7 @@ func saveConfig(configFile string, config *Config) error {
 	return os.WriteFile(configFile, data, 0600)
 }
 
-func logMessages(logFile string, history []Message, startIdx int) error {
+func logMessages(logFile string, history []Message, startIdx int, encoding string) error {
 	f, err := os.OpenFile(logFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
 		return err
@@ -74,7 +277,7 @@ func logMessages(logFile string, history []Message, startIdx int) error {
 	for i := startIdx; i < len(history); i++ {
 		msg := history[i]
 		timestamp := time.Now().Format("2006-01-02 15:04:05")
-		logEntry := fmt.Sprintf("[%s] %s: %s\n", timestamp, msg.Role, msg.Content)
+		logEntry := fmt.Sprintf("[%s] %s: %s\n", timestamp, msg.Role, sanitizeLog(msg.Content, encoding))
 		if _, err := f.WriteString(logEntry); err != nil {
 			return err
 		}
@@ -82,164 +285,527 @@ func logMessages(logFile string, history []Message, startIdx int) error {
 	return nil
 }
 
+// newSessionClient creates the client for provider with the throttling,
+// tracing, cost and caching wrappers the config asks for.
+func newSessionClient(config *Config, provider, apiKey, prompt string) AIClient {
+	opts := newClientOptions(config, provider, prompt)
+	client := newAIClient(provider, apiKey, config.SelectedModel, opts)
+	client = newThrottledClient(client, time.Duration(config.MinRequestIntervalMs[provider])*time.Millisecond)
+	client = newTracedClient(client, provider, config.SelectedModel)
+	client = newCostLimitedClient(client, config)
+	return newCachedClient(client, config, provider, opts)
+}
+
+// sessionOutput returns where an interactive session's responses are
+// streamed: the terminal, filtered as the config asks, and the log stream.
+func sessionOutput(config *Config, stream *streamLogger) io.Writer {
+	return io.MultiWriter(newActionWriter(newReasoningWriter(console, reasoningTags(config), config.ShowReasoning), config.HideActionTags), stream)
+}
+
 func main() {
+	// exitCode is set by paths that fail without a usage error. Every exit goes
+	// through the deferred call, which runs last, after other cleanup, and
+	// writes the --json result first.
+	exitCode := 0
+	defer func() {
+		if jsonOutput != nil {
+			writeJSONResult(os.Stdout)
+		}
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+	}()
+
 	configDir := filepath.Join(os.Getenv("HOME"), ".config", "arisu")
 	configFile := filepath.Join(configDir, "config.json")
 
 	logDir := filepath.Join(configDir, "log")
 	if err := os.MkdirAll(logDir, 0700); err != nil {
-		fmt.Printf("Error creating log directory: %v\n", err)
+		logError("Error creating log directory: %v", err)
 		return
 	}
 	timestamp := time.Now().Format("20060102_150405")
 	logFile := filepath.Join(logDir, "conversation_"+timestamp+".log")
 
-	config, err := loadConfig(configFile)
+	cwd, _ := os.Getwd()
+	config, err := loadConfigLayered(globalConfigFile, configFile, cwd)
 	if err != nil {
-		fmt.Printf("Error loading config: %v\n", err)
+		logError("Error loading config: %v", err)
+		return
+	}
+	trashDir = filepath.Join(configDir, "trash")
+	cacheDir = filepath.Join(configDir, "cache")
+	inputHistoryFile = filepath.Join(configDir, "input_history.json")
+	initTracing()
+	defer shutdownTracing()
+	if err := setTagNames(config.TagNames); err != nil {
+		logError("Error in config: %v", err)
+		return
+	}
+	if err := setEnabledActions(config.EnabledActions); err != nil {
+		logError("Error in config: %v", err)
+		return
+	}
+	if err := validateModelControls(config); err != nil {
+		logError("Error in config: %v", err)
+		return
+	}
+	if err := validateResponseFormat(config); err != nil {
+		logError("Error in config: %v", err)
+		return
+	}
+	if err := validateLineEndings(config); err != nil {
+		logError("Error in config: %v", err)
 		return
 	}
+	projectMemory = config.ProjectMemory
+	projectHints = detectProjectHints(".", config.ProjectHints)
+	defer waitForSpeech()
+	if config.MaxHistory < 0 || (config.MaxHistory > 0 && config.MaxHistory < minMaxHistory) {
+		logWarn("Warning: max_history %d is invalid; using %d.", config.MaxHistory, historyLimit(config.MaxHistory))
+	}
+	if err := purgeTrash(trashDir, trashMaxAge(config)); err != nil {
+		logWarn("Warning: could not purge the trash: %v", err)
+	}
 
 	args := os.Args[1:]
+	args, noSystemPrompt := extractFlag(args, "--no-system-prompt")
+	noSystemPrompt = noSystemPrompt || structuredOutput(config)
+	args, copyResponse := extractFlag(args, "--copy")
+	args, dumpFile, dump := extractFlagValue(args, "--dump-history")
+	args, verbose := extractFlag(args, "--verbose")
+	args, resumeFile, resume := extractFlagValue(args, "--resume")
+	args, sinceValue, hasSince := extractFlagValue(args, "--since")
+	args, templateName, useTemplate := extractFlagValue(args, "--use")
+	args, serveAddress, serve := extractFlagValue(args, "--serve")
+	args, watchCommand, watch := extractFlagValue(args, "--watch")
+	args, jsonMode := extractFlag(args, "--json")
+	args, forceInteractive := extractFlag(args, "--interactive")
+	args, forceOneShot := extractFlag(args, "--one-shot")
+	if forceInteractive && (forceOneShot || jsonMode) {
+		fmt.Fprintln(console, "--interactive can't be combined with --one-shot or --json.")
+		return
+	}
+	forceOneShot = forceOneShot || jsonMode
+	setVerbose(config.Verbose || verbose)
+	if jsonMode {
+		// Everything except the final JSON object goes to stderr.
+		console = os.Stderr
+		jsonOutput = &jsonResult{}
+	}
 	if len(args) > 0 {
 		switch args[0] {
 		case "--setmodel":
 			if len(args) < 2 {
-				fmt.Println("Usage: arisu --setmodel <model>")
+				fmt.Fprintln(console, "Usage: arisu --setmodel <model|provider>")
 				return
 			}
-			model := args[1]
-			if model == "grok" {
-				model = "grok-2-latest"
-			}
+			model := normalizeModel(args[1])
 			config.SelectedModel = model
 			if err := saveConfig(configFile, config); err != nil {
-				fmt.Printf("Error saving config: %v\n", err)
+				logError("Error saving config: %v", err)
 				return
 			}
-			fmt.Printf("Selected model set to %s\n", model)
-			return
+			fmt.Fprintf(console, "Selected model set to %s\n", model)
+			if !forceInteractive {
+				return
+			}
+			args = args[2:]
 		case "--auto-edit":
 			if len(args) < 2 || (args[1] != "true" && args[1] != "false") {
-				fmt.Println("Usage: arisu --auto-edit true/false")
+				fmt.Fprintln(console, "Usage: arisu --auto-edit true/false")
 				return
 			}
 			config.AutoEdit = args[1] == "true"
 			if err := saveConfig(configFile, config); err != nil {
-				fmt.Printf("Error saving config: %v\n", err)
+				logError("Error saving config: %v", err)
 				return
 			}
-			fmt.Printf("Auto-edit set to %v\n", config.AutoEdit)
-			return
+			fmt.Fprintf(console, "Auto-edit set to %v\n", config.AutoEdit)
+			if !forceInteractive {
+				return
+			}
+			args = args[2:]
 		case "--auto-run":
 			if len(args) < 2 || (args[1] != "true" && args[1] != "false") {
-				fmt.Println("Usage: arisu --auto-run true/false")
+				fmt.Fprintln(console, "Usage: arisu --auto-run true/false")
 				return
 			}
 			config.AutoRun = args[1] == "true"
 			if err := saveConfig(configFile, config); err != nil {
-				fmt.Printf("Error saving config: %v\n", err)
+				logError("Error saving config: %v", err)
+				return
+			}
+			fmt.Fprintf(console, "Auto-run set to %v\n", config.AutoRun)
+			if !forceInteractive {
+				return
+			}
+			args = args[2:]
+		case "--pick":
+			model, ok := pickModel(config.SelectedModel)
+			if !ok {
+				return
+			}
+			config.SelectedModel = model
+			provider := detectProvider(model)
+			if config.APIKeys[provider] == "" {
+				apiKey := readAPIKey(provider)
+				if apiKey == "" {
+					logError("Error: No API key provided.")
+					return
+				}
+				config.APIKeys[provider] = apiKey
+			}
+			if err := saveConfig(configFile, config); err != nil {
+				logError("Error saving config: %v", err)
+				return
+			}
+			fmt.Fprintf(console, "Selected model set to %s\n", model)
+			if !forceInteractive {
+				return
+			}
+			args = args[1:]
+		case "--print-prompt":
+			fmt.Fprintln(console, systemPrompt(noSystemPrompt))
+			return
+		case "--restore":
+			if len(args) < 2 {
+				entries, err := loadTrash(trashDir)
+				if err != nil {
+					logError("Error reading the trash: %v", err)
+					return
+				}
+				if len(entries) == 0 {
+					fmt.Fprintln(console, "The trash is empty.")
+					return
+				}
+				for _, entry := range entries {
+					fmt.Fprintf(console, "%s  %s  %s\n", entry.ID, entry.TrashedAt.Format("2006-01-02 15:04:05"), entry.Path)
+				}
+				fmt.Fprintln(console, "Usage: arisu --restore <id>")
+				return
+			}
+			entry, err := restoreTrash(trashDir, args[1])
+			if err != nil {
+				logError("Error restoring %s: %v", args[1], err)
+				return
+			}
+			fmt.Fprintf(console, "Restored %s\n", entry.Path)
+			return
+		case "--compare":
+			if len(args) < 4 {
+				fmt.Fprintln(console, "Usage: arisu --compare <model> <model> [model...] \"prompt\"")
+				return
+			}
+			models, prompt := args[1:len(args)-1], args[len(args)-1]
+			runCompare(config, models, expandMentions(prompt, config), systemPrompt(noSystemPrompt))
+			return
+		case "--trim-history":
+			rest, turnsValue, _ := extractFlagValue(args[1:], "--turns")
+			rest, tokensValue, _ := extractFlagValue(rest, "--tokens")
+			turns, _ := strconv.Atoi(turnsValue)
+			tokens, _ := strconv.Atoi(tokensValue)
+			if len(rest) != 1 || (turns <= 0 && tokens <= 0) {
+				fmt.Fprintln(console, "Usage: arisu --trim-history <session.json> [--turns N] [--tokens N]")
+				return
+			}
+			if err := trimSessionFile(rest[0], turns, tokens, config); err != nil {
+				logError("Error trimming %s: %v", rest[0], err)
+			}
+			return
+		case "--replay":
+			if len(args) < 2 {
+				fmt.Fprintln(console, "Usage: arisu --replay <logfile|session.json>")
 				return
 			}
-			fmt.Printf("Auto-run set to %v\n", config.AutoRun)
+			if err := replayTranscript(args[1]); err != nil {
+				logError("Error replaying %s: %v", args[1], err)
+			}
 			return
+		case "--replay-actions":
+			if len(args) < 2 {
+				fmt.Fprintln(console, "Usage: arisu --replay-actions <logfile|session.json>")
+				return
+			}
+			if err := replayImpact(args[1]); err != nil {
+				logError("Error replaying %s: %v", args[1], err)
+			}
+			return
+		case "--max-actions":
+			limit := 0
+			if len(args) >= 2 {
+				limit, _ = strconv.Atoi(args[1])
+			}
+			if limit <= 0 {
+				fmt.Fprintln(console, "Usage: arisu --max-actions <positive number>")
+				return
+			}
+			config.MaxActionsPerResponse = limit
+			if err := saveConfig(configFile, config); err != nil {
+				logError("Error saving config: %v", err)
+				return
+			}
+			fmt.Fprintf(console, "Max actions per response set to %d\n", limit)
+			if !forceInteractive {
+				return
+			}
+			args = args[2:]
+		}
+	}
+
+	var resumed *savedSession
+	if hasSince && !resume {
+		fmt.Fprintln(console, "Usage: arisu --resume <session.json|conversation.log> [--since <duration|timestamp>]")
+		return
+	}
+	if resume {
+		var since time.Time
+		if hasSince {
+			if since, err = parseSince(sinceValue, time.Now()); err != nil {
+				logError("Error: %v", err)
+				return
+			}
 		}
+		resumed, err = loadResume(resumeFile, since)
+		if err != nil {
+			logError("Error loading session: %v", err)
+			return
+		}
+		if config.SelectedModel == "" {
+			config.SelectedModel = normalizeModel(resumed.Model)
+		}
+	}
+
+	// ARISU_MODEL overrides the selected model for this run only; it is never saved.
+	savedModel := config.SelectedModel
+	if envModel := os.Getenv("ARISU_MODEL"); envModel != "" {
+		config.SelectedModel = normalizeModel(envModel)
 	}
 
 	if config.SelectedModel == "" {
 		config.SelectedModel = "gemini"
 	}
 
-	openaiModels := []string{
-		"gpt-4.1-mini",
-		"gpt-4.1",
-		"gpt-4o",
-		"gpt-4o-mini",
-		"o3",
-		"gpt-3.5-turbo",
-	}
-
-	geminiModels := []string{
-		"gemini",
-		"gemini-2.0-flash",
-		"gemini-2.5-flash",
-		"gemini-2.5-pro",
-		"gemini-3-pro-preview",
-	}
-
-	var provider string
-	if contains(geminiModels, config.SelectedModel) {
-		provider = "gemini"
-	} else if strings.HasPrefix(config.SelectedModel, "grok-") {
-		provider = "grok"
-	} else if contains(openaiModels, config.SelectedModel) {
-		provider = "openai"
-	} else if strings.HasPrefix(config.SelectedModel, "openrouter-") {
-		provider = "openrouter"
-	} else {
-		fmt.Println("Invalid selected model in config.")
+	provider := resolveProvider(config)
+	if provider == "" {
+		logError("Invalid selected model in config.")
 		return
 	}
 
-	apiKey, ok := config.APIKeys[provider]
-	if !ok || apiKey == "" {
-		fmt.Printf("Enter your %s API key: ", provider)
-		scanner := bufio.NewScanner(os.Stdin)
-		if scanner.Scan() {
-			apiKey = scanner.Text()
-		}
+	apiKey := config.APIKeys[provider]
+	if apiKey == "" {
+		// ARISU_<PROVIDER>_API_KEY supplies a key for this run only; it is never saved.
+		apiKey = os.Getenv(apiKeyEnv(provider))
+	}
+	if apiKey == "" && (promptsDisabled || !isTerminal(os.Stdin)) {
+		logError("%s", missingAPIKeyMessage(provider, configFile))
+		exitCode = 1
+		return
+	}
+	if apiKey == "" {
+		apiKey = readAPIKey(provider)
 		if apiKey == "" {
-			fmt.Println("Error: No API key provided.")
+			logError("Error: No API key provided.")
 			return
 		}
 		config.APIKeys[provider] = apiKey
+		runModel := config.SelectedModel
+		config.SelectedModel = savedModel
 		if err := saveConfig(configFile, config); err != nil {
-			fmt.Printf("Error saving config: %v\n", err)
+			logError("Error saving config: %v", err)
 		}
+		config.SelectedModel = runModel
 	}
 
-	var client AIClient
-	maxHistory := 50 // Default max history length
-	if provider == "gemini" {
-		model := config.SelectedModel
-		if model == "gemini" {
-			model = "gemini-2.0-flash"
+	if serve {
+		if err := runServer(serveAddress, config, provider, apiKey, systemPrompt(noSystemPrompt), logFile); err != nil {
+			logError("Error running server: %v", err)
 		}
-		client = NewClient(apiKey, model, maxHistory)
-	} else if provider == "grok" {
-		client = NewGrokClient(apiKey, config.SelectedModel, maxHistory)
-	} else if provider == "openai" {
-		client = NewOpenAIClient(apiKey, config.SelectedModel, maxHistory)
-	} else if provider == "openrouter" {
-		client = NewOpenRouterClient(apiKey, config.SelectedModel, maxHistory)
+		return
 	}
 
-	if len(args) > 0 {
-		prompt := strings.Join(args, " ")
-		response, err := client.SendMessage(prompt)
+	client := newSessionClient(config, provider, apiKey, systemPrompt(noSystemPrompt))
+	logDebug("Using provider %s with model %s", provider, config.SelectedModel)
+	if !noSystemPrompt {
+		warnWeakToolModel(config.SelectedModel, provider)
+	}
+
+	stream := newStreamLogger(logFile, config.LogEncoding)
+	if jsonMode {
+		client.SetOutput(stream)
+	} else {
+		client.SetOutput(sessionOutput(config, stream))
+	}
+
+	sessionFile := filepath.Join(configDir, "sessions", "session_"+timestamp+".json")
+	if resume {
+		client.SetHistory(resumed.Messages)
+		// A resumed log is not overwritten; the conversation continues in a new session file.
+		if strings.HasSuffix(resumeFile, ".json") {
+			sessionFile = resumeFile
+		}
+		fmt.Fprintf(console, "Resumed %d messages from %s\n", len(resumed.Messages), resumeFile)
+	}
+	s := &session{client: client, config: config, provider: provider, logFile: logFile, sessionFile: sessionFile, stream: stream,
+		configFile: configFile, noSystemPrompt: noSystemPrompt}
+	currentSession = s
+	// /reload-config may replace the client, so close whichever is current.
+	defer func() { s.client.Close() }()
+
+	// SIGTERM (e.g. from a process manager) cancels the root context so the
+	// current turn stops, logs are flushed and deferred cleanup runs.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM)
+	defer stop()
+
+	if watch {
+		instruction := strings.Join(args, " ")
+		if instruction == "" {
+			instruction = "Fix the errors so that the command succeeds."
+		}
+		if !runWatch(ctx, s, watchCommand, instruction, config.WatchMaxIterations) {
+			exitCode = 1
+		}
+		return
+	}
+
+	prompt := strings.Join(args, " ")
+	if useTemplate {
+		if prompt, err = renderTemplate(config, templateName, args); err != nil {
+			logError("Error: %v", err)
+			return
+		}
+		prompt = expandMentions(prompt, config)
+	}
+	interactive := interactiveMode(config, prompt != "", forceInteractive, forceOneShot)
+	if prompt == "" && !interactive {
+		// A one-shot run without a prompt reads it from stdin, e.g. `git diff | arisu --one-shot`.
+		// A terminal would block with no hint that arisu is waiting for input.
+		if isTerminal(os.Stdin) {
+			logError("Error: No prompt given. Pass one as an argument or pipe it on stdin.")
+			return
+		}
+		data, err := io.ReadAll(os.Stdin)
 		if err != nil {
-			fmt.Printf("Error: %v\n", err)
+			logError("Error reading prompt from stdin: %v", err)
 			return
 		}
+		if prompt = strings.TrimSpace(string(data)); prompt == "" {
+			logError("Error: No prompt given.")
+			return
+		}
+	}
 
-		for {
-			output, isToolCall := handleResponse(response, client, config)
-			_ = logMessages(logFile, client.GetHistory(), 0)
-
-			if isToolCall {
-				response, err = client.SendMessage(output)
-				if err != nil {
-					fmt.Printf("Error sending tool output: %v\n", err)
-					return
-				}
-			} else {
-				break
+	if prompt != "" {
+		err := s.runTurn(ctx, prompt)
+		if err != nil && jsonOutput != nil {
+			jsonOutput.Error = err.Error()
+		}
+		if err == nil && copyResponse {
+			if err := clipboard.WriteAll(lastAssistantResponse(client.GetHistory())); err != nil {
+				logError("Error copying to clipboard: %v", err)
 			}
 		}
-		return
+		if dump {
+			if err := dumpHistory(dumpFile, provider, config.SelectedModel, client.GetHistory()); err != nil {
+				logError("Error writing %s: %v", dumpFile, err)
+			}
+		}
+		if !interactive {
+			return
+		}
+	}
+
+	StartREPL(ctx, s)
+}
+
+// interactiveMode decides whether to start the REPL. --interactive and
+// --one-shot win, then Config.Interactive; otherwise the REPL starts when no
+// prompt was given and stdin is a terminal.
+func interactiveMode(config *Config, hasPrompt, forceInteractive, forceOneShot bool) bool {
+	switch {
+	case forceInteractive:
+		return true
+	case forceOneShot:
+		return false
+	case config.Interactive != nil:
+		return *config.Interactive
+	}
+	return !hasPrompt && isTerminal(os.Stdin)
+}
+
+var openaiModels = []string{
+	"gpt-5",
+	"gpt-5-mini",
+	"gpt-4.1-mini",
+	"gpt-4.1",
+	"gpt-4o",
+	"gpt-4o-mini",
+	"o3",
+	"gpt-3.5-turbo",
+}
+
+var geminiModels = []string{
+	"gemini",
+	"gemini-2.0-flash",
+	"gemini-2.5-flash",
+	"gemini-2.5-pro",
+	"gemini-3-pro-preview",
+}
+
+var grokModels = []string{
+	"grok-2-latest",
+}
+
+// detectProvider returns the provider serving model, or "" if it is unknown.
+func detectProvider(model string) string {
+	if contains(geminiModels, model) {
+		return "gemini"
+	} else if strings.HasPrefix(model, "grok-") {
+		return "grok"
+	} else if contains(openaiModels, model) {
+		return "openai"
+	} else if strings.HasPrefix(model, "openrouter-") {
+		return "openrouter"
+	}
+	return ""
+}
+
+var knownProviders = []string{"gemini", "grok", "openai", "openrouter"}
+
+// resolveProvider picks the provider for config.SelectedModel. Known models and
+// prefixes win; otherwise config.DefaultProvider is used, if it names a known provider.
+func resolveProvider(config *Config) string {
+	if provider := detectProvider(config.SelectedModel); provider != "" {
+		return provider
 	}
+	if contains(knownProviders, config.DefaultProvider) {
+		return config.DefaultProvider
+	}
+	return ""
+}
+
+// apiKeyEnv returns the environment variable that can hold provider's API
+// key, e.g. ARISU_OPENAI_API_KEY.
+func apiKeyEnv(provider string) string {
+	return "ARISU_" + strings.ToUpper(provider) + "_API_KEY"
+}
 
-	StartREPL(client, config, logFile)
+// missingAPIKeyMessage explains how to supply a key when there is no one to
+// ask for it, e.g. in CI.
+func missingAPIKeyMessage(provider, configFile string) string {
+	return fmt.Sprintf("Error: no API key for %s, and stdin is not a terminal to ask for one.\n"+
+		"Set %s, add it under \"api_keys\" in %s, or run arisu once in a terminal to enter and save it.",
+		provider, apiKeyEnv(provider), configFile)
+}
+
+// readAPIKey prompts for the provider's API key on stdin.
+func readAPIKey(provider string) string {
+	fmt.Fprintf(console, "Enter your %s API key: ", provider)
+	scanner := stdinScanner
+	if scanner.Scan() {
+		return strings.TrimSpace(scanner.Text())
+	}
+	return ""
 }
 
 func contains(slice []string, item string) bool {
@@ -251,11 +817,145 @@ func contains(slice []string, item string) bool {
 	return false
 }
 
-func confirmAction(prompt string) bool {
-	fmt.Printf("%s (y/n): ", prompt)
-	scanner := bufio.NewScanner(os.Stdin)
+// extractFlag removes every occurrence of flag from args and reports whether it was present.
+func extractFlag(args []string, flag string) ([]string, bool) {
+	var rest []string
+	found := false
+	for _, arg := range args {
+		if arg == flag {
+			found = true
+			continue
+		}
+		rest = append(rest, arg)
+	}
+	return rest, found
+}
+
+// extractFlagValue removes flag and the value following it from args.
+func extractFlagValue(args []string, flag string) ([]string, string, bool) {
+	for i, arg := range args {
+		if arg == flag && i+1 < len(args) {
+			rest := append(append([]string{}, args[:i]...), args[i+2:]...)
+			return rest, args[i+1], true
+		}
+	}
+	return args, "", false
+}
+
+// confirmAction asks a yes/no question. An empty answer returns defaultYes,
+// which the prompt shows as (Y/n) or (y/N).
+func confirmAction(prompt string, defaultYes bool) bool {
+	choices := "y/N"
+	if defaultYes {
+		choices = "Y/n"
+	}
+	if promptsDisabled {
+		fmt.Fprintf(console, "%s (declined: no one to confirm)\n", prompt)
+		return false
+	}
+	fmt.Fprintf(console, "%s (%s): ", prompt, choices)
+	scanner := stdinScanner
 	if scanner.Scan() {
-		return strings.ToLower(strings.TrimSpace(scanner.Text())) == "y"
+		answer := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if answer == "" {
+			return defaultYes
+		}
+		return answer == "y"
+	}
+	return false
+}
+
+// autoApproved reports whether Config.ConfirmDestructiveOnly lets an EDIT of
+// filename run without asking. Reads, listings and searches never ask; of the
+// actions that do, only creating a new file inside the working tree and
+// outside .git is not destructive. A dangling symlink counts as existing.
+func autoApproved(config *Config, filename string) bool {
+	if !config.ConfirmDestructiveOnly {
+		return false
+	}
+	if _, err := os.Lstat(filename); err == nil {
+		return false
+	}
+	return inWorkTree(filename)
+}
+
+// inWorkTree reports whether path lies inside the working directory and
+// outside its .git directory. Symlinks in the part of the path that exists
+// are resolved, so a linked directory can't lead outside.
+func inWorkTree(path string) bool {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return false
+	}
+	if cwd, err = filepath.EvalSymlinks(cwd); err != nil {
+		return false
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	// Resolve the deepest existing ancestor and keep the rest as written.
+	dir, rest := abs, ""
+	for {
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			abs = filepath.Join(resolved, rest)
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return false
+		}
+		dir, rest = parent, filepath.Join(filepath.Base(dir), rest)
+	}
+	rel, err := filepath.Rel(cwd, abs)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false
+	}
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		if part == ".git" {
+			return false
+		}
+	}
+	return true
+}
+
+// confirmDefault returns the answer an empty confirmation should mean.
+// Destructive actions (overwrites, deletions, commands) always default to no.
+func confirmDefault(config *Config, destructive bool) bool {
+	return config.DefaultConfirm && !destructive
+}
+
+// approvedFiles holds files the user approved with "yes to all" during the
+// current response's action batch. handleResponse resets it for every batch.
+var approvedFiles = map[string]bool{}
+
+// confirmFileAction is like confirmAction but also offers "a" to approve every
+// remaining action on filename for the rest of the batch.
+func confirmFileAction(prompt, filename string, defaultYes bool) bool {
+	if approvedFiles[filename] {
+		fmt.Fprintf(console, "%s (approved for all actions on %s)\n", prompt, filename)
+		return true
+	}
+	choices := "y/N/a"
+	if defaultYes {
+		choices = "Y/n/a"
+	}
+	if promptsDisabled {
+		fmt.Fprintf(console, "%s (declined: no one to confirm)\n", prompt)
+		return false
+	}
+	fmt.Fprintf(console, "%s (%s, a = yes to all for %s): ", prompt, choices, filename)
+	scanner := stdinScanner
+	if scanner.Scan() {
+		switch strings.ToLower(strings.TrimSpace(scanner.Text())) {
+		case "":
+			return defaultYes
+		case "y":
+			return true
+		case "a":
+			approvedFiles[filename] = true
+			return true
+		}
 	}
 	return false
 }
@@ -263,13 +963,54 @@ func confirmAction(prompt string) bool {
 type Block struct {
 	ID    int
 	Lines []string
+	// Separator holds the delimiter line(s) that ended this block when a custom
+	// BlockDelimiter is configured. It is empty for blank-line separated blocks.
+	Separator string
 }
 
 func parseBlocks(content string) []Block {
+	return splitBlocks(content, nil)
+}
+
+// blockDelimiter compiles config.BlockDelimiter, returning nil for the default blank-line behavior.
+func blockDelimiter(config *Config) (*regexp.Regexp, error) {
+	if config.BlockDelimiter == "" {
+		return nil, nil
+	}
+	return regexp.Compile(config.BlockDelimiter)
+}
+
+// splitBlocks splits content into blocks. With a nil delimiter, blocks are runs of
+// non-empty lines. Otherwise every line matching delimiter ends the current block
+// and is recorded as its Separator so blocksToString can rebuild the file.
+func splitBlocks(content string, delimiter *regexp.Regexp) []Block {
 	lines := strings.Split(content, "\n")
 	var blocks []Block
 	var currentLines []string
 
+	if delimiter != nil {
+		if len(lines) > 0 && lines[len(lines)-1] == "" {
+			lines = lines[:len(lines)-1]
+		}
+		for _, line := range lines {
+			if !delimiter.MatchString(line) {
+				currentLines = append(currentLines, line)
+				continue
+			}
+			if len(currentLines) == 0 && len(blocks) > 0 {
+				// Consecutive delimiters stay attached to the previous block.
+				blocks[len(blocks)-1].Separator += "\n" + line
+				continue
+			}
+			blocks = append(blocks, Block{ID: len(blocks), Lines: currentLines, Separator: line})
+			currentLines = nil
+		}
+		if len(currentLines) > 0 {
+			blocks = append(blocks, Block{ID: len(blocks), Lines: currentLines})
+		}
+		return blocks
+	}
+
 	for _, line := range lines {
 		if strings.TrimSpace(line) == "" {
 			if len(currentLines) > 0 {
@@ -293,7 +1034,10 @@ func blocksToString(blocks []Block) string {
 			sb.WriteString(line)
 			sb.WriteString("\n")
 		}
-		if i < len(blocks)-1 {
+		if b.Separator != "" {
+			sb.WriteString(b.Separator)
+			sb.WriteString("\n")
+		} else if i < len(blocks)-1 {
 			sb.WriteString("\n")
 		}
 	}
@@ -308,20 +1052,68 @@ type PatchAction struct {
 	Filename string
 	ID       int
 	Content  string
+	// Expect is the first line the model expects block ID to start with. When
+	// it doesn't match, the patch goes to the one block that does, or aborts.
+	Expect string
+}
+
+// firstLine returns the first non-blank line of b, trimmed.
+func (b Block) firstLine() string {
+	for _, line := range b.Lines {
+		if trimmed := strings.TrimSpace(line); trimmed != "" {
+			return trimmed
+		}
+	}
+	return ""
+}
+
+// resolveBlock checks the patch's Expect fingerprint against blocks and
+// returns the ID of the block to patch.
+func (p PatchAction) resolveBlock(blocks []Block) (int, error) {
+	if p.ID >= 0 && p.ID < len(blocks) && (p.Expect == "" || blocks[p.ID].firstLine() == p.Expect) {
+		return p.ID, nil
+	}
+	if p.Expect == "" {
+		return 0, fmt.Errorf("block ID %d not found in %s", p.ID, p.Filename)
+	}
+	match := -1
+	for i, b := range blocks {
+		if b.firstLine() == p.Expect {
+			if match != -1 {
+				return 0, fmt.Errorf("block %d of %s does not start with %q and several blocks do; read the file again", p.ID, p.Filename, p.Expect)
+			}
+			match = i
+		}
+	}
+	if match == -1 {
+		return 0, fmt.Errorf("no block of %s starts with %q; the file changed since it was read, read it again", p.Filename, p.Expect)
+	}
+	return match, nil
 }
 
 func (p PatchAction) Execute(client AIClient, config *Config, isToolCall bool) (string, error) {
-	if config.AutoEdit || confirmAction(fmt.Sprintf("Apply patch to block %d in %s?", p.ID, p.Filename)) {
-		content, err := os.ReadFile(p.Filename)
+	deletesBlock := strings.TrimSpace(p.Content) == ""
+	if config.AutoEdit || confirmFileAction(fmt.Sprintf("Apply patch to block %d in %s?", p.ID, p.Filename), p.Filename, confirmDefault(config, deletesBlock)) {
+		content, crlf, err := readTextFile(p.Filename)
 		if err != nil {
-			fmt.Printf("Error reading %s: %v\n", p.Filename, err)
+			logError("Error reading %s: %v", p.Filename, err)
 			return fmt.Sprintf("Error reading %s: %v", p.Filename, err), err
 		}
 
-		blocks := parseBlocks(string(content))
-		if p.ID < 0 || p.ID >= len(blocks) {
-			fmt.Printf("Error: Block ID %d not found in %s\n", p.ID, p.Filename)
-			return fmt.Sprintf("Error: Block ID %d not found in %s", p.ID, p.Filename), fmt.Errorf("block id not found")
+		delimiter, err := blockDelimiter(config)
+		if err != nil {
+			logError("Error: Invalid block delimiter: %v", err)
+			return fmt.Sprintf("Error: Invalid block delimiter: %v", err), err
+		}
+		blocks := splitBlocks(content, delimiter)
+		id, err := p.resolveBlock(blocks)
+		if err != nil {
+			logError("Error: %v", err)
+			return fmt.Sprintf("Error: %v", err), err
+		}
+		if id != p.ID {
+			logWarn("Block %d of %s moved to block %d; patching block %d.", p.ID, p.Filename, id, id)
+			p.ID = id
 		}
 
 		// Update block
@@ -339,15 +1131,15 @@ func (p PatchAction) Execute(client AIClient, config *Config, isToolCall bool) (
 		}
 
 		newContent := blocksToString(blocks)
-		if err := os.WriteFile(p.Filename, []byte(newContent), 0644); err != nil {
-			fmt.Printf("Error writing %s: %v\n", p.Filename, err)
+		if err := writeTextFile(p.Filename, newContent, crlf, config); err != nil {
+			logError("Error writing %s: %v", p.Filename, err)
 			return fmt.Sprintf("Error writing %s: %v", p.Filename, err), err
 		}
-		fmt.Printf("File %s patched successfully.\n", p.Filename)
+		fmt.Fprintf(console, "File %s patched successfully.\n", p.Filename)
 		return fmt.Sprintf("File %s patched successfully.", p.Filename), nil
 	} else {
-		fmt.Printf("Patch on %s skipped.\n", p.Filename)
-		return fmt.Sprintf("Patch on %s skipped.", p.Filename), nil
+		fmt.Fprintf(console, "Patch on %s skipped.\n", p.Filename)
+		return fmt.Sprintf("Patch on %s skipped.", p.Filename), errSkipped
 	}
 }
 
@@ -357,16 +1149,19 @@ type EditAction struct {
 }
 
 func (e EditAction) Execute(client AIClient, config *Config, isToolCall bool) (string, error) {
-	if config.AutoEdit || confirmAction(fmt.Sprintf("Overwrite/Create %s?", e.Filename)) {
-		if err := os.WriteFile(e.Filename, []byte(e.Content), 0644); err != nil {
-			fmt.Printf("Error writing %s: %v\n", e.Filename, err)
+	_, statErr := os.Stat(e.Filename)
+	overwrites := statErr == nil
+	if config.AutoEdit || autoApproved(config, e.Filename) || confirmFileAction(fmt.Sprintf("Overwrite/Create %s?", e.Filename), e.Filename, confirmDefault(config, overwrites)) {
+		crlf := overwrites && usesCRLF(e.Filename)
+		if err := writeTextFile(e.Filename, e.Content, crlf, config); err != nil {
+			logError("Error writing %s: %v", e.Filename, err)
 			return fmt.Sprintf("Error writing %s: %v", e.Filename, err), err
 		}
-		fmt.Printf("File %s written successfully.\n", e.Filename)
+		fmt.Fprintf(console, "File %s written successfully.\n", e.Filename)
 		return fmt.Sprintf("File %s written successfully.", e.Filename), nil
 	} else {
-		fmt.Printf("Write on %s skipped.\n", e.Filename)
-		return fmt.Sprintf("Write on %s skipped.", e.Filename), nil
+		fmt.Fprintf(console, "Write on %s skipped.\n", e.Filename)
+		return fmt.Sprintf("Write on %s skipped.", e.Filename), errSkipped
 	}
 }
 
@@ -375,24 +1170,32 @@ type RunAction struct {
 }
 
 func (r RunAction) Execute(client AIClient, config *Config, isToolCall bool) (string, error) {
-	if config.AutoRun || confirmAction(fmt.Sprintf("Execute command: %s?", r.Command)) {
+	if config.AutoRun || confirmAction(fmt.Sprintf("Execute command: %s?", r.Command), confirmDefault(config, true)) {
 		var outputBuf bytes.Buffer
-		cmd := exec.Command("bash", "-c", r.Command)
-		cmd.Stdout = io.MultiWriter(os.Stdout, &outputBuf)
+		cmd := shellCommand(config, r.Command)
+		cmd.Env = runEnv(config)
+		// With a human watching, let them answer the command's prompts. Tool
+		// calls run unattended, so their stdin stays at /dev/null and a command
+		// waiting for input gets EOF instead of hanging the loop.
+		if !isToolCall {
+			cmd.Stdin = os.Stdin
+		}
+		cmd.Stdout = io.MultiWriter(console, &outputBuf)
 		cmd.Stderr = io.MultiWriter(os.Stderr, &outputBuf)
 		err := cmd.Run()
 		if err != nil {
-			fmt.Printf("Command failed with error: %v\n", err)
+			logError("Command failed with error: %v", err)
 			return fmt.Sprintf("Command failed: %s\nError: %v", r.Command, err), err
 		}
-		output := outputBuf.String()
+		// The terminal already showed the colors; keep escape codes out of the model's context.
+		output := stripANSI(outputBuf.String())
 		if output != "" {
 			return "Command output:\n" + output, nil
 		}
 		return "Command executed successfully (no output).", nil
 	} else {
-		fmt.Printf("Command skipped: %s\n", r.Command)
-		return fmt.Sprintf("Command skipped: %s", r.Command), nil
+		fmt.Fprintf(console, "Command skipped: %s\n", r.Command)
+		return fmt.Sprintf("Command skipped: %s", r.Command), errSkipped
 	}
 }
 
@@ -401,15 +1204,34 @@ type ReadAction struct {
 }
 
 func (r ReadAction) Execute(client AIClient, config *Config, isToolCall bool) (string, error) {
-	content, err := os.ReadFile(r.Filename)
+	content, _, err := readTextFile(r.Filename)
 	if err != nil {
-		fmt.Printf("Error reading %s: %v\n", r.Filename, err)
+		logError("Error reading %s: %v", r.Filename, err)
 		return fmt.Sprintf("Error reading %s: %v", r.Filename, err), err
 	}
+	text, ok := guardRead(r.Filename, content, config)
+	if !ok {
+		return fmt.Sprintf("The user declined to share %s.", r.Filename), fmt.Errorf("read of %s declined: %w", r.Filename, errSkipped)
+	}
+
+	delimiter, err := blockDelimiter(config)
+	if err != nil {
+		logError("Error: Invalid block delimiter: %v", err)
+		return fmt.Sprintf("Error: Invalid block delimiter: %v", err), err
+	}
+	if config.PinReads && text == content {
+		pinFile(r.Filename)
+	}
+
+	fmt.Fprintf(console, "Content of %s displayed in blocks.\n", r.Filename)
+	return formatBlocks(r.Filename, text, delimiter), nil
+}
 
-	blocks := parseBlocks(string(content))
+// formatBlocks renders content the way READ shows it to the model.
+func formatBlocks(filename, content string, delimiter *regexp.Regexp) string {
+	blocks := splitBlocks(content, delimiter)
 	var sb strings.Builder
-	sb.WriteString(fmt.Sprintf("Content of %s (split into blocks):\n", r.Filename))
+	sb.WriteString(fmt.Sprintf("Content of %s (split into blocks):\n", filename))
 	for _, b := range blocks {
 		sb.WriteString(fmt.Sprintf("--- BLOCK %d ---\n", b.ID))
 		for _, line := range b.Lines {
@@ -417,9 +1239,7 @@ func (r ReadAction) Execute(client AIClient, config *Config, isToolCall bool) (s
 			sb.WriteString("\n")
 		}
 	}
-
-	fmt.Printf("Content of %s displayed in blocks.\n", r.Filename)
-	return sb.String(), nil
+	return sb.String()
 }
 
 type ReadRawAction struct {
@@ -427,76 +1247,122 @@ type ReadRawAction struct {
 }
 
 func (r ReadRawAction) Execute(client AIClient, config *Config, isToolCall bool) (string, error) {
-	content, err := os.ReadFile(r.Filename)
+	content, _, err := readTextFile(r.Filename)
 	if err != nil {
-		fmt.Printf("Error reading %s: %v\n", r.Filename, err)
+		logError("Error reading %s: %v", r.Filename, err)
 		return fmt.Sprintf("Error reading %s: %v", r.Filename, err), err
 	}
-	fmt.Printf("Content of %s displayed raw.\n", r.Filename)
-	return fmt.Sprintf("Content of %s:\n%s", r.Filename, string(content)), nil
+	text, ok := guardRead(r.Filename, content, config)
+	if !ok {
+		return fmt.Sprintf("The user declined to share %s.", r.Filename), fmt.Errorf("read of %s declined: %w", r.Filename, errSkipped)
+	}
+	fmt.Fprintf(console, "Content of %s displayed raw.\n", r.Filename)
+	return fmt.Sprintf("Content of %s:\n%s", r.Filename, text), nil
 }
 
 type ReplaceAction struct {
 	Filename string
 	Old      string
 	New      string
+	// Regex treats Old as a regular expression; New may reference groups as $1.
+	Regex bool
+	// All replaces every regex match instead of only the first.
+	All bool
 }
 
 func (r ReplaceAction) Execute(client AIClient, config *Config, isToolCall bool) (string, error) {
-	if config.AutoEdit || confirmAction(fmt.Sprintf("Replace content in %s?", r.Filename)) {
-		content, err := os.ReadFile(r.Filename)
+	sContent, crlf, err := readTextFile(r.Filename)
+	if err != nil {
+		logError("Error reading %s: %v", r.Filename, err)
+		return fmt.Sprintf("Error reading %s: %v", r.Filename, err), err
+	}
+
+	var newContent string
+	if r.Regex {
+		re, err := regexp.Compile(r.Old)
 		if err != nil {
-			fmt.Printf("Error reading %s: %v\n", r.Filename, err)
-			return fmt.Sprintf("Error reading %s: %v", r.Filename, err), err
+			return fmt.Sprintf("Error: Invalid search regex for %s: %v", r.Filename, err), err
 		}
-
-		sContent := string(content)
+		loc := re.FindStringSubmatchIndex(sContent)
+		if loc == nil {
+			return fmt.Sprintf("Error: Search regex matched nothing in %s", r.Filename), fmt.Errorf("content not found")
+		}
+		if r.All {
+			newContent = re.ReplaceAllString(sContent, r.New)
+		} else {
+			replacement := re.ExpandString(nil, r.New, sContent, loc)
+			newContent = sContent[:loc[0]] + string(replacement) + sContent[loc[1]:]
+		}
+	} else {
 		if !strings.Contains(sContent, r.Old) {
 			return fmt.Sprintf("Error: Original content not found in %s", r.Filename), fmt.Errorf("content not found")
 		}
 
-		if strings.Count(sContent, r.Old) > 1 {
-			return fmt.Sprintf("Error: Original content found multiple times in %s. Please provide more context.", r.Filename), fmt.Errorf("multiple occurrences")
-		}
+		newContent = strings.Replace(sContent, r.Old, r.New, 1)
+	}
 
-		newContent := strings.Replace(sContent, r.Old, r.New, 1)
-		if err := os.WriteFile(r.Filename, []byte(newContent), 0644); err != nil {
-			fmt.Printf("Error writing %s: %v\n", r.Filename, err)
+	if !config.AutoEdit {
+		// Show exactly which lines the match covers before asking.
+		fmt.Fprint(console, changePreview(sContent, newContent))
+	}
+	if config.AutoEdit || confirmFileAction(fmt.Sprintf("Replace content in %s?", r.Filename), r.Filename, confirmDefault(config, false)) {
+		if err := writeTextFile(r.Filename, newContent, crlf, config); err != nil {
+			logError("Error writing %s: %v", r.Filename, err)
 			return fmt.Sprintf("Error writing %s: %v", r.Filename, err), err
 		}
-		fmt.Printf("File %s updated successfully.\n", r.Filename)
+		fmt.Fprintf(console, "File %s updated successfully.\n", r.Filename)
 		return fmt.Sprintf("File %s updated successfully.", r.Filename), nil
 	} else {
-		fmt.Printf("Replace on %s skipped.\n", r.Filename)
-		return fmt.Sprintf("Replace on %s skipped.", r.Filename), nil
+		fmt.Fprintf(console, "Replace on %s skipped.\n", r.Filename)
+		return fmt.Sprintf("Replace on %s skipped.", r.Filename), errSkipped
 	}
 }
 
 type ListFilesAction struct {
-	Directory string
+	Path string
 }
 
 func (l ListFilesAction) Execute(client AIClient, config *Config, isToolCall bool) (string, error) {
-	dir := l.Directory
+	dir := l.Path
 	if dir == "" {
 		dir = "."
 	}
+	output, err := listFiles(dir, os.DirFS(dir))
+	if err != nil {
+		return fmt.Sprintf("Error listing files: %v", err), err
+	}
+	return output, nil
+}
+
+// listFiles lists the files in fsys, which is the directory dir, one path
+// under dir per line, skipping .git and node_modules. Entries that can't be
+// read are noted at the end instead of ending the listing; only an
+// unreadable dir itself is an error.
+func listFiles(dir string, fsys fs.FS) (string, error) {
 	var sb strings.Builder
-	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+	var skipped []string
+	err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
-			return err
+			if path == "." {
+				return err
+			}
+			skipped = append(skipped, fmt.Sprintf("%s (%v)", filepath.Join(dir, path), errors.Unwrap(err)))
+			return nil
 		}
-		if info.IsDir() && (info.Name() == ".git" || info.Name() == "node_modules") {
-			return filepath.SkipDir
+		if d.IsDir() && (d.Name() == ".git" || d.Name() == "node_modules") {
+			return fs.SkipDir
 		}
-		if !info.IsDir() {
-			sb.WriteString(path)
+		if !d.IsDir() {
+			sb.WriteString(filepath.Join(dir, path))
 			sb.WriteString("\n")
 		}
 		return nil
 	})
 	if err != nil {
-		return fmt.Sprintf("Error listing files: %v", err), err
+		return "", err
+	}
+	for _, entry := range skipped {
+		fmt.Fprintf(&sb, "[Could not read %s]\n", entry)
 	}
 	return sb.String(), nil
 }
@@ -505,226 +1371,70 @@ type SearchFilesAction struct {
 	Query string
 }
 
-func (s SearchFilesAction) Execute(client AIClient, config *Config, isToolCall bool) (string, error) {
-	cmd := exec.Command("grep", "-r", s.Query, ".")
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		if exitError, ok := err.(*exec.ExitError); ok && exitError.ExitCode() == 1 {
-			return "No matches found.", nil
-		}
-		return fmt.Sprintf("Error searching files: %v", err), err
-	}
-	return string(output), nil
+// wrapToolOutput delimits action output before it is sent to the model, so
+// structured output or text that looks like action tags can't be mistaken for
+// instructions. A closing tag inside the output is escaped to keep the block intact.
+func wrapToolOutput(description, output string) string {
+	output = strings.ReplaceAll(output, "</TOOL_OUTPUT>", "<\\/TOOL_OUTPUT>")
+	return fmt.Sprintf("<TOOL_OUTPUT action=%q>\n%s\n</TOOL_OUTPUT>", description, strings.TrimRight(output, "\n"))
 }
 
-func handleResponse(response string, client AIClient, config *Config) (string, bool) {
-	var actions []struct {
-		Action     Action
-		IsToolCall bool
+func handleResponse(ctx context.Context, response string, client AIClient, config *Config) (string, bool, []ActionResult) {
+	actions := parseActions(response)
+	approvedFiles = map[string]bool{}
+
+	limit := config.MaxActionsPerResponse
+	if limit <= 0 {
+		limit = defaultMaxActionsPerResponse
 	}
-	remainingResponse := response
+	if len(actions) > limit {
+		warning := fmt.Sprintf("Warning: response contained %d actions; only the first %d were executed.", len(actions), limit)
+		logWarn("%s", warning)
+		client.AddMessage("user", warning)
+		actions = actions[:limit]
+	}
+	config = confirmResponse(actions, config)
 
 	hasToolCall := false
 	var outputBuilder strings.Builder
+	var results []ActionResult
 
-	for {
-		patchStart := strings.Index(remainingResponse, "<PATCH>")
-		editStart := strings.Index(remainingResponse, "<EDIT>")
-		runStart := strings.Index(remainingResponse, "<RUN>")
-		readStart := strings.Index(remainingResponse, "<READ>")
-		readRawStart := strings.Index(remainingResponse, "<READ_RAW>")
-		replaceStart := strings.Index(remainingResponse, "<REPLACE>")
-		listStart := strings.Index(remainingResponse, "<LISTFILES>")
-		searchStart := strings.Index(remainingResponse, "<SEARCHFILES>")
-
-		if patchStart == -1 && editStart == -1 && runStart == -1 && readStart == -1 && readRawStart == -1 && replaceStart == -1 && listStart == -1 && searchStart == -1 {
-			break
-		}
-
-		type tagInfo struct {
-			start int
-			tag   string
-		}
-
-		firstTag := tagInfo{-1, ""}
-
-		checkTag := func(idx int, tag string) {
-			if idx != -1 && (firstTag.start == -1 || idx < firstTag.start) {
-				firstTag = tagInfo{idx, tag}
-			}
-		}
-
-		checkTag(patchStart, "PATCH")
-		checkTag(editStart, "EDIT")
-		checkTag(runStart, "RUN")
-		checkTag(readRawStart, "READ_RAW")
-		checkTag(readStart, "READ")
-		checkTag(replaceStart, "REPLACE")
-		checkTag(listStart, "LISTFILES")
-		checkTag(searchStart, "SEARCHFILES")
-
-		// Check for [TOOL_CALL] prefix
-		isToolCall := false
-		prefix := remainingResponse[:firstTag.start]
-		if strings.Contains(prefix, "[TOOL_CALL]") {
-			trimmedPrefix := strings.TrimSpace(prefix)
-			if strings.HasSuffix(trimmedPrefix, "[TOOL_CALL]") {
-				isToolCall = true
-				hasToolCall = true
-			}
-		}
-
-		var endTag, content string
-		var endIdx int
+	patches := patchIndexes(actions)
+	var tx *patchTransaction
+	if config.AtomicPatches && len(patches) > 1 {
+		tx = newPatchTransaction()
+	}
 
-		switch firstTag.tag {
-		case "PATCH":
-			endTag = "</PATCH>"
-			endIdx = strings.Index(remainingResponse, endTag)
-			if endIdx == -1 {
-				remainingResponse = remainingResponse[firstTag.start+len("<PATCH>"):]
-				continue
-			}
-			content = remainingResponse[firstTag.start+len("<PATCH>") : endIdx]
-			lines := strings.SplitN(strings.TrimSpace(content), "\n", 3)
-			if len(lines) >= 2 {
-				filename := strings.TrimSpace(lines[0])
-				idStr := strings.TrimSpace(lines[1])
-				id, err := strconv.Atoi(idStr)
-				if err == nil {
-					patchContent := ""
-					if len(lines) == 3 {
-						patchContent = lines[2]
-					}
-					actions = append(actions, struct {
-						Action     Action
-						IsToolCall bool
-					}{PatchAction{Filename: filename, ID: id, Content: patchContent}, isToolCall})
-				}
-			}
-		case "EDIT":
-			endTag = "</EDIT>"
-			endIdx = strings.Index(remainingResponse, endTag)
-			if endIdx == -1 {
-				remainingResponse = remainingResponse[firstTag.start+len("<EDIT>"):]
-				continue
-			}
-			content = remainingResponse[firstTag.start+len("<EDIT>") : endIdx]
-			lines := strings.SplitN(strings.TrimSpace(content), "\n", 2)
-			if len(lines) == 2 {
-				filename := strings.TrimSpace(lines[0])
-				fileContent := lines[1]
-				actions = append(actions, struct {
-					Action     Action
-					IsToolCall bool
-				}{EditAction{Filename: filename, Content: fileContent}, isToolCall})
-			}
-		case "RUN":
-			endTag = "</RUN>"
-			endIdx = strings.Index(remainingResponse, endTag)
-			if endIdx == -1 {
-				remainingResponse = remainingResponse[firstTag.start+len("<RUN>"):]
-				continue
-			}
-			content = remainingResponse[firstTag.start+len("<RUN>") : endIdx]
-			actions = append(actions, struct {
-				Action     Action
-				IsToolCall bool
-			}{RunAction{Command: strings.TrimSpace(content)}, isToolCall})
-		case "READ":
-			endTag = "</READ>"
-			endIdx = strings.Index(remainingResponse, endTag)
-			if endIdx == -1 {
-				remainingResponse = remainingResponse[firstTag.start+len("<READ>"):]
-				continue
-			}
-			content = remainingResponse[firstTag.start+len("<READ>") : endIdx]
-			actions = append(actions, struct {
-				Action     Action
-				IsToolCall bool
-			}{ReadAction{Filename: strings.TrimSpace(content)}, isToolCall})
-		case "READ_RAW":
-			endTag = "</READ_RAW>"
-			endIdx = strings.Index(remainingResponse, endTag)
-			if endIdx == -1 {
-				remainingResponse = remainingResponse[firstTag.start+len("<READ_RAW>"):]
-				continue
-			}
-			content = remainingResponse[firstTag.start+len("<READ_RAW>") : endIdx]
-			actions = append(actions, struct {
-				Action     Action
-				IsToolCall bool
-			}{ReadRawAction{Filename: strings.TrimSpace(content)}, isToolCall})
-		case "REPLACE":
-			endTag = "</REPLACE>"
-			endIdx = strings.Index(remainingResponse, endTag)
-			if endIdx == -1 {
-				remainingResponse = remainingResponse[firstTag.start+len("<REPLACE>"):]
-				continue
-			}
-			content = remainingResponse[firstTag.start+len("<REPLACE>") : endIdx]
-			lines := strings.SplitN(strings.TrimSpace(content), "\n", 2)
-			if len(lines) >= 2 {
-				filename := strings.TrimSpace(lines[0])
-				rest := lines[1]
-
-				searchMarker := "<<<<<<< SEARCH"
-				midMarker := "======="
-				endMarker := ">>>>>>>"
-
-				sIdx := strings.Index(rest, searchMarker)
-				mIdx := strings.Index(rest, midMarker)
-				eIdx := strings.Index(rest, endMarker)
-
-				if sIdx != -1 && mIdx != -1 && eIdx != -1 && mIdx > sIdx && eIdx > mIdx {
-					oldContent := strings.Trim(rest[sIdx+len(searchMarker):mIdx], "\n")
-					newContent := strings.Trim(rest[mIdx+len(midMarker):eIdx], "\n")
-					actions = append(actions, struct {
-						Action     Action
-						IsToolCall bool
-					}{ReplaceAction{Filename: filename, Old: oldContent, New: newContent}, isToolCall})
-				}
-			}
-		case "LISTFILES":
-			endTag = "</LISTFILES>"
-			endIdx = strings.Index(remainingResponse, endTag)
-			if endIdx == -1 {
-				remainingResponse = remainingResponse[firstTag.start+len("<LISTFILES>"):]
-				continue
-			}
-			content = remainingResponse[firstTag.start+len("<LISTFILES>") : endIdx]
-			actions = append(actions, struct {
-				Action     Action
-				IsToolCall bool
-			}{ListFilesAction{Directory: strings.TrimSpace(content)}, isToolCall})
-		case "SEARCHFILES":
-			endTag = "</SEARCHFILES>"
-			endIdx = strings.Index(remainingResponse, endTag)
-			if endIdx == -1 {
-				remainingResponse = remainingResponse[firstTag.start+len("<SEARCHFILES>"):]
-				continue
-			}
-			content = remainingResponse[firstTag.start+len("<SEARCHFILES>") : endIdx]
-			actions = append(actions, struct {
-				Action     Action
-				IsToolCall bool
-			}{SearchFilesAction{Query: strings.TrimSpace(content)}, isToolCall})
+	// Read-only actions run concurrently; everything else runs alone, in order.
+	// Outputs are collected first and then handled in the original order.
+	outputs := make([]string, len(actions))
+	batch := make([]ActionResult, len(actions))
+	runInOrder(len(actions), func(i int) bool { return readOnlyAction(actions[i].Action) }, maxConcurrentActions(config), func(i int) {
+		execute := func() (string, ActionResult) { return executeAction(ctx, actions[i], client, config) }
+		if patch, ok := actions[i].Action.(PatchAction); ok && tx != nil {
+			tx.run(i, patch.Filename, execute, outputs, batch)
+			return
 		}
+		outputs[i], batch[i] = execute()
+	})
 
-		if endIdx != -1 {
-			remainingResponse = remainingResponse[endIdx+len(endTag):]
+	for i, item := range actions {
+		output, result := outputs[i], batch[i]
+		results = append(results, result)
+		recordAction(result)
+		output = truncateOutput(output, outputLimit(config, actionType(item.Action)))
+		output = wrapToolOutput(describeAction(item.Action), output)
+		if len(patches) > 1 && i == patches[len(patches)-1] {
+			output += "\n" + patchSummary(actions, patches, batch)
 		}
-	}
-
-	for _, item := range actions {
-		output, _ := item.Action.Execute(client, config, item.IsToolCall)
 		if item.IsToolCall {
+			hasToolCall = true
 			outputBuilder.WriteString(output)
 			outputBuilder.WriteString("\n")
 		} else {
-			client.AddMessage("user", output)
+			addToolOutput(client, output)
 		}
 	}
 
-	return outputBuilder.String(), hasToolCall
+	return outputBuilder.String(), hasToolCall, results
 }
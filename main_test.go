@@ -0,0 +1,162 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigBacksUpInvalidJSON(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.json")
+	broken := `{"api_keys": {"openai": "sk-test"},`
+	if err := os.WriteFile(configFile, []byte(broken), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := loadConfig(configFile)
+	if err != nil {
+		t.Fatalf("loadConfig failed: %v", err)
+	}
+	if len(config.APIKeys) != 0 || config.SelectedModel != "" {
+		t.Errorf("Expected default settings, got %+v", config)
+	}
+	if _, err := os.Stat(configFile); !os.IsNotExist(err) {
+		t.Errorf("Expected %s to be moved away, got %v", configFile, err)
+	}
+	data, err := os.ReadFile(configFile + ".bak")
+	if err != nil || string(data) != broken {
+		t.Errorf("Expected the broken config in the backup, got %q (%v)", data, err)
+	}
+}
+
+func TestNormalizeModelProviderDefaults(t *testing.T) {
+	for _, provider := range knownProviders {
+		model := normalizeModel(provider)
+		if model == provider || detectProvider(model) != provider {
+			t.Errorf("normalizeModel(%q) = %q, served by %q", provider, model, detectProvider(model))
+		}
+	}
+	if model := normalizeModel("gpt-4.1"); model != "gpt-4.1" {
+		t.Errorf("Expected a model name to be kept, got %q", model)
+	}
+}
+
+func TestResolveProviderDefaultProvider(t *testing.T) {
+	tests := []struct {
+		model, defaultProvider, want string
+	}{
+		{"llama3", "openrouter", "openrouter"},
+		{"llama3", "", ""},
+		{"llama3", "no-such-provider", ""},
+		// Known models and prefixes still route to their own provider.
+		{"gpt-4o", "openrouter", "openai"},
+		{"grok-3", "gemini", "grok"},
+	}
+	for _, tt := range tests {
+		config := &Config{SelectedModel: tt.model, DefaultProvider: tt.defaultProvider}
+		if got := resolveProvider(config); got != tt.want {
+			t.Errorf("resolveProvider(%q, default %q) = %q, want %q", tt.model, tt.defaultProvider, got, tt.want)
+		}
+	}
+}
+
+func TestMissingAPIKeyMessage(t *testing.T) {
+	if got := apiKeyEnv("openrouter"); got != "ARISU_OPENROUTER_API_KEY" {
+		t.Errorf("apiKeyEnv = %q", got)
+	}
+	msg := missingAPIKeyMessage("openai", "/home/me/.config/arisu/config.json")
+	for _, want := range []string{"ARISU_OPENAI_API_KEY", "/home/me/.config/arisu/config.json", "not a terminal"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("Expected %q in %q", want, msg)
+		}
+	}
+}
+
+func TestReplaceThroughHandleResponse(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "main.go")
+	os.WriteFile(path, []byte("package main\n\nfunc greet() string { return \"hi\" }\n"), 0644)
+	response := "[TOOL_CALL] <REPLACE>\n" + path + "\n<<<<<<< SEARCH\nreturn \"hi\"\n=======\nreturn \"hello\"\n>>>>>>>\n</REPLACE>\n"
+
+	output, _, results := handleResponse(t.Context(), response, &scriptedClient{}, &Config{AutoEdit: true})
+	if len(results) != 1 || results[0].Status != statusApplied {
+		t.Fatalf("Expected the replace to apply, got %+v", results)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "package main\n\nfunc greet() string { return \"hello\" }\n" {
+		t.Errorf("Unexpected content %q", data)
+	}
+
+	// Sending the same replacement again finds nothing and tells the model so.
+	output, _, results = handleResponse(t.Context(), response, &scriptedClient{}, &Config{AutoEdit: true})
+	if results[0].Status != statusError || !strings.Contains(output, "Original content not found in "+path) {
+		t.Errorf("Expected a not-found error for the model, got %q", output)
+	}
+}
+
+func TestReplaceChangesOnlyTheFirstOccurrence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dup.txt")
+	if err := os.WriteFile(path, []byte("x = 1\nx = 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	response := "<REPLACE>\n" + path + "\n<<<<<<< SEARCH\nx = 1\n=======\nx = 2\n>>>>>>>\n</REPLACE>\n"
+
+	_, _, results := handleResponse(t.Context(), response, &scriptedClient{}, &Config{AutoEdit: true})
+	if len(results) != 1 || results[0].Status != statusApplied {
+		t.Fatalf("Expected the replace to apply, got %+v", results)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "x = 2\nx = 1\n" {
+		t.Errorf("Unexpected content %q", data)
+	}
+}
+
+func TestListFilesSkipsGitAndNodeModules(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"main.go", "web/app.js", "node_modules/lib/index.js", ".git/HEAD"} {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte("x"), 0644)
+	}
+
+	output, err := ListFilesAction{Path: dir}.Execute(nil, &Config{}, true)
+	if err != nil {
+		t.Fatalf("LISTFILES failed: %v", err)
+	}
+	want := filepath.Join(dir, "main.go") + "\n" + filepath.Join(dir, "web", "app.js") + "\n"
+	if output != want {
+		t.Errorf("LISTFILES = %q, want %q", output, want)
+	}
+}
+
+// lockedFS fails to read the directory locked, like one without read
+// permission; permissions alone don't stop tests running as root.
+type lockedFS struct {
+	fs.FS
+	locked string
+}
+
+func (l lockedFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if name == l.locked {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrPermission}
+	}
+	return fs.ReadDir(l.FS, name)
+}
+
+func TestListFilesSkipsUnreadableDirectories(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.go", "locked/secret.go", "z/b.go"} {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte("x"), 0644)
+	}
+
+	output, err := listFiles(dir, lockedFS{FS: os.DirFS(dir), locked: "locked"})
+	if err != nil {
+		t.Fatalf("listFiles failed: %v", err)
+	}
+	want := filepath.Join(dir, "a.go") + "\n" + filepath.Join(dir, "z", "b.go") + "\n" +
+		"[Could not read " + filepath.Join(dir, "locked") + " (permission denied)]\n"
+	if output != want {
+		t.Errorf("listFiles = %q, want %q", output, want)
+	}
+}
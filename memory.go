@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// memoryFile is the project memory, relative to the working directory.
+const memoryFile = ".arisu/memory.md"
+
+// defaultMemoryMaxBytes caps the project memory by default.
+const defaultMemoryMaxBytes = 8000
+
+// projectMemory is Config.ProjectMemory. It is set once at startup and makes
+// the system prompt document MEMORY_APPEND and include the memory file.
+var projectMemory bool
+
+// memoryMaxBytes returns Config.MemoryMaxBytes, or the default.
+func memoryMaxBytes(config *Config) int {
+	if config.MemoryMaxBytes > 0 {
+		return config.MemoryMaxBytes
+	}
+	return defaultMemoryMaxBytes
+}
+
+// readMemory returns the project memory, or "" if there is none.
+func readMemory() string {
+	data, err := os.ReadFile(memoryFile)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// appendMemory adds note as a bullet to the memory file at path. When the
+// file grows past maxBytes, the oldest lines are dropped.
+func appendMemory(path, note string, maxBytes int) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	note = strings.Join(strings.Fields(note), " ")
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if lines[0] == "" {
+		lines = nil
+	}
+	lines = append(lines, "- "+note)
+	size := 0
+	for _, line := range lines {
+		size += len(line) + 1
+	}
+	for size > maxBytes && len(lines) > 1 {
+		size -= len(lines[0]) + 1
+		lines = lines[1:]
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
+
+// memoryPrompt is the system prompt section for the project memory.
+func memoryPrompt() string {
+	if !projectMemory {
+		return ""
+	}
+	var sb strings.Builder
+	if actionEnabled("MEMORY_APPEND") {
+		sb.WriteString("\nTo remember a fact about this project for future sessions (e.g. the build command, directories not to touch), use:\n" +
+			"<MEMORY_APPEND>one short fact</MEMORY_APPEND>\n" +
+			"Only record lasting, project-wide facts, not details of the current task.\n")
+	}
+	if memory := readMemory(); memory != "" {
+		fmt.Fprintf(&sb, "\nProject memory (%s), facts recorded in earlier sessions:\n%s\n", memoryFile, memory)
+	}
+	return sb.String()
+}
+
+type MemoryAppendAction struct {
+	Note string
+}
+
+func (m MemoryAppendAction) Execute(client AIClient, config *Config, isToolCall bool) (string, error) {
+	if !config.ProjectMemory {
+		return "Project memory is disabled; nothing was recorded.", errSkipped
+	}
+	if m.Note == "" {
+		return "Error: empty memory note.", fmt.Errorf("empty memory note")
+	}
+	if config.AutoEdit || confirmAction(fmt.Sprintf("Add to project memory: %q?", m.Note), confirmDefault(config, false)) {
+		if err := appendMemory(memoryFile, m.Note, memoryMaxBytes(config)); err != nil {
+			logError("Error writing %s: %v", memoryFile, err)
+			return fmt.Sprintf("Error writing %s: %v", memoryFile, err), err
+		}
+		fmt.Fprintf(console, "Added to %s.\n", memoryFile)
+		return fmt.Sprintf("Added to %s.", memoryFile), nil
+	}
+	fmt.Fprintln(console, "Memory note skipped.")
+	return "Memory note skipped.", errSkipped
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAppendMemoryCapsSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".arisu", "memory.md")
+	if err := appendMemory(path, "build with make", 45); err != nil {
+		t.Fatalf("appendMemory failed: %v", err)
+	}
+	if err := appendMemory(path, "don't touch\nvendor/", 45); err != nil {
+		t.Fatalf("appendMemory failed: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if string(data) != "- build with make\n- don't touch vendor/\n" {
+		t.Fatalf("Unexpected memory %q", data)
+	}
+	appendMemory(path, "tests need docker", 45)
+	data, _ = os.ReadFile(path)
+	if string(data) != "- don't touch vendor/\n- tests need docker\n" {
+		t.Errorf("Expected the oldest fact to be dropped, got %q", data)
+	}
+}
+
+func TestParseMemoryAppend(t *testing.T) {
+	actions := parseActions("Noted.\n<MEMORY_APPEND>\nThe build command is make.\n</MEMORY_APPEND>")
+	if len(actions) != 1 {
+		t.Fatalf("Expected 1 action, got %d", len(actions))
+	}
+	if m, ok := actions[0].Action.(MemoryAppendAction); !ok || m.Note != "The build command is make." {
+		t.Errorf("Unexpected action %+v", actions[0].Action)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os/exec"
+	"runtime"
+	"sync"
+)
+
+// networkAllowed reports whether actions may use the network (the default).
+// Network-only actions should refuse to run when it returns false.
+func networkAllowed(config *Config) bool {
+	return config.AllowNetwork == nil || *config.AllowNetwork
+}
+
+var (
+	unshareOnce      sync.Once
+	unshareAvailable bool
+)
+
+// canUnshareNetwork reports whether commands can be started in an empty
+// network namespace with `unshare -rn`, which needs Linux with unprivileged
+// user namespaces enabled.
+func canUnshareNetwork() bool {
+	unshareOnce.Do(func() {
+		if runtime.GOOS != "linux" {
+			return
+		}
+		unshareAvailable = exec.Command("unshare", "-rn", "true").Run() == nil
+	})
+	return unshareAvailable
+}
+
+// shellCommand returns the command that runs command for RUN. Without network
+// access it is wrapped in `unshare -rn` where possible; elsewhere it runs
+// normally after a warning, since a shell can't be cut off the network portably.
+func shellCommand(config *Config, command string) *exec.Cmd {
+	if !networkAllowed(config) {
+		if canUnshareNetwork() {
+			return exec.Command("unshare", "-rn", "bash", "-c", command)
+		}
+		logWarn("Warning: allow_network is false but commands can't be isolated from the network here (needs Linux with unshare); running it anyway.")
+	}
+	return exec.Command("bash", "-c", command)
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestShellCommandWithoutNetwork(t *testing.T) {
+	if cmd := shellCommand(&Config{}, "true"); strings.Join(cmd.Args, " ") != "bash -c true" {
+		t.Errorf("Expected commands to run directly by default, got %q", cmd.Args)
+	}
+
+	denied := false
+	config := &Config{AllowNetwork: &denied}
+	cmd := shellCommand(config, "cat /proc/net/dev")
+	if !canUnshareNetwork() {
+		if strings.Join(cmd.Args, " ") != "bash -c cat /proc/net/dev" {
+			t.Errorf("Expected the command to run unwrapped where unshare is unavailable, got %q", cmd.Args)
+		}
+		t.Skip("unshare -rn is not available here")
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("command failed: %v", err)
+	}
+	// Only the loopback interface exists in an empty network namespace.
+	for _, line := range strings.Split(string(out), "\n")[2:] {
+		if name, _, ok := strings.Cut(strings.TrimSpace(line), ":"); ok && name != "lo" {
+			t.Errorf("Expected no network interfaces besides lo, found %q", name)
+		}
+	}
+}
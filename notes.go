@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// notesFile returns the scratchpad path kept next to the session file.
+func (s *session) notesFile() string {
+	if s.sessionFile == "" {
+		return ""
+	}
+	return strings.TrimSuffix(s.sessionFile, ".json") + ".notes.md"
+}
+
+// readNotes returns the session scratchpad, or "" if there is none.
+func (s *session) readNotes() string {
+	path := s.notesFile()
+	if path == "" {
+		return ""
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// addNote appends a line to the session scratchpad.
+func (s *session) addNote(note string) error {
+	path := s.notesFile()
+	if path == "" {
+		return fmt.Errorf("this session is not saved")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = fmt.Fprintf(f, "- %s\n", note)
+	return err
+}
+
+// notesContext returns the session scratchpad, sent ahead of each request so
+// decisions recorded with /note survive history truncation.
+func (s *session) notesContext() string {
+	notes := s.readNotes()
+	if notes == "" {
+		return ""
+	}
+	return "Session notes (decisions made so far; keep following them):\n" + notes + "\n\n"
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNotesAreStoredNextToTheSession(t *testing.T) {
+	sessionFile := filepath.Join(t.TempDir(), "session_1.json")
+	s := &session{sessionFile: sessionFile}
+	if got := s.notesFile(); got != strings.TrimSuffix(sessionFile, ".json")+".notes.md" {
+		t.Errorf("notesFile = %q", got)
+	}
+	for _, note := range []string{"use the X library", "keep the API stable"} {
+		if err := s.addNote(note); err != nil {
+			t.Fatalf("addNote failed: %v", err)
+		}
+	}
+	if got := s.readNotes(); got != "- use the X library\n- keep the API stable" {
+		t.Errorf("readNotes = %q", got)
+	}
+
+	if err := (&session{}).addNote("x"); err == nil {
+		t.Error("Expected notes to need a saved session")
+	}
+}
+
+func TestNotesAreNotKeptInHistory(t *testing.T) {
+	client := &scriptedClient{replies: []string{"one", "two", "three"}}
+	s := &session{client: client, config: &Config{}, sessionFile: filepath.Join(t.TempDir(), "session_1.json")}
+	s.addNote("use the X library")
+
+	for _, msg := range []Message{{Role: "user", Content: "first"}, {Role: "user", Content: "output", ToolOutput: true}, {Role: "user", Content: "second"}} {
+		if _, err := s.send(t.Context(), msg); err != nil {
+			t.Fatalf("send failed: %v", err)
+		}
+	}
+
+	for i, sent := range client.sent {
+		if strings.Count(sent, "use the X library") != 1 {
+			t.Errorf("Expected request %d to carry the notes once, got %q", i, sent)
+		}
+	}
+	for _, msg := range client.history {
+		if strings.Contains(msg.Content, "use the X library") {
+			t.Errorf("Expected the notes to stay out of the history, got %q", msg.Content)
+		}
+	}
+	if !client.history[2].ToolOutput {
+		t.Errorf("Expected the tool output flag to be kept, got %+v", client.history[2])
+	}
+}
@@ -2,8 +2,10 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
+	"net/http"
 	"strings"
 
 	"github.com/sashabaranov/go-openai"
@@ -11,26 +13,44 @@ import (
 
 // OpenAIClient representa um cliente para interação com a API da OpenAI.
 type OpenAIClient struct {
-	client     *openai.Client
-	model      string
-	history    []Message
-	maxHistory int
+	client        *openai.Client
+	model         string
+	history       []Message
+	maxHistory    int
+	context       contextLimit
+	reasoningTags []string
+	out           io.Writer
+	truncated     bool
+	showStats     bool
+	includeUsage  bool
+	usage         tokenUsage
 }
 
-// NewOpenAIClient inicializa um novo cliente OpenAI com a chave API e o modelo fornecidos.
-func NewOpenAIClient(apiKey, model string, maxHistory int) *OpenAIClient {
-	client := openai.NewClient(apiKey)
-	history := []Message{{Role: "system", Content: defaultSystemPrompt()}}
-	return &OpenAIClient{client: client, model: model, history: history, maxHistory: maxHistory}
+// NewOpenAIClient inicializa um novo cliente OpenAI com a chave API, o modelo e as opções fornecidos.
+func NewOpenAIClient(apiKey, model string, opts clientOptions) *OpenAIClient {
+	cfg := openai.DefaultConfig(apiKey)
+	if opts.baseURL != "" {
+		// Gateways internos expõem a mesma API sob outra URL base.
+		cfg.BaseURL = strings.TrimSuffix(opts.baseURL, "/")
+	}
+	if len(opts.extraBody) > 0 {
+		// O SDK não aceita campos arbitrários, então eles são mesclados no corpo JSON.
+		cfg.HTTPClient = extraBodyDoer{client: &http.Client{}, extra: opts.extraBody}
+	}
+	client := openai.NewClientWithConfig(cfg)
+	history := []Message{{Role: "system", Content: opts.systemPrompt}}
+	return &OpenAIClient{client: client, model: model, history: history, maxHistory: historyLimit(opts.maxHistory), context: newContextLimit(opts.maxContextTokens, model), reasoningTags: opts.reasoningTags, showStats: opts.showStats, includeUsage: opts.includeUsage, out: console}
 }
 
 // SendMessage envia uma mensagem para a API da OpenAI e transmite a resposta em tempo real.
-func (c *OpenAIClient) SendMessage(input string) (string, error) {
+func (c *OpenAIClient) SendMessage(ctx context.Context, input string) (string, error) {
 	// Truncate history if needed, keeping system prompt
 	if len(c.history) > c.maxHistory {
 		// Keep system prompt (index 0) and the last maxHistory-1 messages
+		logDebug("Truncating history from %d to %d messages", len(c.history), c.maxHistory)
 		c.history = append([]Message{c.history[0]}, c.history[len(c.history)-(c.maxHistory-1):]...)
 	}
+	c.history = c.context.fit(c.history, input)
 
 	c.history = append(c.history, Message{Role: "user", Content: input})
 
@@ -47,32 +67,64 @@ func (c *OpenAIClient) SendMessage(input string) (string, error) {
 		Messages: messages,
 		Stream:   true,
 	}
+	if c.includeUsage {
+		req.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+	}
+
+	if logThreshold <= levelDebug {
+		if payload, err := json.Marshal(req); err == nil {
+			logDebug("OpenAI request payload: %s", redactSecrets(string(payload)))
+		}
+	}
 
-	stream, err := c.client.CreateChatCompletionStream(context.Background(), req)
+	stats := startStreamStats()
+	stream, err := c.client.CreateChatCompletionStream(ctx, req)
 	if err != nil {
 		return "", err
 	}
 	defer stream.Close()
 
 	var fullResponse strings.Builder
+	c.truncated = false
+	c.usage = tokenUsage{}
+	var citations []string
 	for {
-		response, err := stream.Recv()
+		// O SDK descarta as anotações url_citation, então o pedaço é lido cru.
+		raw, err := stream.RecvRaw()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
 			return "", err
 		}
+		var response openai.ChatCompletionStreamResponse
+		if err := json.Unmarshal(raw, &response); err != nil {
+			return "", err
+		}
+		var chunk map[string]interface{}
+		if json.Unmarshal(raw, &chunk) == nil {
+			citations = append(citations, chunkCitations(chunk)...)
+		}
+		// Com include_usage, o último pedaço traz o uso de tokens e nenhuma escolha.
+		if response.Usage != nil {
+			c.usage = tokenUsage{Prompt: response.Usage.PromptTokens, Completion: response.Usage.CompletionTokens}
+		}
 		if len(response.Choices) > 0 {
 			content := response.Choices[0].Delta.Content
-			fmt.Print(content)
+			fmt.Fprint(c.out, content)
+			stats.add(content)
 			fullResponse.WriteString(content)
+			if response.Choices[0].FinishReason == openai.FinishReasonLength {
+				c.truncated = true
+			}
 		}
 	}
 
 	// Adiciona uma nova linha ao final da resposta
-	fmt.Print("\n")
-	responseText := fullResponse.String() + "\n"
+	fmt.Fprint(c.out, "\n")
+	fmt.Fprint(c.out, formatCitations(citations))
+	stats.report(c.showStats)
+	responseText := stripReasoning(fullResponse.String(), c.reasoningTags) + "\n"
 	c.history = append(c.history, Message{Role: "assistant", Content: responseText})
 	return responseText, nil
 }
@@ -86,3 +138,28 @@ func (c *OpenAIClient) AddMessage(role, content string) {
 func (c *OpenAIClient) GetHistory() []Message {
 	return c.history
 }
+
+// SetOutput define onde a resposta transmitida é escrita.
+func (c *OpenAIClient) SetOutput(w io.Writer) {
+	c.out = w
+}
+
+// SetHistory substitui a conversa, mantendo o prompt de sistema.
+func (c *OpenAIClient) SetHistory(messages []Message) {
+	c.history = append(c.history[:1:1], messages...)
+}
+
+// Close não faz nada; o cliente não mantém recursos entre requisições.
+func (c *OpenAIClient) Close() error {
+	return nil
+}
+
+// Truncated informa se a última resposta terminou com finish_reason "length".
+func (c *OpenAIClient) Truncated() bool {
+	return c.truncated
+}
+
+// Usage retorna o uso de tokens informado para a última resposta, se houver.
+func (c *OpenAIClient) Usage() tokenUsage {
+	return c.usage
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// streamMux serializes concurrent streams onto one writer so they don't
+// interleave. The first stream to write is shown live; the others are
+// buffered and shown, whole, once it is done, each after its header.
+type streamMux struct {
+	mu      sync.Mutex
+	out     io.Writer
+	active  *muxStream
+	pending []*muxStream
+}
+
+// muxStream is one stream of a streamMux. Close it when the stream ends.
+type muxStream struct {
+	mux    *streamMux
+	header string
+	buf    bytes.Buffer
+	done   bool
+}
+
+func newStreamMux(out io.Writer) *streamMux {
+	return &streamMux{out: out}
+}
+
+// stream starts a stream whose output is preceded by header.
+func (m *streamMux) stream(header string) *muxStream {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := &muxStream{mux: m, header: header}
+	m.pending = append(m.pending, s)
+	return s
+}
+
+func (s *muxStream) Write(p []byte) (int, error) {
+	m := s.mux
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.active == nil {
+		m.activate(s)
+	}
+	if m.active != s {
+		return s.buf.Write(p)
+	}
+	return m.out.Write(p)
+}
+
+// Close ends the stream and hands the writer to the next buffered stream.
+func (s *muxStream) Close() error {
+	m := s.mux
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s.done = true
+	if m.active == nil {
+		m.activate(s)
+	}
+	if m.active != s {
+		return nil
+	}
+	m.active = nil
+	// Waiting streams that finished are written out whole, until one that is
+	// still streaming takes over.
+	for {
+		next := m.nextPending()
+		if next == nil {
+			return nil
+		}
+		m.activate(next)
+		if !next.done {
+			return nil
+		}
+		m.active = nil
+	}
+}
+
+// nextPending returns the first waiting stream that has output or is done.
+func (m *streamMux) nextPending() *muxStream {
+	for _, s := range m.pending {
+		if s.done || s.buf.Len() > 0 {
+			return s
+		}
+	}
+	return nil
+}
+
+// activate makes s the live stream: its header and buffered output are written.
+func (m *streamMux) activate(s *muxStream) {
+	for i, p := range m.pending {
+		if p == s {
+			m.pending = append(m.pending[:i], m.pending[i+1:]...)
+			break
+		}
+	}
+	m.active = s
+	io.WriteString(m.out, s.header)
+	m.out.Write(s.buf.Bytes())
+	s.buf.Reset()
+}
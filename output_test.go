@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestStreamMuxSerializesStreams(t *testing.T) {
+	var out bytes.Buffer
+	mux := newStreamMux(&out)
+	a, b := mux.stream("[a]\n"), mux.stream("[b]\n")
+
+	a.Write([]byte("a1 "))
+	b.Write([]byte("b1 "))
+	a.Write([]byte("a2\n"))
+	b.Write([]byte("b2\n"))
+	if got := out.String(); got != "[a]\na1 a2\n" {
+		t.Fatalf("Expected only the live stream, got %q", got)
+	}
+	a.Close()
+	b.Write([]byte("b3\n"))
+	b.Close()
+	if got, want := out.String(), "[a]\na1 a2\n[b]\nb1 b2\nb3\n"; got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestStreamMuxConcurrentWriters(t *testing.T) {
+	var out bytes.Buffer
+	mux := newStreamMux(&out)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		s := mux.stream(fmt.Sprintf("[%d]", i))
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				fmt.Fprint(s, i)
+			}
+			s.Close()
+		}(i)
+	}
+	wg.Wait()
+	// Every stream must come out as its header followed by its own output only.
+	got := out.String()
+	for i := 0; i < 4; i++ {
+		want := fmt.Sprintf("[%d]", i) + string(bytes.Repeat([]byte{byte('0' + i)}, 100))
+		if !bytes.Contains([]byte(got), []byte(want)) {
+			t.Errorf("Expected %q contiguous in %q", want, got)
+		}
+	}
+}
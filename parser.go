@@ -0,0 +1,173 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ParsedAction is a single action extracted from a model response, together with
+// whether its output should be fed back to the model as a tool call.
+type ParsedAction struct {
+	Action     Action
+	IsToolCall bool
+}
+
+// toolOutputPattern matches a TOOL_OUTPUT block produced by wrapToolOutput.
+// An unterminated opening tag matches nothing, so the actions after it are
+// still parsed.
+var toolOutputPattern = regexp.MustCompile(`(?s)<TOOL_OUTPUT[^>]*>.*?</TOOL_OUTPUT>`)
+
+// toolCallMarker matches a [TOOL_CALL] marker directly before an action tag,
+// on the same line. A marker ending an earlier line, or mentioned in prose
+// before other text, does not make the next tag a tool call. Repeated markers
+// count as one.
+var toolCallMarker = regexp.MustCompile(`(?:\[TOOL_CALL\][ \t]*)+$`)
+
+// stripToolOutput removes TOOL_OUTPUT blocks that a model echoed back, so
+// action tags inside tool output are never executed.
+func stripToolOutput(response string) string {
+	return toolOutputPattern.ReplaceAllString(response, "")
+}
+
+// messageActions returns the actions in a history message. Only model
+// replies are parsed: messages flagged ToolOutput hold data produced by
+// actions and are never scanned, whatever tags they contain.
+func messageActions(msg Message) []ParsedAction {
+	if !isAssistantRole(msg.Role) || msg.ToolOutput {
+		return nil
+	}
+	return parseActions(msg.Content)
+}
+
+// danglingActionTag returns the action whose tag is still open at the end of
+// response, as left by a response cut off in the middle of an action.
+func danglingActionTag(response string) (string, bool) {
+	remaining := stripToolOutput(response)
+	last, action := -1, ""
+	for _, a := range actionTags {
+		if idx := strings.LastIndex(remaining, "<"+tagName(a)+">"); idx > last {
+			last, action = idx, a
+		}
+	}
+	if last == -1 || strings.Contains(remaining[last:], "</"+tagName(action)+">") {
+		return "", false
+	}
+	return action, true
+}
+
+// parseActions extracts every well-formed action tag from response, in order.
+// It has no side effects; malformed or unterminated tags are skipped, and so
+// is anything inside a TOOL_OUTPUT block.
+func parseActions(response string) []ParsedAction {
+	var actions []ParsedAction
+	remainingResponse := stripToolOutput(response)
+
+	for {
+		start, action := -1, ""
+		for _, a := range actionTags {
+			if idx := strings.Index(remainingResponse, "<"+tagName(a)+">"); idx != -1 && (start == -1 || idx < start) {
+				start, action = idx, a
+			}
+		}
+		if start == -1 {
+			break
+		}
+
+		isToolCall := toolCallMarker.MatchString(remainingResponse[:start])
+
+		// Unterminated tags are skipped; scanning resumes after the opening tag.
+		body := remainingResponse[start+len(tagName(action))+2:]
+		endTag := "</" + tagName(action) + ">"
+		endIdx := strings.Index(body, endTag)
+		if endIdx == -1 {
+			remainingResponse = body
+			continue
+		}
+		content := body[:endIdx]
+		remainingResponse = body[endIdx+len(endTag):]
+
+		switch action {
+		case "PATCH":
+			lines := strings.SplitN(strings.TrimSpace(content), "\n", 3)
+			if len(lines) >= 2 {
+				filename := strings.TrimSpace(lines[0])
+				idStr := strings.TrimSpace(lines[1])
+				id, err := strconv.Atoi(idStr)
+				if err == nil {
+					patchContent, expect := "", ""
+					if len(lines) == 3 {
+						patchContent = lines[2]
+						// An optional EXPECT line fingerprints the block's current first line.
+						if rest, ok := strings.CutPrefix(patchContent, "EXPECT:"); ok {
+							expect, patchContent, _ = strings.Cut(rest, "\n")
+							expect = strings.TrimSpace(expect)
+						}
+					}
+					actions = append(actions, ParsedAction{PatchAction{Filename: filename, ID: id, Content: patchContent, Expect: expect}, isToolCall})
+				}
+			}
+		case "EDIT":
+			lines := strings.SplitN(strings.TrimSpace(content), "\n", 2)
+			if len(lines) == 2 {
+				filename := strings.TrimSpace(lines[0])
+				fileContent := lines[1]
+				actions = append(actions, ParsedAction{EditAction{Filename: filename, Content: fileContent}, isToolCall})
+			}
+		case "RUN":
+			actions = append(actions, ParsedAction{RunAction{Command: strings.TrimSpace(content)}, isToolCall})
+		case "READ":
+			actions = append(actions, ParsedAction{ReadAction{Filename: strings.TrimSpace(content)}, isToolCall})
+		case "READ_RAW":
+			actions = append(actions, ParsedAction{ReadRawAction{Filename: strings.TrimSpace(content)}, isToolCall})
+		case "REPLACE":
+			lines := strings.SplitN(strings.TrimSpace(content), "\n", 2)
+			if len(lines) >= 2 {
+				filename := strings.TrimSpace(lines[0])
+				rest := lines[1]
+
+				searchMarker := "<<<<<<< SEARCH"
+				midMarker := "======="
+				endMarker := ">>>>>>>"
+
+				sIdx := strings.Index(rest, searchMarker)
+				mIdx := strings.Index(rest, midMarker)
+				eIdx := strings.Index(rest, endMarker)
+
+				if sIdx != -1 && mIdx != -1 && eIdx != -1 && mIdx > sIdx && eIdx > mIdx {
+					// The marker line selects the mode: SEARCH, SEARCH_REGEX or SEARCH_REGEX_ALL.
+					markerEnd := sIdx + len(searchMarker)
+					if nl := strings.Index(rest[sIdx:mIdx], "\n"); nl != -1 {
+						markerEnd = sIdx + nl
+					}
+					mode := strings.TrimSpace(rest[sIdx+len("<<<<<<<") : markerEnd])
+					if mode == "SEARCH" || mode == "SEARCH_REGEX" || mode == "SEARCH_REGEX_ALL" {
+						oldContent := strings.Trim(rest[markerEnd:mIdx], "\n")
+						newContent := strings.Trim(rest[mIdx+len(midMarker):eIdx], "\n")
+						actions = append(actions, ParsedAction{ReplaceAction{
+							Filename: filename,
+							Old:      oldContent,
+							New:      newContent,
+							Regex:    mode != "SEARCH",
+							All:      mode == "SEARCH_REGEX_ALL",
+						}, isToolCall})
+					}
+				}
+			}
+		case "LISTFILES":
+			actions = append(actions, ParsedAction{ListFilesAction{Path: strings.TrimSpace(content)}, isToolCall})
+		case "SEARCHFILES":
+			actions = append(actions, ParsedAction{SearchFilesAction{Query: strings.TrimSpace(content)}, isToolCall})
+		case "DIFF":
+			// Only trim newlines: leading spaces are significant context markers.
+			lines := strings.SplitN(strings.Trim(content, "\n"), "\n", 2)
+			if len(lines) == 2 {
+				actions = append(actions, ParsedAction{DiffAction{Filename: strings.TrimSpace(lines[0]), Diff: lines[1]}, isToolCall})
+			}
+		case "MEMORY_APPEND":
+			actions = append(actions, ParsedAction{MemoryAppendAction{Note: strings.TrimSpace(content)}, isToolCall})
+		}
+	}
+
+	return actions
+}
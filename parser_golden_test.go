@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the testdata/actions golden files")
+
+// goldenActions formats parsed actions one per line: an optional
+// [TOOL_CALL] marker, the action type and its fields as JSON.
+func goldenActions(actions []ParsedAction) string {
+	var b strings.Builder
+	for _, item := range actions {
+		if item.IsToolCall {
+			b.WriteString("[TOOL_CALL] ")
+		}
+		b.WriteString(actionType(item.Action) + " ")
+		enc := json.NewEncoder(&b)
+		enc.SetEscapeHTML(false)
+		_ = enc.Encode(item.Action)
+	}
+	return b.String()
+}
+
+// TestParseActionsGolden parses every testdata/actions/*.txt model response
+// and compares the actions with the matching .golden file. Run
+// `go test -run Golden -update` to rewrite the golden files after an
+// intended parser change, then review the diff.
+func TestParseActionsGolden(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "actions", "*.txt"))
+	if err != nil || len(inputs) == 0 {
+		t.Fatalf("No golden inputs found: %v", err)
+	}
+	for _, input := range inputs {
+		name := strings.TrimSuffix(filepath.Base(input), ".txt")
+		t.Run(name, func(t *testing.T) {
+			response, err := os.ReadFile(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := goldenActions(parseActions(string(response)))
+			golden := strings.TrimSuffix(input, ".txt") + ".golden"
+			if *updateGolden {
+				if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v (run with -update to create it)", err)
+			}
+			if got != string(want) {
+				t.Errorf("Parsed actions differ from %s:\ngot:\n%swant:\n%s", golden, got, want)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"regexp"
 	"testing"
 )
 
@@ -53,3 +54,207 @@ func TestBlocksToString(t *testing.T) {
 		t.Errorf("Expected %q, got %q", expected, result)
 	}
 }
+
+func TestParseActions(t *testing.T) {
+	response := `Let me look first.
+[TOOL_CALL] <READ>main.go</READ>
+Then I will run the tests:
+<RUN>
+go test ./...
+</RUN>
+<EDIT>
+notes.txt
+hello
+</EDIT>`
+	actions := parseActions(response)
+
+	if len(actions) != 3 {
+		t.Fatalf("Expected 3 actions, got %d", len(actions))
+	}
+
+	read, ok := actions[0].Action.(ReadAction)
+	if !ok || read.Filename != "main.go" {
+		t.Errorf("Expected ReadAction for main.go, got %#v", actions[0].Action)
+	}
+	if !actions[0].IsToolCall {
+		t.Errorf("Expected READ to be a tool call")
+	}
+
+	run, ok := actions[1].Action.(RunAction)
+	if !ok || run.Command != "go test ./..." {
+		t.Errorf("Expected RunAction for go test, got %#v", actions[1].Action)
+	}
+	if actions[1].IsToolCall {
+		t.Errorf("Expected RUN not to be a tool call")
+	}
+
+	edit, ok := actions[2].Action.(EditAction)
+	if !ok || edit.Filename != "notes.txt" || edit.Content != "hello" {
+		t.Errorf("Expected EditAction for notes.txt, got %#v", actions[2].Action)
+	}
+}
+
+func TestParseActionsPatchAndReplace(t *testing.T) {
+	response := `<PATCH>
+main.go
+2
+func main() {}
+</PATCH>
+<REPLACE>
+main.go
+<<<<<<< SEARCH
+old line
+=======
+new line
+>>>>>>>
+</REPLACE>`
+	actions := parseActions(response)
+
+	if len(actions) != 2 {
+		t.Fatalf("Expected 2 actions, got %d", len(actions))
+	}
+
+	patch, ok := actions[0].Action.(PatchAction)
+	if !ok || patch.Filename != "main.go" || patch.ID != 2 || patch.Content != "func main() {}" {
+		t.Errorf("Unexpected patch action: %#v", actions[0].Action)
+	}
+
+	replace, ok := actions[1].Action.(ReplaceAction)
+	if !ok || replace.Old != "old line" || replace.New != "new line" {
+		t.Errorf("Unexpected replace action: %#v", actions[1].Action)
+	}
+}
+
+func TestParseActionsSkipsMalformed(t *testing.T) {
+	response := `<PATCH>
+main.go
+not-a-number
+content
+</PATCH>
+<READ>unterminated.go`
+	actions := parseActions(response)
+
+	if len(actions) != 0 {
+		t.Errorf("Expected no actions, got %d", len(actions))
+	}
+}
+
+func TestParseActionsReplaceRegex(t *testing.T) {
+	response := `<REPLACE>
+main.go
+<<<<<<< SEARCH_REGEX_ALL
+foo\s+bar
+=======
+foo bar
+>>>>>>>
+</REPLACE>`
+	actions := parseActions(response)
+
+	if len(actions) != 1 {
+		t.Fatalf("Expected 1 action, got %d", len(actions))
+	}
+	replace, ok := actions[0].Action.(ReplaceAction)
+	if !ok || !replace.Regex || !replace.All || replace.Old != `foo\s+bar` {
+		t.Errorf("Unexpected replace action: %#v", actions[0].Action)
+	}
+}
+
+func TestSplitBlocksCustomDelimiter(t *testing.T) {
+	content := "a\nb\n---\nc\n---\n---\nd\n"
+	blocks := splitBlocks(content, regexp.MustCompile(`^---$`))
+
+	if len(blocks) != 3 {
+		t.Fatalf("Expected 3 blocks, got %d", len(blocks))
+	}
+	if len(blocks[0].Lines) != 2 || blocks[0].Separator != "---" {
+		t.Errorf("Unexpected block 0: %#v", blocks[0])
+	}
+	if blocks[1].Separator != "---\n---" {
+		t.Errorf("Expected consecutive delimiters on block 1, got %q", blocks[1].Separator)
+	}
+
+	if result := blocksToString(blocks); result != content {
+		t.Errorf("Expected %q, got %q", content, result)
+	}
+}
+
+func TestPatchExpectFingerprint(t *testing.T) {
+	actions := parseActions("<PATCH>\nmain.go\n1\nEXPECT: func b() {\nfunc b() { return }\n</PATCH>")
+	if len(actions) != 1 {
+		t.Fatalf("Expected 1 action, got %d", len(actions))
+	}
+	patch := actions[0].Action.(PatchAction)
+	if patch.Expect != "func b() {" || patch.Content != "func b() { return }" {
+		t.Fatalf("Unexpected patch action: %#v", patch)
+	}
+
+	// Two blocks were inserted above "func b", so it is now block 3.
+	blocks := parseBlocks("package main\n\n// new\n\nfunc a() {\n}\n\nfunc b() {\n}")
+	if id, err := patch.resolveBlock(blocks); err != nil || id != 3 {
+		t.Errorf("Expected the moved block 3, got %d (%v)", id, err)
+	}
+
+	patch.Expect = "func missing() {"
+	if _, err := patch.resolveBlock(blocks); err == nil {
+		t.Errorf("Expected an error when no block matches")
+	}
+}
+
+func TestWrapToolOutput(t *testing.T) {
+	got := wrapToolOutput("RUN cat x", "a </TOOL_OUTPUT> b\n")
+	expected := "<TOOL_OUTPUT action=\"RUN cat x\">\na <\\/TOOL_OUTPUT> b\n</TOOL_OUTPUT>"
+	if got != expected {
+		t.Errorf("wrapToolOutput = %q, expected %q", got, expected)
+	}
+}
+
+func TestParseActionsIgnoresEchoedToolOutput(t *testing.T) {
+	response := "The file contains:\n" +
+		wrapToolOutput("READ prompt.go", "<RUN>rm -rf build</RUN>") +
+		"\n<READ>main.go</READ>\n<TOOL_OUTPUT action=\"RUN ls\">\n<EDIT>\nx.go\nunterminated echo"
+	actions := parseActions(response)
+	if len(actions) != 1 {
+		t.Fatalf("Expected only the READ outside tool output, got %#v", actions)
+	}
+	if read, ok := actions[0].Action.(ReadAction); !ok || read.Filename != "main.go" {
+		t.Errorf("Unexpected action %#v", actions[0].Action)
+	}
+}
+
+func TestMessageActionsSkipsToolOutput(t *testing.T) {
+	content := "<RUN>make</RUN>"
+	if got := messageActions(Message{Role: "assistant", Content: content}); len(got) != 1 {
+		t.Errorf("Expected the assistant's RUN to be parsed, got %#v", got)
+	}
+	for _, msg := range []Message{
+		{Role: "user", Content: content, ToolOutput: true},
+		{Role: "assistant", Content: content, ToolOutput: true},
+	} {
+		if got := messageActions(msg); got != nil {
+			t.Errorf("Parsed actions from tool output %+v: %#v", msg, got)
+		}
+	}
+}
+
+func TestParseActionsToolCallMarker(t *testing.T) {
+	cases := []struct {
+		response string
+		toolCall bool
+	}{
+		{"[TOOL_CALL] <RUN>ls</RUN>", true},
+		{"Checking: [TOOL_CALL]<RUN>ls</RUN>", true},
+		{"[TOOL_CALL] [TOOL_CALL] <RUN>ls</RUN>", true},
+		{"I won't use [TOOL_CALL] here.\n<RUN>ls</RUN>", false},
+		{"Prefix the tag with [TOOL_CALL]\n\n<RUN>ls</RUN>", false},
+		{"[TOOL_CALL] means feedback; now: <RUN>ls</RUN>", false},
+	}
+	for _, c := range cases {
+		actions := parseActions(c.response)
+		if len(actions) != 1 {
+			t.Fatalf("%q: expected 1 action, got %d", c.response, len(actions))
+		}
+		if actions[0].IsToolCall != c.toolCall {
+			t.Errorf("%q: IsToolCall = %v, expected %v", c.response, actions[0].IsToolCall, c.toolCall)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// patchIndexes returns the positions of the PATCH actions in actions.
+func patchIndexes(actions []ParsedAction) []int {
+	var indexes []int
+	for i, item := range actions {
+		if _, ok := item.Action.(PatchAction); ok {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+// patchTransaction implements Config.AtomicPatches. Each file's content is
+// recorded before its first patch and after each applied one. When a patch
+// fails, the patched files are restored right away, before any later action
+// touches them, and the remaining patches in the response are not applied.
+type patchTransaction struct {
+	before  map[string][]byte
+	written map[string][]byte
+	applied []int
+	failed  bool
+}
+
+func newPatchTransaction() *patchTransaction {
+	return &patchTransaction{before: map[string][]byte{}, written: map[string][]byte{}}
+}
+
+// run executes the PATCH at index i with execute, recording it in the
+// transaction and rolling back the earlier patches if it fails.
+func (tx *patchTransaction) run(i int, name string, execute func() (string, ActionResult), outputs []string, results []ActionResult) {
+	if tx.failed {
+		outputs[i] = fmt.Sprintf("Patch on %s not applied because an earlier patch in this response failed.", name)
+		results[i] = ActionResult{Type: "PATCH", Target: name, Status: statusRolledBack, Output: outputs[i], file: name}
+		return
+	}
+	if _, ok := tx.before[name]; !ok {
+		if data, err := os.ReadFile(name); err == nil {
+			tx.before[name] = data
+		}
+	}
+	outputs[i], results[i] = execute()
+	switch results[i].Status {
+	case statusApplied:
+		if data, err := os.ReadFile(name); err == nil {
+			tx.written[name] = data
+		}
+		tx.applied = append(tx.applied, i)
+	case statusError:
+		tx.failed = true
+		tx.rollBack(outputs, results)
+	}
+}
+
+// rollBack restores the files the applied patches changed and marks those
+// patches as rolled back. A file changed since its last patch, for example by
+// an EDIT or RUN in between, is left alone so that change isn't lost.
+func (tx *patchTransaction) rollBack(outputs []string, results []ActionResult) {
+	restored := map[string]bool{}
+	for name, data := range tx.written {
+		current, err := os.ReadFile(name)
+		if err != nil || !bytes.Equal(current, data) {
+			logWarn("Warning: %s changed after it was patched, so its patches were not rolled back.", name)
+			continue
+		}
+		if err := os.WriteFile(name, tx.before[name], 0644); err != nil {
+			logError("Error restoring %s: %v", name, err)
+			continue
+		}
+		restored[name] = true
+	}
+	for _, i := range tx.applied {
+		if !restored[results[i].file] {
+			continue
+		}
+		outputs[i] = fmt.Sprintf("Patch on %s rolled back because another patch in this response failed.", results[i].file)
+		results[i].Status = statusRolledBack
+		results[i].Success = false
+		results[i].Output = outputs[i]
+	}
+	logWarn("A patch failed, so the patches in this response were rolled back.")
+}
+
+// patchSummary lists how each PATCH action at indexes went, so a model that
+// sent several patches sees at a glance which ones to resend.
+func patchSummary(actions []ParsedAction, indexes []int, results []ActionResult) string {
+	applied := 0
+	var lines []string
+	for _, i := range indexes {
+		if results[i].Status == statusApplied {
+			applied++
+		}
+		line := fmt.Sprintf("- %s: %s", describeAction(actions[i].Action), results[i].Status)
+		if results[i].Status != statusApplied {
+			line += ": " + firstLine(results[i].Output)
+		}
+		lines = append(lines, line)
+	}
+	return fmt.Sprintf("PATCH results: %d of %d applied.\n%s", applied, len(indexes), strings.Join(lines, "\n"))
+}
+
+// firstLine returns s up to its first newline.
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(s), "\n")
+	return line
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// mixedPatchResponse patches block 0 of path as a tool call, then sends a
+// patch for a block that doesn't exist.
+func mixedPatchResponse(path string) string {
+	return "[TOOL_CALL] <PATCH>\n" + path + "\n0\nfirst patched\n</PATCH>\n" +
+		"[TOOL_CALL] <PATCH>\n" + path + "\n9\nmissing block\n</PATCH>\n"
+}
+
+func TestMixedPatchesKeepSuccessesAndSummarize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	os.WriteFile(path, []byte("first\n\nsecond\n"), 0644)
+
+	output, _, results := handleResponse(t.Context(), mixedPatchResponse(path), &scriptedClient{}, &Config{AutoEdit: true})
+	if results[0].Status != statusApplied || results[1].Status != statusError {
+		t.Fatalf("Unexpected statuses %+v", results)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "first patched\n\nsecond\n" {
+		t.Errorf("Expected the valid patch to be kept, got %q", data)
+	}
+	if !strings.Contains(output, "PATCH results: 1 of 2 applied.") || !strings.Contains(output, "block 9: error") {
+		t.Errorf("Expected a patch summary in the tool output, got %q", output)
+	}
+}
+
+func TestAtomicPatchesRollBackOnFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	original := "first\n\nsecond\n"
+	os.WriteFile(path, []byte(original), 0644)
+
+	output, _, results := handleResponse(t.Context(), mixedPatchResponse(path), &scriptedClient{}, &Config{AutoEdit: true, AtomicPatches: true})
+	if results[0].Status != statusRolledBack || results[1].Status != statusError {
+		t.Fatalf("Unexpected statuses %+v", results)
+	}
+	if data, _ := os.ReadFile(path); string(data) != original {
+		t.Errorf("Expected the file to be restored, got %q", data)
+	}
+	if !strings.Contains(output, "PATCH results: 0 of 2 applied.") || !strings.Contains(output, "rolled back because another patch") {
+		t.Errorf("Expected the rollback in the tool output, got %q", output)
+	}
+}
+
+func TestAtomicPatchesKeepAllOnSuccess(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	os.WriteFile(path, []byte("first\n\nsecond\n"), 0644)
+	response := "<PATCH>\n" + path + "\n0\none\n</PATCH>\n<PATCH>\n" + path + "\n1\ntwo\n</PATCH>\n"
+
+	_, _, results := handleResponse(t.Context(), response, &scriptedClient{}, &Config{AutoEdit: true, AtomicPatches: true})
+	if results[0].Status != statusApplied || results[1].Status != statusApplied {
+		t.Fatalf("Unexpected statuses %+v", results)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "one\n\ntwo\n" {
+		t.Errorf("Expected both patches, got %q", data)
+	}
+}
+
+func TestAtomicPatchesRollBackBeforeLaterEdit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	os.WriteFile(path, []byte("first\n\nsecond\n"), 0644)
+	response := mixedPatchResponse(path) + "<EDIT>\n" + path + "\nrewritten\n</EDIT>\n"
+
+	_, _, results := handleResponse(t.Context(), response, &scriptedClient{}, &Config{AutoEdit: true, AtomicPatches: true, UseTrash: new(bool)})
+	if results[0].Status != statusRolledBack || results[1].Status != statusError || results[2].Status != statusApplied {
+		t.Fatalf("Unexpected statuses %+v", results)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "rewritten" {
+		t.Errorf("Expected the later EDIT to survive the rollback, got %q", data)
+	}
+}
+
+func TestAtomicPatchesKeepFilesChangedSincePatching(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	os.WriteFile(path, []byte("first\n\nsecond\n"), 0644)
+	response := "<PATCH>\n" + path + "\n0\none\n</PATCH>\n" +
+		"<EDIT>\n" + path + "\nedited\n</EDIT>\n" +
+		"<PATCH>\n" + path + "\n9\nmissing block\n</PATCH>\n" +
+		"<PATCH>\n" + path + "\n0\nafter the failure\n</PATCH>\n"
+
+	_, _, results := handleResponse(t.Context(), response, &scriptedClient{}, &Config{AutoEdit: true, AtomicPatches: true, UseTrash: new(bool)})
+	if results[0].Status != statusApplied || results[2].Status != statusError || results[3].Status != statusRolledBack {
+		t.Fatalf("Unexpected statuses %+v", results)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "edited" {
+		t.Errorf("Expected the EDIT made after the patch to be kept, got %q", data)
+	}
+}
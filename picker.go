@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// pickerItem is a selectable model in the --pick list.
+type pickerItem struct {
+	provider string
+	model    string
+}
+
+// pickerModel is the Bubble Tea model behind arisu --pick.
+type pickerModel struct {
+	items    []pickerItem
+	cursor   int
+	chosen   string
+	quitting bool
+}
+
+// knownModelItems lists the known models grouped by provider.
+func knownModelItems() []pickerItem {
+	var items []pickerItem
+	groups := []struct {
+		provider string
+		models   []string
+	}{
+		{"gemini", geminiModels},
+		{"openai", openaiModels},
+		{"grok", grokModels},
+	}
+	for _, g := range groups {
+		for _, m := range g.models {
+			items = append(items, pickerItem{provider: g.provider, model: m})
+		}
+	}
+	return items
+}
+
+func (m pickerModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m pickerModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		switch msg.String() {
+		case "ctrl+c", "esc", "q":
+			m.quitting = true
+			return m, tea.Quit
+		case "up", "k":
+			if m.cursor > 0 {
+				m.cursor--
+			}
+		case "down", "j":
+			if m.cursor < len(m.items)-1 {
+				m.cursor++
+			}
+		case "enter":
+			m.chosen = m.items[m.cursor].model
+			m.quitting = true
+			return m, tea.Quit
+		}
+	}
+	return m, nil
+}
+
+func (m pickerModel) View() string {
+	if m.quitting {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("Select a model (↑/↓ to move, Enter to select, Esc to cancel)\n")
+	lastProvider := ""
+	for i, item := range m.items {
+		if item.provider != lastProvider {
+			sb.WriteString(fmt.Sprintf("\n%s\n", item.provider))
+			lastProvider = item.provider
+		}
+		cursor := "  "
+		if i == m.cursor {
+			cursor = "> "
+		}
+		sb.WriteString(fmt.Sprintf("%s%s\n", cursor, item.model))
+	}
+	return sb.String()
+}
+
+// pickModel shows the model picker and returns the chosen model, if any.
+func pickModel(current string) (string, bool) {
+	m := pickerModel{items: knownModelItems()}
+	for i, item := range m.items {
+		if item.model == current {
+			m.cursor = i
+		}
+	}
+	result, err := tea.NewProgram(m).Run()
+	if err != nil {
+		logError("Error running model picker: %v", err)
+		return "", false
+	}
+	chosen := result.(pickerModel).chosen
+	return chosen, chosen != ""
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// pinnedFiles lists the files read with READ that are re-attached to every
+// request while Config.PinReads is set, in the order they were pinned.
+var pinnedFiles []string
+
+// pinMu guards pinnedFiles while READ actions run concurrently.
+var pinMu sync.Mutex
+
+func pinFile(filename string) {
+	pinMu.Lock()
+	defer pinMu.Unlock()
+	for _, f := range pinnedFiles {
+		if f == filename {
+			return
+		}
+	}
+	pinnedFiles = append(pinnedFiles, filename)
+}
+
+// unpinFile removes filename from the pinned files and reports whether it was pinned.
+func unpinFile(filename string) bool {
+	for i, f := range pinnedFiles {
+		if f == filename {
+			pinnedFiles = append(pinnedFiles[:i], pinnedFiles[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// pinnedContext returns the current contents of the pinned files, to be sent
+// ahead of each request but not kept in the history. Files are re-read on
+// every request so block IDs stay correct after edits, even if the original
+// READ output has been truncated from history.
+func pinnedContext(config *Config) string {
+	if len(pinnedFiles) == 0 {
+		return ""
+	}
+	delimiter, err := blockDelimiter(config)
+	if err != nil {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("Pinned files (current contents):\n")
+	for _, f := range pinnedFiles {
+		content, _, err := readTextFile(f)
+		if err != nil {
+			sb.WriteString(fmt.Sprintf("%s is no longer readable: %v\n", f, err))
+			continue
+		}
+		sb.WriteString(formatBlocks(f, content, delimiter))
+	}
+	sb.WriteString("\n")
+	return sb.String()
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPinnedFilesAreNotKeptInHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	os.WriteFile(path, []byte("pinned content"), 0644)
+	defer func() { pinnedFiles = nil }()
+	pinnedFiles = []string{path}
+
+	client := &scriptedClient{replies: []string{"one", "two"}}
+	s := &session{client: client, config: &Config{}}
+	for _, input := range []string{"first", "second"} {
+		if _, err := s.send(t.Context(), Message{Role: "user", Content: input}); err != nil {
+			t.Fatalf("send failed: %v", err)
+		}
+	}
+
+	for i, sent := range client.sent {
+		if !strings.Contains(sent, "pinned content") {
+			t.Errorf("Expected request %d to carry the pinned file, got %q", i, sent)
+		}
+	}
+	for _, msg := range client.history {
+		if strings.Contains(msg.Content, "pinned content") {
+			t.Errorf("Expected the pinned file to stay out of the history, got %q", msg.Content)
+		}
+	}
+	if client.history[0].Content != "first" || client.history[2].Content != "second" {
+		t.Errorf("Expected the history to keep the inputs as typed, got %+v", client.history)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// defaultProjectHints maps a marker file to the note added to the system
+// prompt when the working directory contains it.
+var defaultProjectHints = map[string]string{
+	"go.mod":         "This is a Go project; build with `go build ./...` and run tests with `go test ./...`.",
+	"package.json":   "This is a JavaScript/TypeScript project; check package.json for its scripts and run tests with `npm test`.",
+	"Cargo.toml":     "This is a Rust project; build with `cargo build` and run tests with `cargo test`.",
+	"pyproject.toml": "This is a Python project; run tests with `pytest`.",
+}
+
+// projectHints is the note for the detected project types. It is set once at
+// startup by detectProjectHints and appended to the system prompt.
+var projectHints string
+
+// detectProjectHints returns the notes for the marker files in dir, using
+// Config.ProjectHints over the defaults. A marker mapped to "" is ignored.
+func detectProjectHints(dir string, overrides map[string]string) string {
+	hints := map[string]string{}
+	for marker, note := range defaultProjectHints {
+		hints[marker] = note
+	}
+	for marker, note := range overrides {
+		hints[marker] = note
+	}
+	markers := make([]string, 0, len(hints))
+	for marker := range hints {
+		markers = append(markers, marker)
+	}
+	sort.Strings(markers)
+	var notes []string
+	for _, marker := range markers {
+		if hints[marker] == "" {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, marker)); err == nil {
+			notes = append(notes, hints[marker])
+		}
+	}
+	return strings.Join(notes, "\n")
+}
+
+// projectPrompt is the system prompt section for the detected project types.
+func projectPrompt() string {
+	if projectHints == "" {
+		return ""
+	}
+	return "\nAbout the project in the working directory:\n" + projectHints + "\n"
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetectProjectHints(t *testing.T) {
+	dir := t.TempDir()
+	if got := detectProjectHints(dir, nil); got != "" {
+		t.Errorf("Expected no hints for an empty directory, got %q", got)
+	}
+	os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module x\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "package.json"), []byte("{}"), 0644)
+	os.WriteFile(filepath.Join(dir, "Makefile"), []byte("all:\n"), 0644)
+
+	got := detectProjectHints(dir, map[string]string{"package.json": "", "Makefile": "Build with make."})
+	want := "Build with make.\n" + defaultProjectHints["go.mod"]
+	if got != want {
+		t.Errorf("detectProjectHints = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// rateLimitLowWater is the remaining-request count at or below which the next
+// request waits for the rate-limit window to reset.
+const rateLimitLowWater = 1
+
+// maxRateLimitWait caps how long a single request waits on rate-limit headers.
+const maxRateLimitWait = 2 * time.Minute
+
+// rateLimitState is the last rate-limit information a provider returned.
+type rateLimitState struct {
+	Seen      bool
+	Remaining int // -1 when the provider didn't say
+	Reset     time.Time
+	// RetryAfter is when a 429 response asked us to retry.
+	RetryAfter time.Time
+}
+
+func (s rateLimitState) String() string {
+	if !s.Seen {
+		return "no rate-limit headers seen"
+	}
+	out := "remaining unknown"
+	if s.Remaining >= 0 {
+		out = fmt.Sprintf("%d remaining", s.Remaining)
+	}
+	if !s.Reset.IsZero() {
+		out += fmt.Sprintf(", resets in %s", time.Until(s.Reset).Round(time.Second))
+	}
+	if wait := time.Until(s.RetryAfter); wait > 0 {
+		out += fmt.Sprintf(", retry after %s", wait.Round(time.Second))
+	}
+	return out
+}
+
+// parseRateLimit reads the X-RateLimit-* and Retry-After headers. Both the
+// plain names (OpenRouter) and the per-request variants (OpenAI, xAI) are
+// understood.
+func parseRateLimit(h http.Header, status int, now time.Time) rateLimitState {
+	s := rateLimitState{Remaining: -1}
+	for _, name := range []string{"X-Ratelimit-Remaining-Requests", "X-Ratelimit-Remaining"} {
+		if v := h.Get(name); v != "" {
+			if n, err := strconv.Atoi(v); err == nil {
+				s.Remaining, s.Seen = n, true
+				break
+			}
+		}
+	}
+	for _, name := range []string{"X-Ratelimit-Reset-Requests", "X-Ratelimit-Reset"} {
+		if v := h.Get(name); v != "" {
+			if t, ok := parseResetTime(v, now); ok {
+				s.Reset, s.Seen = t, true
+				break
+			}
+		}
+	}
+	if v := h.Get("Retry-After"); v != "" && status == http.StatusTooManyRequests {
+		if secs, err := strconv.Atoi(v); err == nil {
+			s.RetryAfter, s.Seen = now.Add(time.Duration(secs)*time.Second), true
+		} else if t, err := http.ParseTime(v); err == nil {
+			s.RetryAfter, s.Seen = t, true
+		}
+	}
+	return s
+}
+
+// parseResetTime accepts epoch seconds or milliseconds, seconds from now, or
+// a Go duration such as "1m30s".
+func parseResetTime(v string, now time.Time) (time.Time, bool) {
+	if n, err := strconv.ParseFloat(v, 64); err == nil {
+		switch {
+		case n > 1e12:
+			return time.UnixMilli(int64(n)), true
+		case n > 1e9:
+			return time.Unix(int64(n), 0), true
+		default:
+			return now.Add(time.Duration(n * float64(time.Second))), true
+		}
+	}
+	if d, err := time.ParseDuration(v); err == nil {
+		return now.Add(d), true
+	}
+	return time.Time{}, false
+}
+
+// rateLimiter delays requests according to the last rate-limit state.
+type rateLimiter struct {
+	state rateLimitState
+}
+
+// update records the rate-limit headers of resp.
+func (r *rateLimiter) update(resp *http.Response) {
+	if s := parseRateLimit(resp.Header, resp.StatusCode, time.Now()); s.Seen {
+		r.state = s
+	}
+}
+
+// wait sleeps until a pending Retry-After has passed, or until the window
+// resets when few requests remain.
+func (r *rateLimiter) wait(ctx context.Context) error {
+	until := r.state.RetryAfter
+	if r.state.Remaining >= 0 && r.state.Remaining <= rateLimitLowWater && r.state.Reset.After(until) {
+		until = r.state.Reset
+	}
+	d := time.Until(until)
+	if d <= 0 {
+		return nil
+	}
+	if d > maxRateLimitWait {
+		d = maxRateLimitWait
+	}
+	logInfo("Rate limit reached; waiting %s before the next request...", d.Round(time.Second))
+	select {
+	case <-time.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// rateLimitReporter is implemented by clients that track rate-limit headers.
+type rateLimitReporter interface {
+	RateLimit() rateLimitState
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	h := http.Header{}
+	h.Set("X-RateLimit-Remaining", "3")
+	h.Set("X-RateLimit-Reset", "1700000030000")
+	s := parseRateLimit(h, http.StatusOK, now)
+	if s.Remaining != 3 || !s.Reset.Equal(now.Add(30*time.Second)) {
+		t.Errorf("Unexpected OpenRouter-style state %+v", s)
+	}
+
+	h = http.Header{}
+	h.Set("X-Ratelimit-Remaining-Requests", "0")
+	h.Set("X-Ratelimit-Reset-Requests", "1m30s")
+	h.Set("Retry-After", "20")
+	s = parseRateLimit(h, http.StatusTooManyRequests, now)
+	if s.Remaining != 0 || !s.Reset.Equal(now.Add(90*time.Second)) || !s.RetryAfter.Equal(now.Add(20*time.Second)) {
+		t.Errorf("Unexpected OpenAI-style state %+v", s)
+	}
+
+	if s := parseRateLimit(http.Header{}, http.StatusOK, now); s.Seen {
+		t.Errorf("Expected no state without headers, got %+v", s)
+	}
+}
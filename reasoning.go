@@ -0,0 +1,130 @@
+package main
+
+import (
+	"io"
+	"regexp"
+	"strings"
+)
+
+var defaultReasoningTags = []string{"think"}
+
+// reasoningTags returns the configured reasoning tag names.
+func reasoningTags(config *Config) []string {
+	if config.ReasoningTags != nil {
+		return config.ReasoningTags
+	}
+	return defaultReasoningTags
+}
+
+// stripReasoning removes <tag>...</tag> blocks for each of tags. An
+// unterminated block is only removed when it starts the response, as in one
+// truncated while still reasoning; elsewhere the tag is kept with the text
+// after it, which is the answer.
+func stripReasoning(text string, tags []string) string {
+	for _, tag := range tags {
+		q := regexp.QuoteMeta(tag)
+		re := regexp.MustCompile(`(?s)<` + q + `>.*?</` + q + `>`)
+		text = re.ReplaceAllString(text, "")
+		if strings.HasPrefix(strings.TrimLeft(text, " \t\n"), "<"+tag+">") {
+			text = ""
+		}
+	}
+	if len(tags) > 0 {
+		text = strings.TrimLeft(text, "\n")
+	}
+	return text
+}
+
+// reasoningWriter filters streamed output, hiding the content of reasoning
+// tags or, when show is set, rendering it dimmed. Tags split across writes are
+// held back until they can be recognized.
+type reasoningWriter struct {
+	w       io.Writer
+	tags    []string
+	show    bool
+	closing string // close tag of the block we are inside, if any
+	pending string
+}
+
+func newReasoningWriter(w io.Writer, tags []string, show bool) io.Writer {
+	if len(tags) == 0 {
+		return w
+	}
+	return &reasoningWriter{w: w, tags: tags, show: show}
+}
+
+func (r *reasoningWriter) Write(p []byte) (int, error) {
+	text := r.pending + string(p)
+	r.pending = ""
+	var out strings.Builder
+	for text != "" {
+		if r.closing == "" {
+			idx, open := r.findOpen(text)
+			if idx == -1 {
+				keep := partialSuffix(text, r.openTags())
+				out.WriteString(text[:len(text)-keep])
+				r.pending = text[len(text)-keep:]
+				break
+			}
+			out.WriteString(text[:idx])
+			text = text[idx+len(open):]
+			r.closing = "</" + open[1:]
+			if r.show {
+				out.WriteString("\x1b[2m" + open)
+			}
+			continue
+		}
+		idx := strings.Index(text, r.closing)
+		if idx == -1 {
+			keep := partialSuffix(text, []string{r.closing})
+			if r.show {
+				out.WriteString(text[:len(text)-keep])
+			}
+			r.pending = text[len(text)-keep:]
+			break
+		}
+		if r.show {
+			out.WriteString(text[:idx] + r.closing + "\x1b[0m")
+		}
+		text = text[idx+len(r.closing):]
+		r.closing = ""
+	}
+	if _, err := io.WriteString(r.w, out.String()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (r *reasoningWriter) openTags() []string {
+	var open []string
+	for _, tag := range r.tags {
+		open = append(open, "<"+tag+">")
+	}
+	return open
+}
+
+// findOpen returns the position of the earliest opening reasoning tag in text.
+func (r *reasoningWriter) findOpen(text string) (int, string) {
+	best, bestTag := -1, ""
+	for _, open := range r.openTags() {
+		if idx := strings.Index(text, open); idx != -1 && (best == -1 || idx < best) {
+			best, bestTag = idx, open
+		}
+	}
+	return best, bestTag
+}
+
+// partialSuffix returns the length of the longest suffix of text that is a
+// proper prefix of one of tags.
+func partialSuffix(text string, tags []string) int {
+	longest := 0
+	for _, tag := range tags {
+		for n := len(tag) - 1; n > longest; n-- {
+			if strings.HasSuffix(text, tag[:n]) {
+				longest = n
+				break
+			}
+		}
+	}
+	return longest
+}
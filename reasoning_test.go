@@ -0,0 +1,33 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStripReasoning(t *testing.T) {
+	input := "<think>maybe <RUN>rm -rf /</RUN></think>\nHere is the answer."
+	if got := stripReasoning(input, []string{"think"}); got != "Here is the answer." {
+		t.Errorf("Unexpected result %q", got)
+	}
+	if got := stripReasoning("\n<think>cut off", []string{"think"}); got != "" {
+		t.Errorf("Expected reasoning cut off at the start to be stripped, got %q", got)
+	}
+	if got := stripReasoning("Use <think> to reason.\n<RUN>make</RUN>", []string{"think"}); got != "Use <think> to reason.\n<RUN>make</RUN>" {
+		t.Errorf("Expected an unclosed tag mid-response to keep the text after it, got %q", got)
+	}
+	if len(parseActions(stripReasoning(input, []string{"think"}))) != 0 {
+		t.Errorf("Expected no actions from stripped reasoning")
+	}
+}
+
+func TestReasoningWriterSplitTags(t *testing.T) {
+	var sb strings.Builder
+	w := newReasoningWriter(&sb, []string{"think"}, false)
+	for _, chunk := range []string{"Hi <th", "ink>secret</thi", "nk> there"} {
+		w.Write([]byte(chunk))
+	}
+	if got := sb.String(); got != "Hi  there" {
+		t.Errorf("Expected reasoning to be hidden, got %q", got)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+func cmdReloadConfig(ctx context.Context, s *session, args string) {
+	cwd, _ := os.Getwd()
+	if err := s.reloadConfig(globalConfigFile, cwd); err != nil {
+		logError("Error reloading config: %v", err)
+		fmt.Fprintln(console, "Keeping the current settings.")
+		return
+	}
+	fmt.Fprintf(console, "Reloaded the config; using %s with %s.\n", s.provider, s.config.SelectedModel)
+}
+
+// reloadConfig re-reads the config layers, with globalFile and the project
+// config found from dir around the session's user config, and applies them to
+// the session. The client is rebuilt with the conversation and the session's
+// spend carried over, so changes to the model, provider or request settings
+// take effect on the next request. On error nothing is changed.
+func (s *session) reloadConfig(globalFile, dir string) error {
+	config, err := loadConfigLayered(globalFile, s.configFile, dir)
+	if err != nil {
+		return err
+	}
+	if err := validateModelControls(config); err != nil {
+		return err
+	}
+	if err := validateResponseFormat(config); err != nil {
+		return err
+	}
+	if err := validateLineEndings(config); err != nil {
+		return err
+	}
+	if envModel := os.Getenv("ARISU_MODEL"); envModel != "" {
+		config.SelectedModel = normalizeModel(envModel)
+	}
+	if config.SelectedModel == "" {
+		config.SelectedModel = "gemini"
+	}
+	provider := resolveProvider(config)
+	if provider == "" {
+		return fmt.Errorf("invalid selected model %q", config.SelectedModel)
+	}
+	apiKey := config.APIKeys[provider]
+	if apiKey == "" {
+		apiKey = os.Getenv(apiKeyEnv(provider))
+	}
+	if apiKey == "" {
+		return fmt.Errorf("no API key for %s in the config", provider)
+	}
+	if err := setTagNames(config.TagNames); err != nil {
+		return err
+	}
+	if err := setEnabledActions(config.EnabledActions); err != nil {
+		_ = setTagNames(s.config.TagNames)
+		return err
+	}
+	projectMemory = config.ProjectMemory
+	projectHints = detectProjectHints(".", config.ProjectHints)
+
+	history := s.client.GetHistory()
+	var messages []Message
+	for _, msg := range history {
+		if msg.Role != "system" {
+			messages = append(messages, msg)
+		}
+	}
+	// The REPL and the loops hold s.config, so it is updated in place.
+	*s.config = *config
+	client := newSessionClient(s.config, provider, apiKey, systemPrompt(s.noSystemPrompt || structuredOutput(config)))
+	client.SetOutput(sessionOutput(s.config, s.stream))
+	client.SetHistory(messages)
+	if old := costLimiter(s.client); old != nil {
+		s.spent = old.spent
+	}
+	if limiter := costLimiter(client); limiter != nil {
+		limiter.carrySpend(s.spent)
+	}
+	s.client.Close()
+	s.client = client
+	s.provider = provider
+	// Gemini keeps no system message in its history; keep logging in step.
+	s.lastLoggedIndex += len(client.GetHistory()) - len(history)
+	return nil
+}
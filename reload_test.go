@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReloadConfigRebuildsClientWithHistory(t *testing.T) {
+	t.Setenv("ARISU_MODEL", "")
+	configFile := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(configFile, []byte(`{"selected_model": "gpt-4o", "api_keys": {"openai": "key"}, "auto_run": true}`), 0600)
+
+	old := &scriptedClient{history: []Message{{Role: "user", Content: "hi"}, {Role: "assistant", Content: "hello"}}}
+	config := &Config{SelectedModel: "grok-2-latest"}
+	s := &session{client: old, config: config, provider: "grok", configFile: configFile, lastLoggedIndex: 2}
+	if err := s.reloadConfig("", t.TempDir()); err != nil {
+		t.Fatalf("reloadConfig failed: %v", err)
+	}
+	if s.provider != "openai" || config.SelectedModel != "gpt-4o" || !config.AutoRun {
+		t.Errorf("Expected the new settings in place, got provider %s and %+v", s.provider, config)
+	}
+	history := s.client.GetHistory()
+	if len(history) != 3 || history[0].Role != "system" || history[2].Content != "hello" {
+		t.Errorf("Expected the conversation after the system prompt, got %+v", history)
+	}
+	if s.lastLoggedIndex != 3 {
+		t.Errorf("lastLoggedIndex = %d, want 3", s.lastLoggedIndex)
+	}
+}
+
+func TestReloadConfigKeepsSettingsOnError(t *testing.T) {
+	t.Setenv("ARISU_MODEL", "")
+	configFile := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(configFile, []byte(`{"selected_model": "gpt-4o", "api_keys": {}}`), 0600)
+
+	client := &scriptedClient{}
+	config := &Config{SelectedModel: "grok-2-latest"}
+	s := &session{client: client, config: config, provider: "grok", configFile: configFile}
+	if err := s.reloadConfig("", t.TempDir()); err == nil {
+		t.Fatal("Expected an error without an API key for the new provider")
+	}
+	if s.client != AIClient(client) || config.SelectedModel != "grok-2-latest" {
+		t.Errorf("Expected the session to be unchanged, got %s", config.SelectedModel)
+	}
+}
+
+func TestReloadConfigCarriesSessionSpend(t *testing.T) {
+	t.Setenv("ARISU_MODEL", "")
+	configFile := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(configFile, []byte(`{"selected_model": "gpt-4o", "api_keys": {"openai": "key"}, "max_session_cost_usd": 5}`), 0600)
+
+	old := &costLimitedClient{AIClient: &scriptedClient{}, limit: 5, spent: 4.5, warned: true}
+	s := &session{client: old, config: &Config{SelectedModel: "gpt-4o"}, provider: "openai", configFile: configFile}
+	if err := s.reloadConfig("", t.TempDir()); err != nil {
+		t.Fatalf("reloadConfig failed: %v", err)
+	}
+	limiter := costLimiter(s.client)
+	if limiter == nil || limiter.spent != 4.5 || !limiter.warned {
+		t.Errorf("Expected the new client to start at the spend so far, got %+v", limiter)
+	}
+}
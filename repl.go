@@ -1,6 +1,8 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -8,6 +10,8 @@ import (
 
 	"github.com/charmbracelet/bubbles/textarea"
 	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/term"
 )
 
 type errMsg error
@@ -18,14 +22,44 @@ type model struct {
 	input    string
 	quitting bool
 	aborted  bool
+	// history holds earlier inputs for Up/Down recall; historyIdx is the
+	// recalled entry, len(history) while editing draft.
+	history    []string
+	historyIdx int
+	draft      string
 }
 
-func initialModel() model {
+const (
+	defaultPrompt             = "λ "
+	defaultContinuationPrompt = ".. "
+)
+
+// replPrompts returns the configured input prompts, falling back to the defaults.
+func replPrompts(config *Config) (string, string) {
+	prompt, continuation := config.Prompt, config.ContinuationPrompt
+	if prompt == "" {
+		prompt = defaultPrompt
+	}
+	if continuation == "" {
+		continuation = defaultContinuationPrompt
+	}
+	return prompt, continuation
+}
+
+func initialModel(config *Config, history []string) model {
 	ti := textarea.New()
 	ti.Placeholder = "Ask Arisu... (Enter to send, Ctrl+N/Alt+Enter for new line, Ctrl+E for editor)"
 	ti.Focus()
 
-	ti.Prompt = "λ "
+	prompt, continuation := replPrompts(config)
+	width := max(lipgloss.Width(prompt), lipgloss.Width(continuation))
+	ti.SetPromptFunc(width, func(lineIdx int) string {
+		p := continuation
+		if lineIdx == 0 {
+			p = prompt
+		}
+		return p + strings.Repeat(" ", width-lipgloss.Width(p))
+	})
 	ti.CharLimit = 0 // Unlimited
 	ti.SetWidth(80)
 	ti.SetHeight(3)
@@ -36,8 +70,28 @@ func initialModel() model {
 	ti.KeyMap.InsertNewline.SetEnabled(false)
 
 	return model{
-		textarea: ti,
-		err:      nil,
+		textarea:   ti,
+		err:        nil,
+		history:    history,
+		historyIdx: len(history),
+	}
+}
+
+// recallHistory moves delta entries through the input history, keeping the
+// unsent draft so Down past the newest entry brings it back.
+func (m *model) recallHistory(delta int) {
+	idx := m.historyIdx + delta
+	if idx < 0 || idx > len(m.history) {
+		return
+	}
+	if m.historyIdx == len(m.history) {
+		m.draft = m.textarea.Value()
+	}
+	m.historyIdx = idx
+	if idx == len(m.history) {
+		m.textarea.SetValue(m.draft)
+	} else {
+		m.textarea.SetValue(m.history[idx])
 	}
 }
 
@@ -111,7 +165,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.textarea.InsertString("\n")
 				return m, nil
 			}
-			
+
 			// Standard Enter -> Submit
 			m.input = m.textarea.Value()
 			m.quitting = true
@@ -127,6 +181,24 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			// Explicit newline
 			m.textarea.InsertString("\n")
 			return m, nil
+		case tea.KeyCtrlU:
+			// Clear the whole buffer, not just the line before the cursor
+			m.textarea.Reset()
+			return m, nil
+		case tea.KeyCtrlL:
+			// Clear the screen and redraw the input
+			return m, tea.ClearScreen
+		case tea.KeyUp:
+			// Recall older input from the first line; elsewhere Up moves the cursor
+			if m.textarea.Line() == 0 {
+				m.recallHistory(-1)
+				return m, nil
+			}
+		case tea.KeyDown:
+			if m.textarea.Line() == m.textarea.LineCount()-1 {
+				m.recallHistory(1)
+				return m, nil
+			}
 		}
 
 	case errMsg:
@@ -150,23 +222,106 @@ func (m model) View() string {
 	) + "\n"
 }
 
-// StartREPL starts the Bubble Tea input loop
-func StartREPL(client AIClient, config *Config, logFile string) {
-	fmt.Println("Welcome to Arisu. Type 'exit' to quit.")
-	
-	lastLoggedIndex := 0
+// expandMentions replaces each @filename in input with the file's contents.
+// With config.ScanMentions, files that look like they contain secrets are only
+// inlined after the user confirms, optionally with the secrets redacted.
+func expandMentions(input string, config *Config) string {
+	words := strings.Fields(input)
+	finalInput := input
+	for _, word := range words {
+		if strings.HasPrefix(word, "@") {
+			filename := strings.TrimPrefix(word, "@")
+			content, err := os.ReadFile(filename)
+			if err != nil {
+				continue
+			}
+			text := string(content)
+			if config.ScanMentions {
+				if kinds := findSecrets(text); len(kinds) > 0 {
+					var ok bool
+					text, ok = confirmSecrets(filename, text, kinds)
+					if !ok {
+						continue
+					}
+				}
+			}
+			fileBlock := fmt.Sprintf("\n<FILE name=\"%s\">\n%s\n</FILE>\n", filename, text)
+			finalInput = strings.Replace(finalInput, word, fileBlock, 1)
+		}
+	}
+	return finalInput
+}
+
+// confirmSecrets asks whether to send, redact or skip a file that appears to contain secrets.
+func confirmSecrets(filename, content string, kinds []string) (string, bool) {
+	fmt.Fprintf(console, "%s appears to contain secrets (%s).\n", filename, strings.Join(kinds, ", "))
+	if promptsDisabled {
+		fmt.Fprintf(console, "Skipped %s: no one to confirm.\n", filename)
+		return "", false
+	}
+	fmt.Fprint(console, "Send as is (y), redact (r) or skip (n)? ")
+	scanner := stdinScanner
+	if scanner.Scan() {
+		switch strings.ToLower(strings.TrimSpace(scanner.Text())) {
+		case "y":
+			return content, true
+		case "r":
+			return redactSecrets(content), true
+		}
+	}
+	fmt.Fprintf(console, "Skipped %s.\n", filename)
+	return "", false
+}
+
+// stdinScanner is shared by every prompt that reads a line from stdin, so
+// input read ahead from a pipe, or typed ahead while a turn ran, is not lost
+// between prompts.
+var stdinScanner = bufio.NewScanner(typeAheadReader{os.Stdin})
 
+// interactiveTerminal reports whether stdin and stdout are terminals that can
+// run the Bubble Tea input.
+func interactiveTerminal() bool {
+	if os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return isTerminal(os.Stdin) && isTerminal(os.Stdout)
+}
+
+// isTerminal reports whether f is a TTY. Other character devices such as
+// /dev/null, which CI jobs often use as stdin, are not terminals.
+func isTerminal(f *os.File) bool {
+	return term.IsTerminal(f.Fd())
+}
+
+// StartREPL starts the Bubble Tea input loop, or the plain line-based loop
+// when the terminal can't run it. It returns when the user quits or ctx is cancelled.
+func StartREPL(ctx context.Context, s *session) {
+	fmt.Fprintln(console, "Welcome to Arisu. Type 'exit' to quit.")
+
+	if !interactiveTerminal() {
+		startPlainREPL(ctx, s)
+		return
+	}
+
+	history := loadInputHistory(inputHistoryFile)
 	for {
-		p := tea.NewProgram(initialModel())
+		start := initialModel(s.config, history)
+		start.textarea.SetValue(takeTypeAhead())
+		p := tea.NewProgram(start, tea.WithContext(ctx))
 		m, err := p.Run()
+		if ctx.Err() != nil {
+			fmt.Fprintln(console, "Shutting down.")
+			return
+		}
 		if err != nil {
-			fmt.Printf("Error running program: %v\n", err)
+			logWarn("Rich input unavailable (%v); falling back to plain input.", err)
+			startPlainREPL(ctx, s)
 			return
 		}
 
 		finalModel := m.(model)
 		if finalModel.aborted {
-			fmt.Println("Goodbye!")
+			fmt.Fprintln(console, "Goodbye!")
 			return
 		}
 
@@ -174,51 +329,76 @@ func StartREPL(client AIClient, config *Config, logFile string) {
 		if input == "" {
 			continue
 		}
+		history = addInputHistory(inputHistoryFile, history, input)
 
-		if input == "exit" {
-			fmt.Println("Goodbye!")
+		// Bubble Tea clears its view on exit, so echo the prompt and input to
+		// keep them in the terminal scrollback.
+		prompt, _ := replPrompts(s.config)
+		fmt.Fprintf(console, "%s%s\n", prompt, input)
+
+		if !handleREPLInput(ctx, s, input) {
 			return
 		}
+	}
+}
 
-		// Print the user's input to stdout so it remains in history
-		// (Bubble Tea clears the view on exit usually, or we can make it persistent)
-		// Since we returned "", the view is cleared. We should print the prompt and input.
-		fmt.Printf("λ %s\n", input)
-
-		// Process @ mentions
-		words := strings.Fields(input)
-		finalInput := input
-		for _, word := range words {
-			if strings.HasPrefix(word, "@") {
-				filename := strings.TrimPrefix(word, "@")
-				content, err := os.ReadFile(filename)
-				if err == nil {
-					fileBlock := fmt.Sprintf("\n<FILE name=\"%s\">\n%s\n</FILE>\n", filename, string(content))
-					finalInput = strings.Replace(finalInput, word, fileBlock, 1)
+// startPlainREPL reads input without a TUI, for pipes, dumb terminals and
+// minimal containers. Lines are collected until a blank line submits them.
+func startPlainREPL(ctx context.Context, s *session) {
+	prompt, continuation := replPrompts(s.config)
+	fmt.Fprintln(console, "(plain input: finish a message with a blank line)")
+	for {
+		var lines []string
+		fmt.Fprint(console, prompt)
+		for {
+			if !stdinScanner.Scan() {
+				// EOF: submit what was typed, then quit.
+				if input := strings.TrimSpace(strings.Join(lines, "\n")); input != "" {
+					fmt.Fprintln(console)
+					if !handleREPLInput(ctx, s, input) {
+						return
+					}
 				}
+				fmt.Fprintln(console, "Goodbye!")
+				return
+			}
+			line := stdinScanner.Text()
+			if strings.TrimSpace(line) == "" {
+				break
 			}
+			lines = append(lines, line)
+			fmt.Fprint(console, continuation)
 		}
+		fmt.Fprintln(console)
 
-		response, err := client.SendMessage(finalInput)
-		if err != nil {
-			fmt.Printf("Error: %v\n", err)
+		input := strings.TrimSpace(strings.Join(lines, "\n"))
+		if input == "" {
 			continue
 		}
-
-		for {
-			output, isToolCall := handleResponse(response, client, config)
-			_ = logMessages(logFile, client.GetHistory(), lastLoggedIndex)
-			lastLoggedIndex = len(client.GetHistory())
-
-			if isToolCall {
-				response, err = client.SendMessage(output)
-				if err != nil {
-					fmt.Printf("Error sending tool output: %v\n", err)
-					break
-				}
-			} else {
-				break
-			}
+		if !handleREPLInput(ctx, s, input) {
+			return
 		}
 	}
 }
+
+// handleREPLInput runs one line of REPL input and reports whether the REPL
+// should keep going.
+func handleREPLInput(ctx context.Context, s *session, input string) bool {
+	if input == "exit" {
+		fmt.Fprintln(console, "Goodbye!")
+		return false
+	}
+
+	if handleSlashCommand(ctx, s, input) {
+		return true
+	}
+
+	finalInput := expandMentions(expandCommands(input, s.config), s.config)
+
+	_ = s.runTurn(ctx, finalInput)
+	if ctx.Err() != nil {
+		fmt.Fprintln(console, "Shutting down.")
+		return false
+	}
+	return true
+}
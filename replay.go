@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// logEntryPattern matches the header written by logMessages for each message.
+var logEntryPattern = regexp.MustCompile(`^\[(\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2})\] ([^:]+): (.*)$`)
+
+// logTimeFormat is the timestamp format of log entry headers.
+const logTimeFormat = "2006-01-02 15:04:05"
+
+// logEntry is a message read from a plaintext log with its timestamp.
+type logEntry struct {
+	Message
+	Time time.Time
+}
+
+// readLogEntries parses a plaintext conversation log back into entries.
+// Message content may span several lines until the next entry header.
+func readLogEntries(path string) ([]logEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []logEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if m := logEntryPattern.FindStringSubmatch(line); m != nil {
+			t, _ := time.ParseInLocation(logTimeFormat, m[1], time.Local)
+			entries = append(entries, logEntry{Message: Message{Role: m[2], Content: m[3]}, Time: t})
+			continue
+		}
+		if len(entries) > 0 {
+			entries[len(entries)-1].Content += "\n" + line
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// readLogMessages parses a plaintext conversation log back into messages.
+func readLogMessages(path string) ([]Message, error) {
+	entries, err := readLogEntries(path)
+	messages := make([]Message, len(entries))
+	for i, e := range entries {
+		messages[i] = e.Message
+	}
+	return messages, err
+}
+
+// loadTranscript reads messages from a session file (.json) or a plaintext log.
+func loadTranscript(path string) ([]Message, error) {
+	if strings.HasSuffix(path, ".json") {
+		s, err := loadSession(path)
+		if err != nil {
+			return nil, err
+		}
+		return s.Messages, nil
+	}
+	return readLogMessages(path)
+}
+
+// isAssistantRole reports whether role belongs to the model. Older logs used
+// Gemini's "model" role; partially streamed entries are skipped.
+func isAssistantRole(role string) bool {
+	return role == "assistant" || role == "model"
+}
+
+// describeAction returns a one-line, human-readable summary of an action.
+func describeAction(action Action) string {
+	switch a := action.(type) {
+	case PatchAction:
+		return fmt.Sprintf("PATCH %s block %d", a.Filename, a.ID)
+	case EditAction:
+		return fmt.Sprintf("EDIT %s (%d bytes)", a.Filename, len(a.Content))
+	case RunAction:
+		return fmt.Sprintf("RUN %s", a.Command)
+	case ReadAction:
+		return fmt.Sprintf("READ %s", a.Filename)
+	case ReadRawAction:
+		return fmt.Sprintf("READ_RAW %s", a.Filename)
+	case ReplaceAction:
+		mode := "exact"
+		if a.Regex {
+			mode = "regex"
+		}
+		return fmt.Sprintf("REPLACE %s (%s)", a.Filename, mode)
+	case ListFilesAction:
+		return fmt.Sprintf("LISTFILES %s", a.Path)
+	case SearchFilesAction:
+		return fmt.Sprintf("SEARCHFILES %s", a.Query)
+	case DiffAction:
+		return fmt.Sprintf("DIFF %s", a.Filename)
+	case MemoryAppendAction:
+		return fmt.Sprintf("MEMORY_APPEND %s", a.Note)
+	}
+	return fmt.Sprintf("%T", action)
+}
+
+// replayTranscript runs every assistant message in path through messageActions
+// and prints the actions that would have fired. Nothing is executed.
+func replayTranscript(path string) error {
+	messages, err := loadTranscript(path)
+	if err != nil {
+		return err
+	}
+	total := 0
+	for i, msg := range messages {
+		for _, item := range messageActions(msg) {
+			prefix := ""
+			if item.IsToolCall {
+				prefix = "[TOOL_CALL] "
+			}
+			fmt.Fprintf(console, "message %d: %s%s\n", i, prefix, describeAction(item.Action))
+			total++
+		}
+	}
+	fmt.Fprintf(console, "%d actions would have fired.\n", total)
+	return nil
+}
+
+// fileImpact is how a transcript's actions would change one file.
+type fileImpact struct {
+	path    string
+	changes []string
+}
+
+// actionImpact is what the actions in a transcript would change: files in
+// the order first touched, and commands in the order they would run.
+type actionImpact struct {
+	files    []*fileImpact
+	commands []string
+}
+
+// collectImpact gathers the effect of every action in the assistant
+// messages. exists reports whether a file is already on disk, which tells
+// whether an EDIT would create or overwrite it.
+func collectImpact(messages []Message, exists func(string) bool) actionImpact {
+	var impact actionImpact
+	byPath := map[string]*fileImpact{}
+	change := func(path, kind string) {
+		f := byPath[path]
+		if f == nil {
+			f = &fileImpact{path: path}
+			byPath[path] = f
+			impact.files = append(impact.files, f)
+		}
+		f.changes = append(f.changes, kind)
+	}
+	for _, msg := range messages {
+		for _, item := range messageActions(msg) {
+			switch a := item.Action.(type) {
+			case EditAction:
+				if byPath[a.Filename] == nil && !exists(a.Filename) {
+					change(a.Filename, "create")
+				} else {
+					change(a.Filename, "overwrite")
+				}
+			case PatchAction:
+				if strings.TrimSpace(a.Content) == "" {
+					change(a.Filename, fmt.Sprintf("delete block %d", a.ID))
+				} else {
+					change(a.Filename, fmt.Sprintf("patch block %d", a.ID))
+				}
+			case ReplaceAction:
+				change(a.Filename, "replace")
+			case DiffAction:
+				change(a.Filename, "diff")
+			case MemoryAppendAction:
+				change(memoryFile, "append")
+			case RunAction:
+				impact.commands = append(impact.commands, a.Command)
+			}
+		}
+	}
+	return impact
+}
+
+// replayImpact reports which files the actions in path would create or
+// change and which commands they would run. Nothing is executed.
+func replayImpact(path string) error {
+	messages, err := loadTranscript(path)
+	if err != nil {
+		return err
+	}
+	impact := collectImpact(messages, func(name string) bool {
+		_, err := os.Stat(name)
+		return err == nil
+	})
+	fmt.Fprintf(console, "Files that would change (%d):\n", len(impact.files))
+	for _, f := range impact.files {
+		fmt.Fprintf(console, "  %s: %s\n", f.path, strings.Join(f.changes, ", "))
+	}
+	fmt.Fprintf(console, "Commands that would run (%d):\n", len(impact.commands))
+	for _, c := range impact.commands {
+		fmt.Fprintf(console, "  %s\n", c)
+	}
+	return nil
+}
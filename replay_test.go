@@ -0,0 +1,33 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCollectImpact(t *testing.T) {
+	messages := []Message{
+		{Role: "user", Content: "<RUN>echo not from the model</RUN>"},
+		{Role: "assistant", Content: "<EDIT>\nnew.go\npackage main\n</EDIT>\n<READ>main.go</READ>"},
+		{Role: "assistant", Content: "<EDIT>\nnew.go\npackage main // v2\n</EDIT>\n<RUN>go test ./...</RUN>"},
+		{Role: "model", Content: "<EDIT>\nmain.go\npackage main\n</EDIT>\n<PATCH>\nmain.go\n2\n\n</PATCH>"},
+	}
+	impact := collectImpact(messages, func(name string) bool { return name == "main.go" })
+
+	got := map[string][]string{}
+	var order []string
+	for _, f := range impact.files {
+		got[f.path] = f.changes
+		order = append(order, f.path)
+	}
+	want := map[string][]string{
+		"new.go":  {"create", "overwrite"},
+		"main.go": {"overwrite", "delete block 2"},
+	}
+	if !reflect.DeepEqual(got, want) || !reflect.DeepEqual(order, []string{"new.go", "main.go"}) {
+		t.Errorf("Unexpected file impact %v (order %v)", got, order)
+	}
+	if !reflect.DeepEqual(impact.commands, []string{"go test ./..."}) {
+		t.Errorf("Unexpected commands %q", impact.commands)
+	}
+}
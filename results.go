@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// errSkipped is returned by actions the user declined to run.
+var errSkipped = errors.New("skipped by the user")
+
+// Action result statuses.
+const (
+	statusApplied = "applied"
+	statusSkipped = "skipped"
+	statusError   = "error"
+	// statusRolledBack marks a patch undone by Config.AtomicPatches.
+	statusRolledBack = "rolled back"
+)
+
+// ActionResult is the structured outcome of one executed action. Success is
+// false only for actions that failed or were rolled back; a declined action
+// did not fail, and Status tells it apart from an applied one.
+type ActionResult struct {
+	Type    string `json:"type"`
+	Target  string `json:"target"`
+	Status  string `json:"status"`
+	Success bool   `json:"success"`
+	Output  string `json:"output"`
+	// file is the file the action changes, for actions that edit files.
+	file string
+}
+
+func newActionResult(action Action, output string, err error) ActionResult {
+	kind, target, _ := strings.Cut(describeAction(action), " ")
+	status := statusApplied
+	if errors.Is(err, errSkipped) {
+		status = statusSkipped
+	} else if err != nil {
+		status = statusError
+	}
+	return ActionResult{Type: kind, Target: target, Status: status, Success: status != statusError, Output: output, file: editedFile(action)}
+}
+
+// editedFile returns the project file action writes to, or "" for actions
+// that don't edit one. MEMORY_APPEND writes arisu's own notes, which are not
+// reported as changed files.
+func editedFile(action Action) string {
+	switch a := action.(type) {
+	case PatchAction:
+		return a.Filename
+	case EditAction:
+		return a.Filename
+	case ReplaceAction:
+		return a.Filename
+	case DiffAction:
+		return a.Filename
+	}
+	return ""
+}
+
+// maxSummaryTarget caps the target column of the action summary.
+const maxSummaryTarget = 60
+
+// printActionSummary prints a compact table of the actions run in a turn.
+func printActionSummary(results []ActionResult) {
+	if len(results) == 0 {
+		return
+	}
+	typeWidth, targetWidth := 0, 0
+	targets := make([]string, len(results))
+	for i, r := range results {
+		target := safeTruncate(strings.ReplaceAll(r.Target, "\n", " "), maxSummaryTarget)
+		targets[i] = target
+		typeWidth = max(typeWidth, len(r.Type))
+		targetWidth = max(targetWidth, len(target))
+	}
+	fmt.Fprintln(console, "Actions this turn:")
+	for i, r := range results {
+		fmt.Fprintf(console, "  %-*s  %-*s  %s\n", typeWidth, r.Type, targetWidth, targets[i], r.Status)
+	}
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestNewActionResultStatus(t *testing.T) {
+	cases := []struct {
+		err     error
+		status  string
+		success bool
+	}{
+		{nil, statusApplied, true},
+		{errSkipped, statusSkipped, true},
+		{fmt.Errorf("read of .env declined: %w", errSkipped), statusSkipped, true},
+		{errors.New("exit status 1"), statusError, false},
+	}
+	for _, c := range cases {
+		r := newActionResult(RunAction{Command: "go test ./..."}, "", c.err)
+		if r.Type != "RUN" || r.Target != "go test ./..." || r.Status != c.status || r.Success != c.success {
+			t.Errorf("newActionResult(%v) = %+v, expected status %s and success %v", c.err, r, c.status, c.success)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultMaxSearchMatches is how many matching lines SEARCHFILES returns when
+// Config.MaxSearchMatches is unset.
+const defaultMaxSearchMatches = 100
+
+// binarySniffSize is how much of a file is checked for NUL bytes before it is
+// treated as binary and skipped.
+const binarySniffSize = 8000
+
+func (s SearchFilesAction) Execute(client AIClient, config *Config, isToolCall bool) (string, error) {
+	limit := config.MaxSearchMatches
+	if limit <= 0 {
+		limit = defaultMaxSearchMatches
+	}
+	output, err := searchFiles(".", s.Query, limit)
+	if err != nil {
+		return fmt.Sprintf("Error searching files: %v", err), err
+	}
+	return output, nil
+}
+
+// searchFiles returns the lines of text files under dir that contain query,
+// as "path:lineno: line", skipping .git, node_modules, binary files and
+// entries that can't be read. At most limit matches are returned, followed by
+// a note when there were more.
+func searchFiles(dir, query string, limit int) (string, error) {
+	if query == "" {
+		return "", fmt.Errorf("empty search query")
+	}
+	var sb strings.Builder
+	matches, more := 0, false
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			logDebug("SEARCHFILES skipped %s: %v", path, err)
+			return nil
+		}
+		if info.IsDir() {
+			if info.Name() == ".git" || info.Name() == "node_modules" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// Symlinks, dangling or not, and other special files are skipped.
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		found, fileMore, err := searchFile(path, query, limit-matches, &sb)
+		matches += found
+		if err != nil {
+			logDebug("SEARCHFILES skipped %s: %v", path, err)
+		}
+		if fileMore {
+			more = true
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if matches == 0 {
+		return "No matches found.", nil
+	}
+	if more {
+		fmt.Fprintf(&sb, "[Stopped after %d matches; narrow the query to see more.]\n", limit)
+	}
+	return sb.String(), nil
+}
+
+// searchFile writes up to limit matching lines of path to sb and returns how
+// many it wrote, and whether the file has a further match past the limit.
+// Files with a NUL byte near the start are skipped as binary.
+func searchFile(path, query string, limit int, sb *strings.Builder) (int, bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, false, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	head, err := r.Peek(binarySniffSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return 0, false, err
+	}
+	if bytes.IndexByte(head, 0) >= 0 {
+		return 0, false, nil
+	}
+
+	found := 0
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := scanner.Text()
+		if !strings.Contains(line, query) {
+			continue
+		}
+		if found == limit {
+			return found, true, nil
+		}
+		fmt.Fprintf(sb, "%s:%d: %s\n", path, lineno, strings.TrimRight(line, "\r"))
+		found++
+	}
+	// Lines too long to scan end the file's search but not the whole search.
+	if err := scanner.Err(); err != nil && err != bufio.ErrTooLong {
+		return found, false, err
+	}
+	return found, false, nil
+}
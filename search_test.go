@@ -0,0 +1,120 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeSearchTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestSearchFilesMultipleMatches(t *testing.T) {
+	dir := writeSearchTree(t, map[string]string{
+		"a.go":                    "package main\nfunc needle() {}\n// needle again\n",
+		"sub/b.txt":               "no match\nthe needle\n",
+		"node_modules/x/index.js": "needle",
+		".git/config":             "needle",
+	})
+
+	output, err := searchFiles(dir, "needle", 10)
+	if err != nil {
+		t.Fatalf("searchFiles failed: %v", err)
+	}
+	want := filepath.Join(dir, "a.go") + ":2: func needle() {}\n" +
+		filepath.Join(dir, "a.go") + ":3: // needle again\n" +
+		filepath.Join(dir, "sub", "b.txt") + ":2: the needle\n"
+	if output != want {
+		t.Errorf("searchFiles = %q, want %q", output, want)
+	}
+}
+
+func TestSearchFilesSkipsBinary(t *testing.T) {
+	dir := writeSearchTree(t, map[string]string{
+		"image.bin": "needle\x00\x01\x02",
+	})
+
+	output, err := searchFiles(dir, "needle", 10)
+	if err != nil {
+		t.Fatalf("searchFiles failed: %v", err)
+	}
+	if output != "No matches found." {
+		t.Errorf("Expected binary file to be skipped, got %q", output)
+	}
+}
+
+func TestSearchFilesCapsMatches(t *testing.T) {
+	dir := writeSearchTree(t, map[string]string{
+		"a.txt": strings.Repeat("needle\n", 5),
+	})
+
+	output, err := searchFiles(dir, "needle", 3)
+	if err != nil {
+		t.Fatalf("searchFiles failed: %v", err)
+	}
+	if got := strings.Count(output, ": needle\n"); got != 3 {
+		t.Errorf("Expected 3 matches, got %d in %q", got, output)
+	}
+	if !strings.Contains(output, "Stopped after 3 matches") {
+		t.Errorf("Expected a note about the cap, got %q", output)
+	}
+}
+
+func TestSearchFilesNotesCapOnlyWhenMoreMatch(t *testing.T) {
+	dir := writeSearchTree(t, map[string]string{
+		"a.txt": "needle\nneedle\n",
+		"b.txt": "needle\n",
+	})
+
+	output, err := searchFiles(dir, "needle", 3)
+	if err != nil {
+		t.Fatalf("searchFiles failed: %v", err)
+	}
+	if strings.Contains(output, "Stopped after") {
+		t.Errorf("Expected no cap note with exactly 3 matches, got %q", output)
+	}
+	output, _ = searchFiles(dir, "needle", 2)
+	if !strings.Contains(output, "Stopped after 2 matches") {
+		t.Errorf("Expected a cap note when b.txt has a further match, got %q", output)
+	}
+}
+
+func TestSearchFilesSkipsUnreadableEntries(t *testing.T) {
+	dir := writeSearchTree(t, map[string]string{
+		"a.txt":            "needle\n",
+		"locked/b.txt":     "needle\n",
+		"secret/notes.txt": "needle\n",
+	})
+	if err := os.Symlink(filepath.Join(dir, "missing"), filepath.Join(dir, "dangling.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(dir, "secret", "notes.txt"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(dir, "locked"), 0); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(filepath.Join(dir, "locked"), 0755)
+
+	output, err := searchFiles(dir, "needle", 10)
+	if err != nil {
+		t.Fatalf("searchFiles failed: %v", err)
+	}
+	if !strings.Contains(output, filepath.Join(dir, "a.txt")+":1: needle") {
+		t.Errorf("Expected the readable match, got %q", output)
+	}
+	if os.Geteuid() != 0 && (strings.Contains(output, "locked") || strings.Contains(output, "secret")) {
+		t.Errorf("Expected unreadable entries to be skipped, got %q", output)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+)
+
+// secretPatterns matches common credential formats. They are shared by every
+// feature that needs to keep secrets away from the provider.
+var secretPatterns = map[string]*regexp.Regexp{
+	"AWS access key":      regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`),
+	"OpenAI API key":      regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{20,}\b`),
+	"Google API key":      regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`),
+	"GitHub token":        regexp.MustCompile(`\b(ghp|gho|ghu|ghs|ghr)_[A-Za-z0-9]{36,}\b`),
+	"xAI API key":         regexp.MustCompile(`\bxai-[A-Za-z0-9]{20,}\b`),
+	"Slack token":         regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}\b`),
+	"private key":         regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`),
+	"password assignment": regexp.MustCompile(`(?i)\b(password|passwd|secret|api[_-]?key|token)\b\s*[:=]\s*["']?[^\s"']{8,}`),
+}
+
+// findSecrets returns the sorted names of the secret kinds found in content.
+func findSecrets(content string) []string {
+	var found []string
+	for name, re := range secretPatterns {
+		if re.MatchString(content) {
+			found = append(found, name)
+		}
+	}
+	sort.Strings(found)
+	return found
+}
+
+// redactSecrets replaces every secret match in content with a placeholder.
+func redactSecrets(content string) string {
+	for _, re := range secretPatterns {
+		content = re.ReplaceAllString(content, "[REDACTED]")
+	}
+	return content
+}
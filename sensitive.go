@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultSensitivePaths are the path patterns that require confirmation before
+// READ sends a file to the model. Patterns without a slash match the base
+// name; the others match the absolute path, with ~ expanded to the home directory.
+var defaultSensitivePaths = []string{
+	".env",
+	".env.*",
+	"*.pem",
+	"*.key",
+	"id_rsa",
+	"id_ecdsa",
+	"id_ed25519",
+	".netrc",
+	".npmrc",
+	"~/.ssh/*",
+	"~/.aws/*",
+	"~/.gnupg/*",
+	"~/.config/arisu/config.json",
+}
+
+// sensitivePaths returns the configured sensitive path patterns.
+func sensitivePaths(config *Config) []string {
+	if config.SensitivePaths != nil {
+		return config.SensitivePaths
+	}
+	return defaultSensitivePaths
+}
+
+// matchSensitivePath returns the first pattern that path matches.
+func matchSensitivePath(path string, patterns []string) (string, bool) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	home, _ := os.UserHomeDir()
+	for _, pattern := range patterns {
+		target := filepath.Base(abs)
+		if strings.Contains(pattern, "/") {
+			target = abs
+			if strings.HasPrefix(pattern, "~/") && home != "" {
+				pattern = filepath.Join(home, pattern[2:])
+			}
+		}
+		if ok, _ := filepath.Match(pattern, target); ok {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+// sensitivePreviewLines is how many lines of a sensitive file are previewed.
+const sensitivePreviewLines = 5
+
+// guardRead asks before a file on a sensitive path, or one that appears to
+// contain secrets, is sent to the model. It always asks, even for tool calls,
+// since a prompt-injected READ is exactly the case it protects against.
+func guardRead(filename, content string, config *Config) (string, bool) {
+	pattern, sensitive := matchSensitivePath(filename, sensitivePaths(config))
+	kinds := findSecrets(content)
+	if !sensitive && len(kinds) == 0 {
+		return content, true
+	}
+	promptMu.Lock()
+	defer promptMu.Unlock()
+	if sensitive {
+		fmt.Fprintf(console, "%s matches the sensitive path pattern %q.\n", filename, pattern)
+	}
+	lines := strings.Split(redactSecrets(content), "\n")
+	if len(lines) > sensitivePreviewLines {
+		lines = append(lines[:sensitivePreviewLines], "...")
+	}
+	fmt.Fprintf(console, "Preview (redacted):\n%s\n", strings.Join(lines, "\n"))
+	if len(kinds) == 0 {
+		kinds = []string{"sensitive path"}
+	}
+	return confirmSecrets(filename, content, kinds)
+}
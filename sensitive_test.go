@@ -0,0 +1,30 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatchSensitivePath(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip("no home directory")
+	}
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{".env", true},
+		{"config/.env.production", true},
+		{"certs/server.pem", true},
+		{filepath.Join(home, ".ssh", "config"), true},
+		{"main.go", false},
+		{"docs/environment.md", false},
+	}
+	for _, tt := range tests {
+		if _, got := matchSensitivePath(tt.path, defaultSensitivePaths); got != tt.want {
+			t.Errorf("matchSensitivePath(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
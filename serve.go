@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Server-mode action policies, set with Config.ServePolicy. Nobody is at the
+// terminal to confirm actions, so everything the policy doesn't allow is
+// declined automatically.
+const (
+	servePolicyReadOnly = "read-only" // READ, LISTFILES, SEARCHFILES only (default)
+	servePolicyEdit     = "edit"      // also apply file edits
+	servePolicyAll      = "all"       // also run commands
+)
+
+// promptsDisabled makes every confirmation prompt decline without reading
+// stdin. It is set in server mode.
+var promptsDisabled bool
+
+// serveTokenEnv names the environment variable that sets the server's bearer
+// token; without it a random token is generated and printed at startup.
+const serveTokenEnv = "ARISU_SERVE_TOKEN"
+
+// newServeToken returns a random bearer token.
+func newServeToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// serveAddr binds addresses given as ":port" to localhost.
+func serveAddr(addr string) string {
+	if strings.HasPrefix(addr, ":") {
+		return "127.0.0.1" + addr
+	}
+	return addr
+}
+
+// chatServer serves an OpenAI-compatible chat completions API backed by the
+// agent. Requests run one at a time because they share the working directory;
+// pins and approvals are reset for each one, while max_session_cost_usd
+// covers the server's whole run.
+type chatServer struct {
+	mu           sync.Mutex
+	token        string
+	config       *Config
+	provider     string
+	apiKey       string
+	systemPrompt string
+	logFile      string
+	// spent is the estimated cost of the requests served so far.
+	spent float64
+}
+
+type chatRequestMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+type chatRequest struct {
+	Messages []chatRequestMessage `json:"messages"`
+	Stream   bool                 `json:"stream"`
+}
+
+// messageText returns the text of a string or content-part array message.
+func messageText(raw json.RawMessage) string {
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		return text
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if json.Unmarshal(raw, &parts) != nil {
+		return ""
+	}
+	var sb strings.Builder
+	for _, p := range parts {
+		if p.Type == "text" {
+			sb.WriteString(p.Text)
+		}
+	}
+	return sb.String()
+}
+
+// serverConfig applies the server policy to a copy of the config.
+func (cs *chatServer) serverConfig() *Config {
+	config := *cs.config
+	config.AutoEdit, config.AutoRun = false, false
+	switch cs.config.ServePolicy {
+	case servePolicyAll:
+		config.AutoEdit, config.AutoRun = true, true
+	case servePolicyEdit:
+		config.AutoEdit = true
+	}
+	return &config
+}
+
+func writeAPIError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]string{"message": msg, "type": "invalid_request_error"},
+	})
+}
+
+// authorize rejects requests that don't carry the server's bearer token, and
+// any request from a browser page: those carry an Origin header, and a page
+// on any site could otherwise drive the agent on localhost.
+func (cs *chatServer) authorize(w http.ResponseWriter, r *http.Request) bool {
+	if r.Header.Get("Origin") != "" {
+		writeAPIError(w, http.StatusForbidden, "browser requests are not allowed")
+		return false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(cs.token)) != 1 {
+		writeAPIError(w, http.StatusUnauthorized, "missing or invalid bearer token")
+		return false
+	}
+	return true
+}
+
+func (cs *chatServer) handleModels(w http.ResponseWriter, r *http.Request) {
+	if !cs.authorize(w, r) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"object": "list",
+		"data":   []map[string]string{{"id": cs.config.SelectedModel, "object": "model", "owned_by": "arisu"}},
+	})
+}
+
+func (cs *chatServer) handleChat(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAPIError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+	if !cs.authorize(w, r) {
+		return
+	}
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		writeAPIError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+		return
+	}
+	var req chatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return
+	}
+	// Arisu's own system prompt is always used; client system messages are dropped.
+	var history []Message
+	for _, m := range req.Messages {
+		if m.Role == "user" || m.Role == "assistant" {
+			history = append(history, Message{Role: m.Role, Content: messageText(m.Content)})
+		}
+	}
+	if len(history) == 0 || history[len(history)-1].Role != "user" {
+		writeAPIError(w, http.StatusBadRequest, "the last message must be from the user")
+		return
+	}
+	input := history[len(history)-1].Content
+	history = history[:len(history)-1]
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	// Pins and "yes to all" approvals belong to this request only.
+	pinnedFiles, approvedFiles = nil, map[string]bool{}
+	defer func() { pinnedFiles, approvedFiles = nil, map[string]bool{} }()
+
+	config := cs.serverConfig()
+	client := newSessionClient(config, cs.provider, cs.apiKey, cs.systemPrompt)
+	defer client.Close()
+	if limiter := costLimiter(client); limiter != nil {
+		limiter.carrySpend(cs.spent)
+		defer func() { cs.spent = limiter.spent }()
+	}
+	stream := newStreamLogger(cs.logFile, config.LogEncoding)
+	client.SetOutput(stream)
+	client.SetHistory(history)
+	s := &session{client: client, config: config, provider: cs.provider, logFile: cs.logFile, stream: stream, lastLoggedIndex: len(client.GetHistory())}
+
+	logInfo("Serving request (%d messages)", len(req.Messages))
+	if err := s.runTurn(r.Context(), input); err != nil {
+		writeAPIError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	writeCompletion(w, config.SelectedModel, lastAssistantResponse(client.GetHistory()), req.Stream)
+}
+
+// writeCompletion sends the final assistant text as a chat completion, or as
+// a one-chunk event stream when the client asked for streaming.
+func writeCompletion(w http.ResponseWriter, model, text string, stream bool) {
+	id := fmt.Sprintf("chatcmpl-arisu-%d", time.Now().UnixNano())
+	created := time.Now().Unix()
+	if !stream {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"id": id, "object": "chat.completion", "created": created, "model": model,
+			"choices": []map[string]interface{}{{
+				"index":         0,
+				"message":       map[string]string{"role": "assistant", "content": text},
+				"finish_reason": "stop",
+			}},
+		})
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	chunk := func(delta map[string]string, finish interface{}) {
+		data, _ := json.Marshal(map[string]interface{}{
+			"id": id, "object": "chat.completion.chunk", "created": created, "model": model,
+			"choices": []map[string]interface{}{{"index": 0, "delta": delta, "finish_reason": finish}},
+		})
+		fmt.Fprintf(w, "data: %s\n\n", data)
+	}
+	chunk(map[string]string{"role": "assistant", "content": text}, nil)
+	chunk(map[string]string{}, "stop")
+	io.WriteString(w, "data: [DONE]\n\n")
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// runServer serves the agent on addr until SIGINT or SIGTERM.
+func runServer(addr string, config *Config, provider, apiKey, systemPrompt, logFile string) error {
+	switch config.ServePolicy {
+	case "", servePolicyReadOnly, servePolicyEdit, servePolicyAll:
+	default:
+		return fmt.Errorf("invalid serve_policy %q (use read-only, edit or all)", config.ServePolicy)
+	}
+	token := os.Getenv(serveTokenEnv)
+	if token == "" {
+		var err error
+		if token, err = newServeToken(); err != nil {
+			return fmt.Errorf("generating the server token: %w", err)
+		}
+	}
+	promptsDisabled = true
+	cs := &chatServer{token: token, config: config, provider: provider, apiKey: apiKey, systemPrompt: systemPrompt, logFile: logFile}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/chat/completions", cs.handleChat)
+	mux.HandleFunc("/v1/models", cs.handleModels)
+	server := &http.Server{Addr: serveAddr(addr), Handler: mux}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	policy := config.ServePolicy
+	if policy == "" {
+		policy = servePolicyReadOnly
+	}
+	fmt.Fprintf(console, "Serving %s on http://%s/v1/chat/completions (actions: %s)\n", config.SelectedModel, server.Addr, policy)
+	if os.Getenv(serveTokenEnv) == "" {
+		fmt.Fprintf(console, "Bearer token: %s (set %s to choose one)\n", token, serveTokenEnv)
+	}
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMessageText(t *testing.T) {
+	if got := messageText(json.RawMessage(`"hello"`)); got != "hello" {
+		t.Errorf("messageText(string) = %q", got)
+	}
+	parts := `[{"type":"text","text":"a"},{"type":"image_url"},{"type":"text","text":"b"}]`
+	if got := messageText(json.RawMessage(parts)); got != "ab" {
+		t.Errorf("messageText(parts) = %q, expected %q", got, "ab")
+	}
+}
+
+func TestServerConfigPolicy(t *testing.T) {
+	for policy, expected := range map[string][2]bool{
+		"":          {false, false},
+		"read-only": {false, false},
+		"edit":      {true, false},
+		"all":       {true, true},
+	} {
+		cs := &chatServer{config: &Config{AutoEdit: true, AutoRun: true, ServePolicy: policy}}
+		config := cs.serverConfig()
+		if config.AutoEdit != expected[0] || config.AutoRun != expected[1] {
+			t.Errorf("policy %q: AutoEdit=%v AutoRun=%v, expected %v", policy, config.AutoEdit, config.AutoRun, expected)
+		}
+	}
+}
+
+// chatRequestFor builds an authorized JSON chat request for cs.
+func chatRequestFor(cs *chatServer, body string) *http.Request {
+	r := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer "+cs.token)
+	r.Header.Set("Content-Type", "application/json")
+	return r
+}
+
+func TestHandleChatRejectsMissingUserMessage(t *testing.T) {
+	cs := &chatServer{token: "secret", config: &Config{}}
+	w := httptest.NewRecorder()
+	body := `{"messages":[{"role":"system","content":"x"},{"role":"assistant","content":"hi"}]}`
+	cs.handleChat(w, chatRequestFor(cs, body))
+	if w.Code != 400 {
+		t.Errorf("status = %d, expected 400", w.Code)
+	}
+}
+
+func TestHandleChatRequiresAuthorizedJSON(t *testing.T) {
+	cs := &chatServer{token: "secret", config: &Config{}}
+	body := `{"messages":[{"role":"user","content":"hi"}]}`
+	for name, tc := range map[string]struct {
+		edit func(r *http.Request)
+		want int
+	}{
+		"no token":    {func(r *http.Request) { r.Header.Del("Authorization") }, http.StatusUnauthorized},
+		"wrong token": {func(r *http.Request) { r.Header.Set("Authorization", "Bearer guess") }, http.StatusUnauthorized},
+		"browser":     {func(r *http.Request) { r.Header.Set("Origin", "https://evil.example") }, http.StatusForbidden},
+		"text/plain":  {func(r *http.Request) { r.Header.Set("Content-Type", "text/plain") }, http.StatusUnsupportedMediaType},
+	} {
+		r := chatRequestFor(cs, body)
+		tc.edit(r)
+		w := httptest.NewRecorder()
+		cs.handleChat(w, r)
+		if w.Code != tc.want {
+			t.Errorf("%s: status = %d, expected %d", name, w.Code, tc.want)
+		}
+	}
+}
+
+func TestWriteCompletion(t *testing.T) {
+	w := httptest.NewRecorder()
+	writeCompletion(w, "gpt-4o", "done", false)
+	var resp struct {
+		Object  string `json:"object"`
+		Choices []struct {
+			Message struct{ Content string } `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if resp.Object != "chat.completion" || len(resp.Choices) != 1 || resp.Choices[0].Message.Content != "done" {
+		t.Errorf("unexpected completion: %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	writeCompletion(w, "gpt-4o", "done", true)
+	out := w.Body.String()
+	if !strings.Contains(out, `"content":"done"`) || !strings.HasSuffix(out, "data: [DONE]\n\n") {
+		t.Errorf("unexpected stream: %s", out)
+	}
+}
+
+func TestHandleChatEnforcesCostLimitAcrossRequests(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("data: {\"choices\":[{\"delta\":{\"content\":\"Done.\"}}]}\n\n" +
+			"data: {\"choices\":[],\"usage\":{\"prompt_tokens\":1000,\"completion_tokens\":1000}}\n\ndata: [DONE]\n"))
+	}))
+	defer server.Close()
+	config := &Config{
+		SelectedModel:     "grok-3",
+		MaxSessionCostUSD: 0.01,
+		ModelPrices:       map[string]modelPrice{"grok-3": {Input: 10, Output: 10}},
+		BaseURLOverrides:  map[string]string{"grok": server.URL},
+	}
+	cs := &chatServer{token: "secret", config: config, provider: "grok", apiKey: "key", logFile: filepath.Join(t.TempDir(), "log")}
+	body := `{"messages":[{"role":"user","content":"hi"}]}`
+
+	w := httptest.NewRecorder()
+	cs.handleChat(w, chatRequestFor(cs, body))
+	if w.Code != http.StatusOK {
+		t.Fatalf("first request: status = %d: %s", w.Code, w.Body)
+	}
+	// The first request spent $0.02, over the $0.01 limit, so the next one is refused.
+	w = httptest.NewRecorder()
+	cs.handleChat(w, chatRequestFor(cs, body))
+	if w.Code != http.StatusBadGateway || !strings.Contains(w.Body.String(), "cost limit") {
+		t.Errorf("second request: status = %d: %s, want the cost limit error", w.Code, w.Body)
+	}
+}
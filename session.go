@@ -0,0 +1,360 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// savedSession is the on-disk format of a conversation that can be resumed
+// with --resume. Roles are canonical ("user"/"assistant") for every provider,
+// and the system prompt is not stored so resuming always uses the current one.
+type savedSession struct {
+	Model    string    `json:"model"`
+	Messages []Message `json:"messages"`
+}
+
+// saveSession writes the non-system messages in history to path.
+func saveSession(path, model string, history []Message) error {
+	s := savedSession{Model: model}
+	for _, msg := range history {
+		if msg.Role == "system" {
+			continue
+		}
+		s.Messages = append(s.Messages, msg)
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// historyDump is the --dump-history and /dump format: the client's history as
+// is, with Gemini's "model" role written as "assistant".
+type historyDump struct {
+	Provider string    `json:"provider"`
+	Model    string    `json:"model"`
+	Messages []Message `json:"messages"`
+}
+
+// dumpHistory writes history to path as a historyDump.
+func dumpHistory(path, provider, model string, history []Message) error {
+	d := historyDump{Provider: provider, Model: model, Messages: make([]Message, len(history))}
+	for i, msg := range history {
+		if msg.Role == "model" {
+			msg.Role = "assistant"
+		}
+		d.Messages[i] = msg
+	}
+	data, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0600)
+}
+
+// loadSession reads a session written by saveSession.
+func loadSession(path string) (*savedSession, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s savedSession
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("invalid session file %s: %w", path, err)
+	}
+	for _, msg := range s.Messages {
+		if msg.Role != "user" && msg.Role != "assistant" {
+			return nil, fmt.Errorf("invalid role %q in session file %s", msg.Role, path)
+		}
+	}
+	return &s, nil
+}
+
+// loadResume loads the conversation to resume from a session file or a
+// plaintext log. With a non-zero since, only log messages at or after it are
+// kept; session files have no timestamps, so since requires a log.
+func loadResume(path string, since time.Time) (*savedSession, error) {
+	if strings.HasSuffix(path, ".json") {
+		if !since.IsZero() {
+			return nil, fmt.Errorf("--since needs a conversation log; session files have no timestamps")
+		}
+		return loadSession(path)
+	}
+	entries, err := readLogEntries(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &savedSession{}
+	for _, e := range entries {
+		if e.Time.Before(since) {
+			continue
+		}
+		switch {
+		case e.Role == "user":
+			s.Messages = append(s.Messages, e.Message)
+		case isAssistantRole(e.Role):
+			s.Messages = append(s.Messages, Message{Role: "assistant", Content: e.Content})
+		}
+	}
+	// Start at a user message so every provider accepts the history.
+	for len(s.Messages) > 0 && s.Messages[0].Role != "user" {
+		s.Messages = s.Messages[1:]
+	}
+	return s, nil
+}
+
+// parseSince parses a --since cutoff: a duration before now ("90m", "2h",
+// "3d") or a local timestamp ("2025-01-02 15:04:05", "2025-01-02 15:04",
+// "2025-01-02").
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	for _, layout := range []string{logTimeFormat, "2006-01-02 15:04", "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid --since value %q", value)
+}
+
+// session holds the state shared by a conversation's turns and the REPL's
+// slash commands: the client, config, and where the conversation is recorded.
+type session struct {
+	client          AIClient
+	config          *Config
+	provider        string
+	logFile         string
+	sessionFile     string
+	stream          *streamLogger
+	lastLoggedIndex int
+	// configFile and noSystemPrompt let /reload-config rebuild the client.
+	configFile     string
+	noSystemPrompt bool
+	// spent is the session cost counted by clients that /reload-config
+	// replaced, carried into the next one so max_session_cost_usd still holds.
+	spent float64
+}
+
+// runTurn sends input and keeps feeding tool-call output back to the model
+// until it answers without a tool call, then summarizes the actions taken.
+// Ctrl+C cancels the turn's requests; Esc pauses between tool calls.
+func (s *session) runTurn(ctx context.Context, input string) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	ctx, turnSpan := startSpan(ctx, "arisu.turn")
+	turnSpan.set("gen_ai.system", s.provider)
+	turnSpan.set("gen_ai.request.model", s.config.SelectedModel)
+	var results []ActionResult
+	var err error
+	runHook(ctx, "pre", s.config.PreTurnHook, nil)
+	defer func() {
+		printActionSummary(results)
+		// The post-turn hook still runs after Ctrl+C, for the actions already applied.
+		runHook(context.WithoutCancel(ctx), "post", s.config.PostTurnHook, changedFiles(results))
+		turnSpan.set("arisu.actions", len(results))
+		turnSpan.finish(err)
+		flushTraces()
+	}()
+
+	response, err := s.send(ctx, Message{Role: "user", Content: input})
+	if err != nil {
+		_ = s.stream.Keep()
+		logError("Error: %v", err)
+		return err
+	}
+
+	for iteration := 1; ; iteration++ {
+		if s.client.Truncated() {
+			s.record()
+			logWarn("The response was cut off by the output token limit; its actions were not executed. Ask the model to continue, or set auto_continue.")
+			return nil
+		}
+		if structuredOutput(s.config) {
+			s.record()
+			err = reportStructuredResponse(response, s.config.ResponseFormat)
+			return err
+		}
+		if action, ok := danglingActionTag(response); ok {
+			hint := ""
+			if !s.config.AutoContinue {
+				hint = " Set auto_continue to have Arisu ask for the rest."
+			}
+			logWarn("The response ended inside an unclosed <%s> tag; that action was not executed.%s", tagName(action), hint)
+		}
+		loopCtx, loopSpan := startSpan(ctx, "arisu.tool_loop")
+		loopSpan.set("arisu.iteration", iteration)
+		output, isToolCall, batch := handleResponse(loopCtx, response, s.client, s.config)
+		results = append(results, batch...)
+		s.record()
+
+		if !isToolCall {
+			loopSpan.finish(nil)
+			speak(s.config, response)
+			return nil
+		}
+		switch choice, instruction := checkPause(); choice {
+		case pauseStop:
+			loopSpan.finish(nil)
+			fmt.Fprintln(console, "Stopped; the tool output was not sent to the model.")
+			return nil
+		case pauseInstruct:
+			output = withInstruction(output, instruction)
+		}
+		response, err = s.send(loopCtx, Message{Role: "user", Content: output, ToolOutput: true})
+		loopSpan.finish(err)
+		if err != nil {
+			_ = s.stream.Keep()
+			logError("Error sending tool output: %v", err)
+			return err
+		}
+	}
+}
+
+// maxContinuations caps how many times send asks for the rest of a truncated response.
+const maxContinuations = 3
+
+const continuePrompt = "Your previous response was cut off. Continue exactly where you stopped, without repeating anything."
+
+const continueTagPrompt = "Your previous response was cut off inside an unclosed <%s> tag. " +
+	"Continue exactly where you stopped, without repeating anything, and close the tag."
+
+// send sends msg and, with Config.AutoContinue, keeps asking the model to
+// continue while its response is truncated or ends inside an unclosed action
+// tag, returning the joined response. The session notes, pinned files and git
+// status are sent ahead of msg but only msg is kept in the history, so they
+// don't pile up turn after turn.
+func (s *session) send(ctx context.Context, msg Message) (string, error) {
+	sent := s.notesContext() + pinnedContext(s.config) + requestGitContext(s.config) + msg.Content
+	response, err := s.client.SendMessage(ctx, sent)
+	recordUsage(s.client)
+	storeMessage(s.client, sent, msg)
+	for i := 0; err == nil && s.config.AutoContinue && i < maxContinuations; i++ {
+		prompt := continuePrompt
+		if action, ok := danglingActionTag(response); ok {
+			logInfo("Response ended inside <%s>, asking the model to continue...", tagName(action))
+			prompt = fmt.Sprintf(continueTagPrompt, tagName(action))
+		} else if s.client.Truncated() {
+			logInfo("Response truncated, asking the model to continue...")
+		} else {
+			break
+		}
+		var rest string
+		rest, err = s.client.SendMessage(ctx, prompt)
+		recordUsage(s.client)
+		response = strings.TrimSuffix(response, "\n") + rest
+	}
+	return response, err
+}
+
+// storeMessage replaces the last user message in client's history that was
+// sent as sent with msg, so the history keeps msg's content and flags. The
+// clients' SendMessage and AddMessage only take the text.
+func storeMessage(client AIClient, sent string, msg Message) {
+	if sent == msg.Content && !msg.ToolOutput {
+		return
+	}
+	history := client.GetHistory()
+	if len(history) > 0 && history[0].Role == "system" {
+		history = history[1:]
+	}
+	history = append([]Message(nil), history...)
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Role == "user" && history[i].Content == sent {
+			history[i] = msg
+			client.SetHistory(history)
+			return
+		}
+	}
+}
+
+// addToolOutput adds action output to client's history as a tool-output message.
+func addToolOutput(client AIClient, output string) {
+	client.AddMessage("user", output)
+	storeMessage(client, output, Message{Role: "user", Content: output, ToolOutput: true})
+}
+
+// record appends new messages to the log and saves the session file.
+func (s *session) record() {
+	_ = s.stream.Finish()
+	history := s.client.GetHistory()
+	_ = logMessages(s.logFile, history, s.lastLoggedIndex, s.config.LogEncoding)
+	s.lastLoggedIndex = len(history)
+	if s.sessionFile != "" {
+		if err := saveSession(s.sessionFile, s.config.SelectedModel, history); err != nil {
+			logError("Error saving session: %v", err)
+		}
+	}
+}
+
+// turnStarts returns the index of each message that starts a turn: a user
+// message that is not tool output fed back to the model.
+func turnStarts(messages []Message) []int {
+	var starts []int
+	for i, msg := range messages {
+		if msg.Role == "user" && !msg.ToolOutput {
+			starts = append(starts, i)
+		}
+	}
+	return starts
+}
+
+// trimHistory keeps the last maxTurns turns of messages (all of them when
+// maxTurns is not positive), then drops the oldest remaining turns until the
+// estimate fits maxTokens (when positive). The last turn is always kept.
+func trimHistory(messages []Message, maxTurns, maxTokens int) []Message {
+	starts := turnStarts(messages)
+	if len(starts) == 0 {
+		return messages
+	}
+	first := 0
+	if maxTurns > 0 && len(starts) > maxTurns {
+		first = len(starts) - maxTurns
+	}
+	for maxTokens > 0 && first < len(starts)-1 && estimateTokens(messages[starts[first]:]) > maxTokens {
+		first++
+	}
+	return messages[starts[first]:]
+}
+
+// trimSessionFile trims the session at path with trimHistory and writes it
+// back, moving the original to the trash first when the trash is enabled.
+// Session files never hold the system prompt, which is rebuilt on resume.
+func trimSessionFile(path string, maxTurns, maxTokens int, config *Config) error {
+	s, err := loadSession(path)
+	if err != nil {
+		return err
+	}
+	kept := trimHistory(s.Messages, maxTurns, maxTokens)
+	if len(kept) == len(s.Messages) {
+		fmt.Fprintf(console, "%s already fits: %d messages, about %d tokens.\n", path, len(kept), estimateTokens(kept))
+		return nil
+	}
+	if useTrash(config) {
+		if _, err := trashFile(trashDir, path); err != nil {
+			return fmt.Errorf("could not back up %s to the trash: %w", path, err)
+		}
+	}
+	if err := saveSession(path, s.Model, kept); err != nil {
+		return err
+	}
+	fmt.Fprintf(console, "Trimmed %s from %d to %d messages (about %d tokens).\n", path, len(s.Messages), len(kept), estimateTokens(kept))
+	return nil
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGeminiSessionRoundTrip(t *testing.T) {
+	opts := clientOptions{systemPrompt: "system prompt", maxHistory: 50}
+	c := NewClient("test-key", "gemini-2.0-flash", opts)
+	c.AddMessage("user", "read main.go")
+	c.AddMessage("assistant", "[TOOL_CALL] <READ>main.go</READ>")
+	c.AddMessage("user", "Content of main.go")
+	c.AddMessage("user", "and the tests?")
+	c.AddMessage("assistant", "They pass.")
+
+	path := filepath.Join(t.TempDir(), "session.json")
+	if err := saveSession(path, "gemini", c.GetHistory()); err != nil {
+		t.Fatalf("saveSession failed: %v", err)
+	}
+	loaded, err := loadSession(path)
+	if err != nil {
+		t.Fatalf("loadSession failed: %v", err)
+	}
+
+	want := []Message{
+		{Role: "user", Content: "read main.go"},
+		{Role: "assistant", Content: "[TOOL_CALL] <READ>main.go</READ>"},
+		{Role: "user", Content: "Content of main.go\n\nand the tests?"},
+		{Role: "assistant", Content: "They pass."},
+	}
+	if len(loaded.Messages) != len(want) {
+		t.Fatalf("Expected %d saved messages, got %d", len(want), len(loaded.Messages))
+	}
+	for i, msg := range loaded.Messages {
+		if msg != want[i] {
+			t.Errorf("Message %d: expected %#v, got %#v", i, want[i], msg)
+		}
+	}
+
+	restored := NewClient("test-key", "gemini-2.0-flash", opts)
+	restored.SetHistory(loaded.Messages)
+
+	for i, content := range restored.cs.History {
+		wantRole := "user"
+		if i%2 == 1 {
+			wantRole = "model"
+		}
+		if content.Role != wantRole {
+			t.Errorf("History %d: expected role %s, got %s", i, wantRole, content.Role)
+		}
+	}
+	got := restored.GetHistory()
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d restored messages, got %d", len(want), len(got))
+	}
+	for i, msg := range got {
+		if msg != want[i] {
+			t.Errorf("Restored message %d: expected %#v, got %#v", i, want[i], msg)
+		}
+	}
+}
+
+func TestLoadSessionRejectsUnknownRoles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.json")
+	if err := saveSession(path, "gpt-4o", []Message{{Role: "model", Content: "hi"}}); err != nil {
+		t.Fatalf("saveSession failed: %v", err)
+	}
+	if _, err := loadSession(path); err == nil {
+		t.Errorf("Expected an error for a non-canonical role")
+	}
+}
+
+func TestLoadResumeSince(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "conversation.log")
+	log := "[2025-01-01 10:00:00] system: prompt\n" +
+		"[2025-01-01 10:00:01] user: old question\n" +
+		"[2025-01-01 10:00:02] assistant: old answer\n" +
+		"[2025-01-02 09:00:00] assistant: stray answer\n" +
+		"[2025-01-02 09:00:01] user: new question\nsecond line\n" +
+		"[2025-01-02 09:00:02] model: new answer\n"
+	if err := os.WriteFile(path, []byte(log), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	since, err := parseSince("2025-01-02", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := loadResume(path, since)
+	if err != nil {
+		t.Fatalf("loadResume failed: %v", err)
+	}
+	expected := []Message{
+		{Role: "user", Content: "new question\nsecond line"},
+		{Role: "assistant", Content: "new answer"},
+	}
+	if !reflect.DeepEqual(s.Messages, expected) {
+		t.Errorf("Unexpected messages %#v", s.Messages)
+	}
+
+	if _, err := loadResume(filepath.Join(t.TempDir(), "session.json"), since); err == nil {
+		t.Errorf("Expected --since to be rejected for session files")
+	}
+}
+
+func TestGeminiSeparateUserTurns(t *testing.T) {
+	opts := clientOptions{systemPrompt: "system prompt", maxHistory: 50, separateUserTurns: true}
+	c := NewClient("test-key", "gemini-2.0-flash", opts)
+	c.AddMessage("user", "Command output: ok")
+	c.AddMessage("user", "now fix it")
+
+	if len(c.cs.History) != 3 || c.cs.History[1].Role != "model" {
+		t.Fatalf("Expected a placeholder model turn between user turns, got %d entries", len(c.cs.History))
+	}
+	expected := []Message{{Role: "user", Content: "Command output: ok"}, {Role: "user", Content: "now fix it"}}
+	if got := c.GetHistory(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected placeholders hidden from history, got %#v", got)
+	}
+}
+
+func TestTrimHistory(t *testing.T) {
+	messages := []Message{
+		{Role: "user", Content: "first"},
+		{Role: "assistant", Content: "[TOOL_CALL] <READ>a.go</READ>"},
+		{Role: "user", Content: wrapToolOutput("READ a.go", strings.Repeat("x", 400)), ToolOutput: true},
+		{Role: "assistant", Content: "done"},
+		{Role: "user", Content: "second"},
+		{Role: "assistant", Content: "ok"},
+		{Role: "user", Content: "third"},
+		{Role: "assistant", Content: "ok"},
+	}
+	if got := trimHistory(messages, 2, 0); !reflect.DeepEqual(got, messages[4:]) {
+		t.Errorf("trimHistory(2 turns) = %v", got)
+	}
+	if got := trimHistory(messages, 0, 50); !reflect.DeepEqual(got, messages[4:]) {
+		t.Errorf("trimHistory(50 tokens) kept %d messages, expected 4", len(got))
+	}
+	if got := trimHistory(messages, 0, 1); !reflect.DeepEqual(got, messages[6:]) {
+		t.Errorf("Expected the last turn to be kept, got %v", got)
+	}
+
+	path := filepath.Join(t.TempDir(), "session.json")
+	if err := saveSession(path, "gpt-4o", messages); err != nil {
+		t.Fatal(err)
+	}
+	if err := trimSessionFile(path, 1, 0, &Config{UseTrash: new(bool)}); err != nil {
+		t.Fatalf("trimSessionFile failed: %v", err)
+	}
+	s, err := loadSession(path)
+	if err != nil || s.Model != "gpt-4o" || !reflect.DeepEqual(s.Messages, messages[6:]) {
+		t.Errorf("unexpected trimmed session %+v, %v", s, err)
+	}
+}
+
+// scriptedClient replies with canned responses and records what it was sent.
+type scriptedClient struct {
+	replies []string
+	sent    []string
+	history []Message
+}
+
+func (c *scriptedClient) SendMessage(ctx context.Context, input string) (string, error) {
+	c.sent = append(c.sent, input)
+	reply := c.replies[0]
+	c.replies = c.replies[1:]
+	c.history = append(c.history, Message{Role: "user", Content: input}, Message{Role: "assistant", Content: reply})
+	return reply, nil
+}
+func (c *scriptedClient) AddMessage(role, content string) {
+	c.history = append(c.history, Message{Role: role, Content: content})
+}
+func (c *scriptedClient) GetHistory() []Message         { return c.history }
+func (c *scriptedClient) SetOutput(w io.Writer)         {}
+func (c *scriptedClient) SetHistory(messages []Message) { c.history = messages }
+func (c *scriptedClient) Close() error                  { return nil }
+func (c *scriptedClient) Truncated() bool               { return false }
+
+func TestSendContinuesDanglingActionTag(t *testing.T) {
+	client := &scriptedClient{replies: []string{"Writing it.\n<EDIT>\nnotes.txt\nhel\n", "lo\n</EDIT>\n"}}
+	s := &session{client: client, config: &Config{AutoContinue: true}}
+	response, err := s.send(context.Background(), Message{Role: "user", Content: "write notes"})
+	if err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+	if len(client.sent) != 2 || !strings.Contains(client.sent[1], "<EDIT>") {
+		t.Fatalf("Expected one continuation request naming the tag, sent %q", client.sent)
+	}
+	actions := parseActions(response)
+	if len(actions) != 1 {
+		t.Fatalf("Expected the stitched response to hold 1 action, got %d", len(actions))
+	}
+	if edit := actions[0].Action.(EditAction); edit.Content != "hello" {
+		t.Errorf("Stitched content = %q, expected %q", edit.Content, "hello")
+	}
+
+	client = &scriptedClient{replies: []string{"<RUN>ls</RUN>\n"}}
+	s = &session{client: client, config: &Config{AutoContinue: true}}
+	if _, err := s.send(context.Background(), Message{Role: "user", Content: "list"}); err != nil || len(client.sent) != 1 {
+		t.Errorf("Expected no continuation for a complete response, sent %q", client.sent)
+	}
+}
+
+func TestDumpHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dump.json")
+	history := []Message{{Role: "user", Content: "hi"}, {Role: "model", Content: "hello"}}
+	if err := dumpHistory(path, "gemini", "gemini-2.0-flash", history); err != nil {
+		t.Fatalf("dumpHistory failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var d historyDump
+	if err := json.Unmarshal(data, &d); err != nil {
+		t.Fatalf("invalid dump: %v", err)
+	}
+	expected := []Message{{Role: "user", Content: "hi"}, {Role: "assistant", Content: "hello"}}
+	if d.Provider != "gemini" || !reflect.DeepEqual(d.Messages, expected) {
+		t.Errorf("unexpected dump %+v", d)
+	}
+}
+
+func TestToolOutputIsMarkedInHistory(t *testing.T) {
+	client := &scriptedClient{}
+	handleResponse(t.Context(), "<LISTFILES>"+t.TempDir()+"</LISTFILES>", client, &Config{})
+	if len(client.history) != 1 || !client.history[0].ToolOutput {
+		t.Fatalf("Expected the action output to be marked as tool output, got %+v", client.history)
+	}
+
+	// Tool output doesn't start a turn, whatever its content starts with.
+	messages := []Message{
+		{Role: "user", Content: "question"},
+		{Role: "assistant", Content: "<RUN>ls</RUN>"},
+		{Role: "user", Content: "Pinned files (current contents):\n...", ToolOutput: true},
+		{Role: "assistant", Content: "done"},
+	}
+	if starts := turnStarts(messages); !reflect.DeepEqual(starts, []int{0}) {
+		t.Errorf("turnStarts = %v, expected [0]", starts)
+	}
+
+	c := NewClient("test-key", "gemini-2.0-flash", clientOptions{maxHistory: 50})
+	c.SetHistory(messages)
+	if got := c.GetHistory(); !reflect.DeepEqual(got, messages) {
+		t.Errorf("Expected Gemini to keep the tool output flag, got %+v", got)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// streamStats measures a streamed response: time to first token and
+// throughput. Providers don't report token counts while streaming, so tokens
+// are estimated at four characters each, like estimateTokens.
+type streamStats struct {
+	start time.Time
+	first time.Time
+	chars int
+}
+
+// startStreamStats starts timing a request; call it just before sending.
+func startStreamStats() *streamStats {
+	return &streamStats{start: time.Now()}
+}
+
+// add records a streamed delta.
+func (s *streamStats) add(text string) {
+	if text == "" {
+		return
+	}
+	if s.first.IsZero() {
+		s.first = time.Now()
+	}
+	s.chars += len(text)
+}
+
+func (s *streamStats) summary(end time.Time) string {
+	if s.first.IsZero() {
+		return fmt.Sprintf("no content after %.2fs", end.Sub(s.start).Seconds())
+	}
+	total := end.Sub(s.start)
+	tokens := s.chars / 4
+	return fmt.Sprintf("first token %.2fs, ~%.1f tokens/s (~%d tokens in %.2fs)",
+		s.first.Sub(s.start).Seconds(), float64(tokens)/total.Seconds(), tokens, total.Seconds())
+}
+
+// report prints the stats with Config.ShowStats, or in verbose mode.
+func (s *streamStats) report(show bool) {
+	if show {
+		logInfo("[stats] %s", s.summary(time.Now()))
+	} else {
+		logDebug("stats: %s", s.summary(time.Now()))
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStreamStatsSummary(t *testing.T) {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	s := &streamStats{start: start}
+	if got := s.summary(start.Add(time.Second)); got != "no content after 1.00s" {
+		t.Errorf("summary without content = %q", got)
+	}
+	s.first = start.Add(500 * time.Millisecond)
+	s.chars = 400
+	expected := "first token 0.50s, ~50.0 tokens/s (~100 tokens in 2.00s)"
+	if got := s.summary(start.Add(2 * time.Second)); got != expected {
+		t.Errorf("summary = %q, expected %q", got, expected)
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+// structuredOutput reports whether Config.ResponseFormat asks for JSON
+// answers. Action tags are not offered or parsed in that mode.
+func structuredOutput(config *Config) bool {
+	return len(config.ResponseFormat) > 0
+}
+
+// withResponseFormat adds Config.ResponseFormat to the extra body fields of
+// OpenAI-compatible requests as a json_schema response_format. Gemini gets the
+// schema through clientOptions instead.
+func withResponseFormat(extra map[string]interface{}, config *Config, provider string) map[string]interface{} {
+	if !structuredOutput(config) || provider == "gemini" {
+		return extra
+	}
+	if extra == nil {
+		extra = map[string]interface{}{}
+	}
+	extra["response_format"] = map[string]interface{}{
+		"type":        "json_schema",
+		"json_schema": map[string]interface{}{"name": "response", "schema": config.ResponseFormat},
+	}
+	return extra
+}
+
+// geminiSchemaTypes maps JSON schema types to Gemini's.
+var geminiSchemaTypes = map[string]genai.Type{
+	"string":  genai.TypeString,
+	"number":  genai.TypeNumber,
+	"integer": genai.TypeInteger,
+	"boolean": genai.TypeBoolean,
+	"array":   genai.TypeArray,
+	"object":  genai.TypeObject,
+}
+
+// geminiSchema converts the subset of JSON schema Gemini understands: type,
+// description, enum, items, properties and required.
+func geminiSchema(schema map[string]interface{}) *genai.Schema {
+	if schema == nil {
+		return nil
+	}
+	s := &genai.Schema{}
+	if t, ok := schema["type"].(string); ok {
+		s.Type = geminiSchemaTypes[t]
+	}
+	s.Description, _ = schema["description"].(string)
+	for _, value := range asSlice(schema["enum"]) {
+		s.Enum = append(s.Enum, fmt.Sprint(value))
+	}
+	if items, ok := schema["items"].(map[string]interface{}); ok {
+		s.Items = geminiSchema(items)
+	}
+	if properties, ok := schema["properties"].(map[string]interface{}); ok {
+		s.Properties = map[string]*genai.Schema{}
+		for name, property := range properties {
+			if property, ok := property.(map[string]interface{}); ok {
+				s.Properties[name] = geminiSchema(property)
+			}
+		}
+	}
+	for _, name := range asSlice(schema["required"]) {
+		if name, ok := name.(string); ok {
+			s.Required = append(s.Required, name)
+		}
+	}
+	return s
+}
+
+// asSlice returns value as a slice, or nil if it isn't one.
+func asSlice(value interface{}) []interface{} {
+	slice, _ := value.([]interface{})
+	return slice
+}
+
+// validateResponseFormat checks that Config.ResponseFormat looks like a JSON
+// schema with a known top-level type.
+func validateResponseFormat(config *Config) error {
+	if !structuredOutput(config) {
+		return nil
+	}
+	t, _ := config.ResponseFormat["type"].(string)
+	if _, ok := geminiSchemaTypes[t]; !ok {
+		return fmt.Errorf("response_format must be a JSON schema with a \"type\" (got %q)", t)
+	}
+	return nil
+}
+
+// checkStructuredResponse parses response as JSON, ignoring a surrounding
+// code fence, and returns where it doesn't match schema.
+func checkStructuredResponse(response string, schema map[string]interface{}) []string {
+	text := strings.TrimSpace(response)
+	if strings.HasPrefix(text, "```") {
+		text = strings.TrimPrefix(text[strings.IndexByte(text+"\n", '\n'):], "\n")
+		text = strings.TrimSuffix(strings.TrimSpace(text), "```")
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(text), &value); err != nil {
+		return []string{fmt.Sprintf("the response is not valid JSON: %v", err)}
+	}
+	return schemaMismatches(value, schema, "$")
+}
+
+// schemaMismatches returns the places where value doesn't match schema,
+// checking type, enum, required, properties, additionalProperties and items.
+func schemaMismatches(value interface{}, schema map[string]interface{}, path string) []string {
+	if t, ok := schema["type"].(string); ok && !hasSchemaType(value, t) {
+		return []string{fmt.Sprintf("%s: expected %s, got %s", path, t, jsonTypeName(value))}
+	}
+	var mismatches []string
+	if enum := asSlice(schema["enum"]); enum != nil && !containsValue(enum, value) {
+		mismatches = append(mismatches, fmt.Sprintf("%s: %v is not one of the allowed values", path, value))
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, name := range asSlice(schema["required"]) {
+			if name, ok := name.(string); ok {
+				if _, present := v[name]; !present {
+					mismatches = append(mismatches, fmt.Sprintf("%s: missing required property %q", path, name))
+				}
+			}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if property, ok := properties[name].(map[string]interface{}); ok {
+				mismatches = append(mismatches, schemaMismatches(v[name], property, path+"."+name)...)
+			} else if schema["additionalProperties"] == false {
+				mismatches = append(mismatches, fmt.Sprintf("%s: unexpected property %q", path, name))
+			}
+		}
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				mismatches = append(mismatches, schemaMismatches(item, items, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	}
+	return mismatches
+}
+
+// hasSchemaType reports whether value is of the JSON schema type t.
+func hasSchemaType(value interface{}, t string) bool {
+	if t == "integer" {
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	}
+	return jsonTypeName(value) == t
+}
+
+// jsonTypeName returns the JSON schema type name of a decoded JSON value.
+func jsonTypeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	}
+	return "object"
+}
+
+// containsValue reports whether values holds value.
+func containsValue(values []interface{}, value interface{}) bool {
+	for _, v := range values {
+		if fmt.Sprint(v) == fmt.Sprint(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// errSchemaMismatch is returned by a turn whose JSON answer doesn't match
+// Config.ResponseFormat.
+var errSchemaMismatch = errors.New("the response does not match response_format")
+
+// reportStructuredResponse logs where response doesn't match the schema.
+func reportStructuredResponse(response string, schema map[string]interface{}) error {
+	mismatches := checkStructuredResponse(response, schema)
+	for _, mismatch := range mismatches {
+		logError("Schema mismatch: %s", mismatch)
+	}
+	if len(mismatches) > 0 {
+		return errSchemaMismatch
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+var testSchema = map[string]interface{}{
+	"type":                 "object",
+	"required":             []interface{}{"name", "tags"},
+	"additionalProperties": false,
+	"properties": map[string]interface{}{
+		"name": map[string]interface{}{"type": "string"},
+		"age":  map[string]interface{}{"type": "integer"},
+		"kind": map[string]interface{}{"type": "string", "enum": []interface{}{"cat", "dog"}},
+		"tags": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+	},
+}
+
+func TestCheckStructuredResponse(t *testing.T) {
+	tests := []struct {
+		response string
+		want     []string
+	}{
+		{`{"name": "Rex", "age": 3, "kind": "dog", "tags": ["good"]}`, nil},
+		{"```json\n{\"name\": \"Rex\", \"tags\": []}\n```\n", nil},
+		{`{"age": 3.5, "kind": "cow", "tags": [1], "extra": true}`, []string{
+			`$: missing required property "name"`,
+			"$.age: expected integer, got number",
+			`$: unexpected property "extra"`,
+			"$.kind: cow is not one of the allowed values",
+			"$.tags[0]: expected string, got number",
+		}},
+		{`[]`, []string{"$: expected object, got array"}},
+	}
+	for _, tt := range tests {
+		if got := checkStructuredResponse(tt.response, testSchema); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("checkStructuredResponse(%q) = %q, want %q", tt.response, got, tt.want)
+		}
+	}
+	if got := checkStructuredResponse("not json", testSchema); len(got) != 1 {
+		t.Errorf("Expected invalid JSON to be reported, got %q", got)
+	}
+}
+
+func TestResponseFormatOptions(t *testing.T) {
+	config := &Config{SelectedModel: "gpt-4o", ResponseFormat: testSchema}
+	format, ok := newClientOptions(config, "openai", "").extraBody["response_format"].(map[string]interface{})
+	if !ok || format["type"] != "json_schema" {
+		t.Errorf("Expected a json_schema response_format, got %v", format)
+	}
+	if _, ok := newClientOptions(config, "gemini", "").extraBody["response_format"]; ok {
+		t.Error("Expected no response_format in the Gemini extra body")
+	}
+
+	schema := geminiSchema(testSchema)
+	if schema.Type != genai.TypeObject || schema.Properties["tags"].Items.Type != genai.TypeString || !reflect.DeepEqual(schema.Properties["kind"].Enum, []string{"cat", "dog"}) {
+		t.Errorf("Unexpected Gemini schema %+v", schema)
+	}
+	if err := validateResponseFormat(&Config{ResponseFormat: map[string]interface{}{"properties": map[string]interface{}{}}}); err == nil {
+		t.Error("Expected a schema without a type to be rejected")
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// actionTags lists the logical action names. Config.TagNames may rename the
+// tag used for each of them.
+var actionTags = []string{"PATCH", "EDIT", "RUN", "READ_RAW", "READ", "REPLACE", "LISTFILES", "SEARCHFILES", "DIFF", "MEMORY_APPEND"}
+
+// tagNames maps a logical action to its configured tag name. It is set once
+// at startup by setTagNames; missing entries use the logical name.
+var tagNames = map[string]string{}
+
+var tagNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// tagName returns the tag name used for action.
+func tagName(action string) string {
+	if name := tagNames[action]; name != "" {
+		return name
+	}
+	return action
+}
+
+// setTagNames validates and installs the Config.TagNames renames. Every
+// action must keep a distinct tag, and TOOL_OUTPUT is reserved.
+func setTagNames(names map[string]string) error {
+	known := map[string]bool{}
+	for _, action := range actionTags {
+		known[action] = true
+	}
+	for action, name := range names {
+		if !known[action] {
+			return fmt.Errorf("unknown action %q in tag_names (expected one of %s)", action, strings.Join(actionTags, ", "))
+		}
+		if !tagNamePattern.MatchString(name) || name == "TOOL_OUTPUT" {
+			return fmt.Errorf("invalid tag name %q for %s", name, action)
+		}
+	}
+	used := map[string]string{}
+	for _, action := range actionTags {
+		name := action
+		if n := names[action]; n != "" {
+			name = n
+		}
+		if other, ok := used[name]; ok {
+			return fmt.Errorf("tag name %q is used for both %s and %s", name, other, action)
+		}
+		used[name] = action
+	}
+	tagNames = names
+	return nil
+}
+
+// renameTags rewrites the <ACTION> and </ACTION> tags in text to the
+// configured names.
+func renameTags(text string) string {
+	if len(tagNames) == 0 {
+		return text
+	}
+	var pairs []string
+	for _, action := range actionTags {
+		name := tagName(action)
+		pairs = append(pairs, "<"+action+">", "<"+name+">", "</"+action+">", "</"+name+">")
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
+
+// enabledActions holds the actions allowed by Config.EnabledActions; nil
+// enables every action. It is set once at startup by setEnabledActions.
+var enabledActions map[string]bool
+
+// actionEnabled reports whether action may be used.
+func actionEnabled(action string) bool {
+	return enabledActions == nil || enabledActions[action]
+}
+
+// setEnabledActions validates and installs Config.EnabledActions. A nil list
+// enables every action. An empty list is rejected: saving the config would
+// drop it and silently re-enable everything.
+func setEnabledActions(actions []string) error {
+	if actions == nil {
+		enabledActions = nil
+		return nil
+	}
+	if len(actions) == 0 {
+		return fmt.Errorf("enabled_actions is empty; list at least one action, or use --no-system-prompt for plain chat")
+	}
+	enabled := map[string]bool{}
+	for _, action := range actions {
+		action = strings.ToUpper(strings.TrimSpace(action))
+		if !contains(actionTags, action) {
+			return fmt.Errorf("unknown action %q in enabled_actions (expected one of %s)", action, strings.Join(actionTags, ", "))
+		}
+		enabled[action] = true
+	}
+	enabledActions = enabled
+	return nil
+}
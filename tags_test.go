@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCustomTagNames(t *testing.T) {
+	if err := setTagNames(map[string]string{"EDIT": "WRITE_FILE", "RUN": "SHELL"}); err != nil {
+		t.Fatalf("setTagNames failed: %v", err)
+	}
+	defer setTagNames(nil)
+
+	response := "<EDIT>\nignored.txt\nx\n</EDIT>\n<WRITE_FILE>\nnotes.txt\nhello\n</WRITE_FILE>\n[TOOL_CALL] <SHELL>ls</SHELL>"
+	actions := parseActions(response)
+	if len(actions) != 2 {
+		t.Fatalf("Expected 2 actions, got %d", len(actions))
+	}
+	if edit, ok := actions[0].Action.(EditAction); !ok || edit.Filename != "notes.txt" {
+		t.Errorf("Expected EditAction for notes.txt, got %#v", actions[0].Action)
+	}
+	if run, ok := actions[1].Action.(RunAction); !ok || run.Command != "ls" || !actions[1].IsToolCall {
+		t.Errorf("Expected a RUN tool call, got %#v", actions[1])
+	}
+
+	prompt := defaultSystemPrompt()
+	if strings.Contains(prompt, "<RUN>") || !strings.Contains(prompt, "<SHELL>\nshell_command_here\n</SHELL>") {
+		t.Errorf("Expected the system prompt to use the renamed tags")
+	}
+}
+
+func TestSetTagNamesRejectsInvalid(t *testing.T) {
+	defer setTagNames(nil)
+	for _, names := range []map[string]string{
+		{"DELETE": "RM"},
+		{"EDIT": "RUN"},
+		{"READ": "TOOL_OUTPUT"},
+		{"RUN": "bad tag"},
+	} {
+		if err := setTagNames(names); err == nil {
+			t.Errorf("Expected an error for %v", names)
+		}
+	}
+}
+
+func TestEnabledActions(t *testing.T) {
+	if err := setEnabledActions([]string{"READ", "searchfiles"}); err != nil {
+		t.Fatalf("setEnabledActions failed: %v", err)
+	}
+	defer setEnabledActions(nil)
+
+	prompt := defaultSystemPrompt()
+	for _, tag := range []string{"<RUN>", "<EDIT>", "<PATCH>", "<READ_RAW>"} {
+		if strings.Contains(prompt, tag) {
+			t.Errorf("Expected the prompt not to document %s", tag)
+		}
+	}
+	if !strings.Contains(prompt, "1. If I ask you to read a file") || !strings.Contains(prompt, "2. To search for text") {
+		t.Errorf("Expected the enabled sections to be renumbered:\n%s", prompt)
+	}
+	if !strings.Contains(prompt, "[TOOL_CALL] <READ>main.go</READ>") {
+		t.Errorf("Expected the tool call example to use an enabled action")
+	}
+
+	path := filepath.Join(t.TempDir(), "out.txt")
+	_, _, results := handleResponse(context.Background(), "<EDIT>\n"+path+"\nx\n</EDIT>", &scriptedClient{}, &Config{AutoEdit: true})
+	if len(results) != 1 || results[0].Status != statusSkipped {
+		t.Fatalf("Expected the EDIT to be skipped, got %+v", results)
+	}
+	if _, err := os.Stat(path); err == nil {
+		t.Errorf("Expected the disabled EDIT not to write %s", path)
+	}
+
+	for _, bad := range [][]string{{}, {"DELETE"}} {
+		if err := setEnabledActions(bad); err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+}
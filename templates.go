@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// templatePlaceholder matches {{name}} variables and {{run: command}} captures.
+var templatePlaceholder = regexp.MustCompile(`\{\{\s*(run:\s*([^}]*?)|[A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// templateNames returns the configured template names, sorted.
+func templateNames(config *Config) []string {
+	names := make([]string, 0, len(config.Templates))
+	for name := range config.Templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// renderTemplate expands the named template with key=value assignments.
+// {{name}} placeholders take the assigned values, and {{run: command}} is
+// replaced with the command's output, like a RUN whose output is inlined.
+// @file mentions are left for expandMentions.
+func renderTemplate(config *Config, name string, assignments []string) (string, error) {
+	body, ok := config.Templates[name]
+	if !ok {
+		return "", fmt.Errorf("unknown template %q", name)
+	}
+	vars := map[string]string{}
+	for _, a := range assignments {
+		key, value, ok := strings.Cut(a, "=")
+		if !ok {
+			return "", fmt.Errorf("invalid template argument %q, expected key=value", a)
+		}
+		vars[key] = value
+	}
+
+	var missing []string
+	var runErr error
+	out := templatePlaceholder.ReplaceAllStringFunc(body, func(match string) string {
+		m := templatePlaceholder.FindStringSubmatch(match)
+		if strings.HasPrefix(m[1], "run:") {
+			cmd := shellCommand(config, m[2])
+			cmd.Env = runEnv(config)
+			output, err := cmd.CombinedOutput()
+			if err != nil && runErr == nil {
+				runErr = fmt.Errorf("template command %q failed: %v", m[2], err)
+			}
+			return strings.TrimRight(stripANSI(string(output)), "\n")
+		}
+		value, ok := vars[m[1]]
+		if !ok {
+			missing = append(missing, m[1])
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("template %q needs a value for: %s", name, strings.Join(missing, ", "))
+	}
+	if runErr != nil {
+		return "", runErr
+	}
+	return out, nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+func TestRenderTemplate(t *testing.T) {
+	config := &Config{Templates: map[string]string{
+		"review": "Review {{file}} for {{ focus }}.\n{{run: echo captured}}",
+	}}
+	got, err := renderTemplate(config, "review", []string{"file=@main.go", "focus=error handling"})
+	if err != nil {
+		t.Fatalf("renderTemplate failed: %v", err)
+	}
+	if expected := "Review @main.go for error handling.\ncaptured"; got != expected {
+		t.Errorf("renderTemplate = %q, expected %q", got, expected)
+	}
+
+	if _, err := renderTemplate(config, "review", []string{"file=x"}); err == nil {
+		t.Errorf("Expected an error for a missing variable")
+	}
+	if _, err := renderTemplate(config, "missing", nil); err == nil {
+		t.Errorf("Expected an error for an unknown template")
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	got := splitArgs(`review file=main.go focus="error handling"  x=""`)
+	expected := []string{"review", "file=main.go", "focus=error handling", "x="}
+	if len(got) != len(expected) {
+		t.Fatalf("splitArgs = %q, expected %q", got, expected)
+	}
+	for i := range got {
+		if got[i] != expected[i] {
+			t.Errorf("splitArgs[%d] = %q, expected %q", i, got[i], expected[i])
+		}
+	}
+}
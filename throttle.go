@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// throttledClient wraps an AIClient and enforces a minimum interval between
+// consecutive SendMessage calls, smoothing bursts during tool-call loops.
+type throttledClient struct {
+	AIClient
+	interval time.Duration
+	last     time.Time
+}
+
+// newThrottledClient returns client unchanged when interval is not positive.
+func newThrottledClient(client AIClient, interval time.Duration) AIClient {
+	if interval <= 0 {
+		return client
+	}
+	return &throttledClient{AIClient: client, interval: interval}
+}
+
+// unwrapClient returns the provider client under the throttling, tracing, cost and caching wrappers.
+func unwrapClient(client AIClient) AIClient {
+	for {
+		switch c := client.(type) {
+		case *throttledClient:
+			client = c.AIClient
+		case *tracedClient:
+			client = c.AIClient
+		case *cachedClient:
+			client = c.AIClient
+		case *costLimitedClient:
+			client = c.AIClient
+		default:
+			return client
+		}
+	}
+}
+
+// SendMessage sleeps until the configured interval has elapsed since the previous request.
+func (t *throttledClient) SendMessage(ctx context.Context, input string) (string, error) {
+	if !t.last.IsZero() {
+		if wait := t.interval - time.Since(t.last); wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return "", ctx.Err()
+			}
+		}
+	}
+	t.last = time.Now()
+	return t.AIClient.SendMessage(ctx, input)
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tracing exports spans for model requests, tool-call loop iterations and
+// actions as OTLP/HTTP JSON, so no OpenTelemetry SDK is linked in. It is
+// enabled by OTEL_EXPORTER_OTLP_ENDPOINT (or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT)
+// and is a no-op otherwise.
+
+// tracer buffers finished spans until flush sends them to the collector.
+type tracer struct {
+	endpoint string
+	headers  map[string]string
+	service  string
+	client   *http.Client
+
+	mu    sync.Mutex
+	spans []*span
+	// exports tracks the exports still running in the background.
+	exports sync.WaitGroup
+}
+
+// activeTracer is nil when tracing is disabled.
+var activeTracer *tracer
+
+// initTracing enables tracing when an OTLP endpoint is configured.
+func initTracing() {
+	activeTracer = newTracer(os.Getenv)
+}
+
+func newTracer(getenv func(string) string) *tracer {
+	endpoint := getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		base := getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+		if base == "" {
+			return nil
+		}
+		endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+	}
+	service := getenv("OTEL_SERVICE_NAME")
+	if service == "" {
+		service = "arisu"
+	}
+	headers := map[string]string{}
+	for _, pair := range strings.Split(getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		if key, value, ok := strings.Cut(pair, "="); ok {
+			headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	return &tracer{endpoint: endpoint, headers: headers, service: service, client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+// span is one timed operation. A nil *span is valid and records nothing.
+type span struct {
+	tracer   *tracer
+	traceID  string
+	spanID   string
+	parentID string
+	name     string
+	start    time.Time
+	end      time.Time
+	attrs    map[string]interface{}
+	err      error
+}
+
+type spanKey struct{}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// startSpan starts a span that is a child of the span in ctx, if any.
+func startSpan(ctx context.Context, name string) (context.Context, *span) {
+	if activeTracer == nil {
+		return ctx, nil
+	}
+	s := &span{tracer: activeTracer, spanID: randomHex(8), name: name, start: time.Now(), attrs: map[string]interface{}{}}
+	if parent, ok := ctx.Value(spanKey{}).(*span); ok {
+		s.traceID, s.parentID = parent.traceID, parent.spanID
+	} else {
+		s.traceID = randomHex(16)
+	}
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// set records an attribute; value is a string, bool or int.
+func (s *span) set(key string, value interface{}) {
+	if s != nil {
+		s.attrs[key] = value
+	}
+}
+
+// finish ends the span with err as its status and queues it for export.
+func (s *span) finish(err error) {
+	if s == nil {
+		return
+	}
+	s.end, s.err = time.Now(), err
+	s.tracer.mu.Lock()
+	s.tracer.spans = append(s.tracer.spans, s)
+	s.tracer.mu.Unlock()
+}
+
+type otlpValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+func otlpAttributes(attrs map[string]interface{}) []otlpAttribute {
+	var out []otlpAttribute
+	for key, value := range attrs {
+		var v otlpValue
+		switch value := value.(type) {
+		case bool:
+			v.BoolValue = &value
+		case int:
+			s := strconv.Itoa(value)
+			v.IntValue = &s
+		default:
+			s := fmt.Sprint(value)
+			v.StringValue = &s
+		}
+		out = append(out, otlpAttribute{Key: key, Value: v})
+	}
+	return out
+}
+
+// otlpPayload encodes spans as an OTLP ExportTraceServiceRequest.
+func (t *tracer) otlpPayload(spans []*span) ([]byte, error) {
+	encoded := make([]map[string]interface{}, 0, len(spans))
+	for _, s := range spans {
+		status := map[string]interface{}{"code": 1}
+		if s.err != nil {
+			status = map[string]interface{}{"code": 2, "message": s.err.Error()}
+		}
+		item := map[string]interface{}{
+			"traceId":           s.traceID,
+			"spanId":            s.spanID,
+			"name":              s.name,
+			"kind":              1,
+			"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+			"attributes":        otlpAttributes(s.attrs),
+			"status":            status,
+		}
+		if s.parentID != "" {
+			item["parentSpanId"] = s.parentID
+		}
+		encoded = append(encoded, item)
+	}
+	return json.Marshal(map[string]interface{}{
+		"resourceSpans": []map[string]interface{}{{
+			"resource": map[string]interface{}{
+				"attributes": otlpAttributes(map[string]interface{}{"service.name": t.service}),
+			},
+			"scopeSpans": []map[string]interface{}{{
+				"scope": map[string]string{"name": "arisu"},
+				"spans": encoded,
+			}},
+		}},
+	})
+}
+
+// flushTraces sends the spans finished so far in the background, so a slow
+// collector never delays the next turn.
+func flushTraces() {
+	t := activeTracer
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	spans := t.spans
+	t.spans = nil
+	t.mu.Unlock()
+	if len(spans) == 0 {
+		return
+	}
+	t.exports.Add(1)
+	go func() {
+		defer t.exports.Done()
+		t.export(spans)
+	}()
+}
+
+// shutdownTracing flushes the remaining spans and waits for every export to
+// finish, each bounded by the client's timeout. It is called on exit.
+func shutdownTracing() {
+	if activeTracer == nil {
+		return
+	}
+	flushTraces()
+	activeTracer.exports.Wait()
+}
+
+// export sends spans to the collector. Export failures are only logged in
+// verbose mode; tracing never fails a turn.
+func (t *tracer) export(spans []*span) {
+	body, err := t.otlpPayload(spans)
+	if err != nil {
+		logDebug("Error encoding traces: %v", err)
+		return
+	}
+	req, err := http.NewRequest(http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		logDebug("Error exporting traces: %v", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		logDebug("Error exporting traces: %v", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		logDebug("Error exporting traces: collector returned %s", resp.Status)
+	}
+}
+
+// tracedClient records a span for every SendMessage call.
+type tracedClient struct {
+	AIClient
+	provider string
+	model    string
+}
+
+// newTracedClient returns client unchanged when tracing is disabled.
+func newTracedClient(client AIClient, provider, model string) AIClient {
+	if activeTracer == nil {
+		return client
+	}
+	return &tracedClient{AIClient: client, provider: provider, model: model}
+}
+
+// SendMessage wraps the request in a span with the token usage the provider
+// reported, or the input and output sizes in characters when it reported none.
+func (t *tracedClient) SendMessage(ctx context.Context, input string) (string, error) {
+	ctx, sp := startSpan(ctx, "arisu.send_message")
+	sp.set("gen_ai.system", t.provider)
+	sp.set("gen_ai.request.model", t.model)
+	response, err := t.AIClient.SendMessage(ctx, input)
+	if r, ok := unwrapClient(t.AIClient).(usageReporter); ok && r.Usage() != (tokenUsage{}) {
+		sp.set("gen_ai.usage.input_tokens", r.Usage().Prompt)
+		sp.set("gen_ai.usage.output_tokens", r.Usage().Completion)
+	} else {
+		sp.set("arisu.input_chars", len(input))
+		sp.set("arisu.output_chars", len(response))
+	}
+	sp.set("arisu.truncated", t.AIClient.Truncated())
+	sp.finish(err)
+	return response, err
+}
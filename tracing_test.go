@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTracingDisabledWithoutEndpoint(t *testing.T) {
+	if tr := newTracer(func(string) string { return "" }); tr != nil {
+		t.Errorf("Expected tracing to be disabled without an endpoint")
+	}
+}
+
+func TestFlushTraces(t *testing.T) {
+	var body []byte
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		auth = r.Header.Get("Authorization")
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	env := map[string]string{
+		"OTEL_EXPORTER_OTLP_ENDPOINT": server.URL + "/",
+		"OTEL_EXPORTER_OTLP_HEADERS":  "Authorization=Bearer x",
+	}
+	activeTracer = newTracer(func(key string) string { return env[key] })
+	defer func() { activeTracer = nil }()
+
+	ctx, parent := startSpan(context.Background(), "arisu.turn")
+	_, child := startSpan(ctx, "arisu.action")
+	child.set("arisu.action.type", "RUN")
+	child.set("arisu.iteration", 2)
+	child.finish(errors.New("exit status 1"))
+	parent.finish(nil)
+	shutdownTracing()
+
+	if auth != "Bearer x" {
+		t.Errorf("Authorization header = %q", auth)
+	}
+	var payload struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []struct {
+					TraceID      string `json:"traceId"`
+					SpanID       string `json:"spanId"`
+					ParentSpanID string `json:"parentSpanId"`
+					Name         string `json:"name"`
+					Status       struct {
+						Code int `json:"code"`
+					} `json:"status"`
+				} `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatalf("invalid payload: %v", err)
+	}
+	spans := payload.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("exported %d spans, expected 2", len(spans))
+	}
+	action, turn := spans[0], spans[1]
+	if action.TraceID != turn.TraceID || action.ParentSpanID != turn.SpanID || turn.ParentSpanID != "" {
+		t.Errorf("action span is not a child of the turn span: %+v %+v", action, turn)
+	}
+	if action.Status.Code != 2 || turn.Status.Code != 1 {
+		t.Errorf("status codes = %d, %d; expected 2, 1", action.Status.Code, turn.Status.Code)
+	}
+}
+
+func TestFlushTracesDoesNotWaitForCollector(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	activeTracer = newTracer(func(key string) string {
+		if key == "OTEL_EXPORTER_OTLP_ENDPOINT" {
+			return server.URL
+		}
+		return ""
+	})
+	defer func() { activeTracer = nil }()
+
+	_, sp := startSpan(context.Background(), "arisu.turn")
+	sp.finish(nil)
+	start := time.Now()
+	flushTraces()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("flushTraces blocked for %v on a slow collector", elapsed)
+	}
+	close(release)
+	shutdownTracing()
+}
+
+func TestTracedClientRecordsUsage(t *testing.T) {
+	activeTracer = &tracer{}
+	defer func() { activeTracer = nil }()
+	inner := &usageClient{scriptedClient: scriptedClient{replies: []string{"hi"}}, usage: tokenUsage{Prompt: 12, Completion: 3}}
+	client := newTracedClient(inner, "openai", "gpt-4o")
+	if _, err := client.SendMessage(context.Background(), "hello"); err != nil {
+		t.Fatalf("SendMessage failed: %v", err)
+	}
+	attrs := activeTracer.spans[0].attrs
+	if attrs["gen_ai.usage.input_tokens"] != 12 || attrs["gen_ai.usage.output_tokens"] != 3 {
+		t.Errorf("span attributes = %v, want the reported usage", attrs)
+	}
+	if _, ok := attrs["arisu.input_chars"]; ok {
+		t.Errorf("span has character counts although usage was reported: %v", attrs)
+	}
+}
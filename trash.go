@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// defaultTrashMaxAgeDays is how long trashed files are kept by default.
+const defaultTrashMaxAgeDays = 30
+
+// trashDir is where overwritten files are moved; main sets it to
+// ~/.config/arisu/trash. An empty trashDir disables the trash.
+var trashDir string
+
+// trashEntry records one trashed file in the trash manifest.
+type trashEntry struct {
+	ID        string    `json:"id"`
+	Path      string    `json:"path"`
+	TrashedAt time.Time `json:"trashed_at"`
+}
+
+// useTrash reports whether overwritten files should be trashed (the default).
+func useTrash(config *Config) bool {
+	return trashDir != "" && (config.UseTrash == nil || *config.UseTrash)
+}
+
+func trashManifest(dir string) string {
+	return filepath.Join(dir, "manifest.json")
+}
+
+func loadTrash(dir string) ([]trashEntry, error) {
+	data, err := os.ReadFile(trashManifest(dir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []trashEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("invalid trash manifest: %w", err)
+	}
+	return entries, nil
+}
+
+func saveTrash(dir string, entries []trashEntry) error {
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(trashManifest(dir), data, 0600)
+}
+
+// trashFile copies path into dir and records it in the manifest, so the
+// file can be restored after it is overwritten or deleted.
+func trashFile(dir, path string) (trashEntry, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return trashEntry{}, err
+	}
+	content, err := os.ReadFile(abs)
+	if err != nil {
+		return trashEntry{}, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return trashEntry{}, err
+	}
+	entries, err := loadTrash(dir)
+	if err != nil {
+		return trashEntry{}, err
+	}
+	now := time.Now()
+	entry := trashEntry{ID: strconv.FormatInt(now.UnixNano(), 36), Path: abs, TrashedAt: now}
+	if err := os.WriteFile(filepath.Join(dir, entry.ID), content, 0600); err != nil {
+		return trashEntry{}, err
+	}
+	return entry, saveTrash(dir, append(entries, entry))
+}
+
+// restoreTrash writes the trashed file id back to its original path. The
+// file currently at that path, if any, is trashed first.
+func restoreTrash(dir, id string) (trashEntry, error) {
+	entries, err := loadTrash(dir)
+	if err != nil {
+		return trashEntry{}, err
+	}
+	for i, entry := range entries {
+		if entry.ID != id {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(dir, id))
+		if err != nil {
+			return entry, err
+		}
+		if _, err := os.Stat(entry.Path); err == nil {
+			if _, err := trashFile(dir, entry.Path); err != nil {
+				return entry, err
+			}
+			// trashFile appended to the manifest; reload it so the new entry
+			// is kept. Entry i is unchanged.
+			if entries, err = loadTrash(dir); err != nil {
+				return entry, err
+			}
+		}
+		if err := os.MkdirAll(filepath.Dir(entry.Path), 0755); err != nil {
+			return entry, err
+		}
+		if err := os.WriteFile(entry.Path, content, 0644); err != nil {
+			return entry, err
+		}
+		os.Remove(filepath.Join(dir, id))
+		return entry, saveTrash(dir, append(entries[:i:i], entries[i+1:]...))
+	}
+	return trashEntry{}, fmt.Errorf("no trashed file with id %s", id)
+}
+
+// purgeTrash deletes trashed files older than maxAge.
+func purgeTrash(dir string, maxAge time.Duration) error {
+	entries, err := loadTrash(dir)
+	if err != nil || len(entries) == 0 {
+		return err
+	}
+	kept := entries[:0]
+	for _, entry := range entries {
+		if time.Since(entry.TrashedAt) > maxAge {
+			os.Remove(filepath.Join(dir, entry.ID))
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	return saveTrash(dir, kept)
+}
+
+// trashMaxAge returns how long trashed files are kept.
+func trashMaxAge(config *Config) time.Duration {
+	days := config.TrashMaxAgeDays
+	if days <= 0 {
+		days = defaultTrashMaxAgeDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
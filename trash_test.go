@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTrashAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	trash := filepath.Join(dir, "trash")
+	path := filepath.Join(dir, "notes.txt")
+	os.WriteFile(path, []byte("original"), 0644)
+
+	entry, err := trashFile(trash, path)
+	if err != nil {
+		t.Fatalf("trashFile failed: %v", err)
+	}
+	os.WriteFile(path, []byte("overwritten"), 0644)
+
+	if _, err := restoreTrash(trash, entry.ID); err != nil {
+		t.Fatalf("restoreTrash failed: %v", err)
+	}
+	if content, _ := os.ReadFile(path); string(content) != "original" {
+		t.Errorf("Expected restored content, got %q", content)
+	}
+	// The overwritten version was trashed in turn, so the restore is undoable.
+	entries, _ := loadTrash(trash)
+	if len(entries) != 1 || entries[0].ID == entry.ID {
+		t.Fatalf("Expected only the overwritten version in the trash, got %+v", entries)
+	}
+
+	if err := purgeTrash(trash, -time.Second); err != nil {
+		t.Fatalf("purgeTrash failed: %v", err)
+	}
+	if entries, _ := loadTrash(trash); len(entries) != 0 {
+		t.Errorf("Expected purge to empty the trash, got %+v", entries)
+	}
+}
+
+func TestEveryFileChangeIsTrashed(t *testing.T) {
+	dir := t.TempDir()
+	defer func(old string) { trashDir = old }(trashDir)
+	trashDir = filepath.Join(dir, "trash")
+	path := filepath.Join(dir, "notes.txt")
+	os.WriteFile(path, []byte("one\n"), 0644)
+	config := &Config{AutoEdit: true}
+
+	actions := []Action{
+		ReplaceAction{Filename: path, Old: "one", New: "two"},
+		EditAction{Filename: path, Content: "three\n"},
+	}
+	for _, action := range actions {
+		if _, err := action.Execute(&scriptedClient{}, config, false); err != nil {
+			t.Fatalf("%T failed: %v", action, err)
+		}
+	}
+	entries, _ := loadTrash(trashDir)
+	if len(entries) != len(actions) {
+		t.Fatalf("Expected one trash entry per change, got %+v", entries)
+	}
+	for i, want := range []string{"one\n", "two\n"} {
+		if data, _ := os.ReadFile(filepath.Join(trashDir, entries[i].ID)); string(data) != want {
+			t.Errorf("trash entry %d = %q, want %q", i, data, want)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// codeFencePattern matches fenced code blocks, which are not read aloud.
+var codeFencePattern = regexp.MustCompile("(?s)```.*?(```|$)")
+
+// ttsState serializes speech so responses are read one at a time, and
+// remembers when the TTS command turned out to be unavailable. speaking is
+// held while a response is read; mu only guards disabled, so starting the next
+// response never waits for the current one to finish.
+var ttsState struct {
+	mu       sync.Mutex
+	disabled bool
+	speaking sync.Mutex
+	pending  sync.WaitGroup
+}
+
+// defaultTTSCommand returns the platform's text-to-speech command, which
+// reads the text from stdin.
+func defaultTTSCommand() []string {
+	if runtime.GOOS == "darwin" {
+		return []string{"say"}
+	}
+	if _, err := exec.LookPath("espeak"); err != nil {
+		if _, err := exec.LookPath("spd-say"); err == nil {
+			return []string{"spd-say", "-e"}
+		}
+	}
+	return []string{"espeak"}
+}
+
+// speakableText returns the prose of response: action tags and their
+// content, tool output, [TOOL_CALL] markers and code blocks are removed.
+func speakableText(response string) string {
+	text := codeFencePattern.ReplaceAllString(stripToolOutput(response), " ")
+	for _, action := range actionTags {
+		name := regexp.QuoteMeta(tagName(action))
+		text = regexp.MustCompile(`(?s)<`+name+`>.*?(</`+name+`>|$)`).ReplaceAllString(text, " ")
+	}
+	text = strings.ReplaceAll(text, "[TOOL_CALL]", " ")
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// speak reads the prose of response aloud with Config.TTSCommand, or the
+// platform default, in the background. If the command can't be found, a
+// warning is printed once and speech is disabled for the rest of the run.
+// Server mode never speaks: the answer goes to the HTTP client, not to
+// whoever sits at the server host.
+func speak(config *Config, response string) {
+	if !config.TTS || promptsDisabled {
+		return
+	}
+	text := speakableText(response)
+	if text == "" {
+		return
+	}
+	args := strings.Fields(config.TTSCommand)
+	if len(args) == 0 {
+		args = defaultTTSCommand()
+	}
+	ttsState.mu.Lock()
+	if ttsState.disabled {
+		ttsState.mu.Unlock()
+		return
+	}
+	if _, err := exec.LookPath(args[0]); err != nil {
+		ttsState.disabled = true
+		ttsState.mu.Unlock()
+		logWarn("Warning: text-to-speech command %q not found; speech is disabled for this session. Set tts_command to a command that reads text from stdin.", args[0])
+		return
+	}
+	ttsState.mu.Unlock()
+
+	ttsState.pending.Add(1)
+	go func() {
+		defer ttsState.pending.Done()
+		// Responses are read one at a time, in the background.
+		ttsState.speaking.Lock()
+		defer ttsState.speaking.Unlock()
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		if err := cmd.Run(); err != nil {
+			logDebug("Text-to-speech failed: %v", err)
+		}
+	}()
+}
+
+// waitForSpeech waits until every response has been read aloud, so a
+// one-shot run isn't cut off when arisu exits.
+func waitForSpeech() {
+	ttsState.pending.Wait()
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSpeakableText(t *testing.T) {
+	response := "I'll update the handler.\n<EDIT>\nmain.go\npackage main\n</EDIT>\n" +
+		"[TOOL_CALL] <RUN>go test ./...</RUN>\n```go\nfunc main() {}\n```\nDone, tests pass."
+	want := "I'll update the handler. Done, tests pass."
+	if got := speakableText(response); got != want {
+		t.Errorf("speakableText = %q, want %q", got, want)
+	}
+	if got := speakableText("<READ>main.go</READ>"); got != "" {
+		t.Errorf("Expected nothing to speak, got %q", got)
+	}
+}
+
+func TestSpeakDoesNotWaitForPreviousSpeech(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("sleep not installed")
+	}
+	config := &Config{TTS: true, TTSCommand: "sleep 1"}
+	speak(config, "first response")
+	time.Sleep(100 * time.Millisecond) // let the first response start speaking
+
+	start := time.Now()
+	speak(config, "second response")
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("speak blocked for %v while the previous response was read", elapsed)
+	}
+	waitForSpeech()
+}
+
+func TestSpeakIsSilentInServerMode(t *testing.T) {
+	if _, err := exec.LookPath("touch"); err != nil {
+		t.Skip("touch not installed")
+	}
+	marker := filepath.Join(t.TempDir(), "spoken")
+	config := &Config{TTS: true, TTSCommand: "touch " + marker}
+
+	promptsDisabled = true
+	speak(config, "served response")
+	promptsDisabled = false
+	waitForSpeech()
+	if _, err := os.Stat(marker); err == nil {
+		t.Fatal("Expected server mode not to run the text-to-speech command")
+	}
+
+	speak(config, "local response")
+	waitForSpeech()
+	if _, err := os.Stat(marker); err != nil {
+		t.Errorf("Expected the text-to-speech command to run outside server mode: %v", err)
+	}
+}
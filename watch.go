@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+)
+
+const defaultWatchMaxIterations = 5
+
+// runWatchCommand runs command in bash, echoing its output, and reports whether it succeeded.
+func runWatchCommand(ctx context.Context, command string) (string, bool) {
+	var outputBuf bytes.Buffer
+	cmd := exec.CommandContext(ctx, "bash", "-c", command)
+	cmd.Stdout = io.MultiWriter(console, &outputBuf)
+	cmd.Stderr = io.MultiWriter(os.Stderr, &outputBuf)
+	err := cmd.Run()
+	return stripANSI(outputBuf.String()), err == nil
+}
+
+// runWatch implements --watch: it runs command and, while it fails, sends the
+// output and instruction to the model so it can apply fixes, then re-runs the
+// command. It stops when the command passes or after maxIterations fix attempts.
+func runWatch(ctx context.Context, s *session, command, instruction string, maxIterations int) bool {
+	if maxIterations <= 0 {
+		maxIterations = defaultWatchMaxIterations
+	}
+	start := time.Now()
+	for i := 1; ; i++ {
+		fmt.Fprintf(console, "==> [watch %d] %s\n", i, command)
+		output, ok := runWatchCommand(ctx, command)
+		if ok {
+			fmt.Fprintf(console, "==> Watch finished: command passed after %d run(s) in %s.\n", i, time.Since(start).Round(time.Second))
+			return true
+		}
+		if ctx.Err() != nil || i > maxIterations {
+			fmt.Fprintf(console, "==> Watch stopped: command still failing after %d fix attempt(s) in %s.\n", i-1, time.Since(start).Round(time.Second))
+			return false
+		}
+		prompt := fmt.Sprintf("%s\n\nThe command `%s` failed (attempt %d of %d). Fix the problem; it will be re-run automatically.\nOutput:\n%s",
+			instruction, command, i, maxIterations, output)
+		if err := s.runTurn(ctx, prompt); err != nil {
+			fmt.Fprintf(console, "==> Watch stopped after %d run(s): %v\n", i, err)
+			return false
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import "strings"
+
+// weakModelPatterns are fragments of model names that are known to follow
+// the action-tag protocol poorly: older chat models and small open models.
+var weakModelPatterns = []string{
+	"gpt-3.5",
+	"gemma",
+	"tinyllama",
+	"phi-2",
+	"phi-3-mini",
+	"llama-3.2-1b",
+	"llama-3.2-3b",
+	"qwen2.5-0.5b",
+	"qwen2.5-1.5b",
+	"mistral-7b",
+}
+
+// weakToolModel reports whether model is known to handle action tags poorly.
+func weakToolModel(model string) bool {
+	model = strings.ToLower(model)
+	for _, pattern := range weakModelPatterns {
+		if strings.Contains(model, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// warnWeakToolModel notes at startup that actions may not fire with a weak
+// model, suggesting the provider's default model instead.
+func warnWeakToolModel(model, provider string) {
+	if !weakToolModel(model) {
+		return
+	}
+	logWarn("Note: %s often ignores Arisu's action tags, so edits and commands may silently not happen. For agentic work, try a more capable model such as %s.", model, providerDefaultModels[provider])
+}
@@ -0,0 +1,18 @@
+package main
+
+import "testing"
+
+func TestWeakToolModel(t *testing.T) {
+	for model, want := range map[string]bool{
+		"gpt-3.5-turbo":                               true,
+		"openrouter-google/gemma-2-9b-it":             true,
+		"openrouter-meta-llama/llama-3.2-3b-instruct": true,
+		"gpt-4o":                               false,
+		"gemini-2.5-pro":                       false,
+		"openrouter-anthropic/claude-sonnet-4": false,
+	} {
+		if got := weakToolModel(model); got != want {
+			t.Errorf("weakToolModel(%q) = %v, want %v", model, got, want)
+		}
+	}
+}